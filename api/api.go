@@ -0,0 +1,9 @@
+// Package api contains the OpenAPI specification of the public API.
+package api
+
+import _ "embed"
+
+// Spec is the OpenAPI 3 specification of the /api/v1 API in YAML.
+//
+//go:embed openapi.yaml
+var Spec []byte
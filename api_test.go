@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/api"
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/db/dbtest"
+	"github.com/anthdm/ssltracker/handlers"
+	"github.com/anthdm/ssltracker/pkg/client"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	testBaseURL  = "http://certpulse.test"
+	testUserID   = "0b7c1c9e-2d5f-4f55-a0b3-8a9f6f0e7d21"
+	testViewerID = "5d1e7a3f-8c2b-4e6d-9f0a-1b2c3d4e5f60"
+)
+
+// contractTransport sends the requests of the client to the Fiber app
+// in-process and validates every request and response against the spec.
+type contractTransport struct {
+	t      *testing.T
+	app    *fiber.App
+	router routers.Router
+}
+
+func (ct *contractTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := ct.app.Test(req, -1)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	route, pathParams, err := ct.router.FindRoute(req)
+	if err != nil {
+		ct.t.Errorf("%s %s is not in the spec: %s", req.Method, req.URL.Path, err)
+		return resp, nil
+	}
+	req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	reqInput := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	if err := openapi3filter.ValidateRequest(context.Background(), reqInput); err != nil {
+		ct.t.Errorf("%s %s request does not match the spec: %s", req.Method, req.URL.Path, err)
+	}
+	respInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: reqInput,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   io.NopCloser(bytes.NewReader(respBody)),
+	}
+	if err := openapi3filter.ValidateResponse(context.Background(), respInput); err != nil {
+		ct.t.Errorf("%s %s response does not match the spec: %s", req.Method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	doc, err := openapi3.NewLoader().LoadFromData(api.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid OpenAPI spec: %s", err)
+	}
+	return doc
+}
+
+func newTestApp() *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: handlers.ErrorHandler,
+	})
+	registerAPIRoutes(app)
+	return app
+}
+
+func newContractClient(t *testing.T, app *fiber.App, apiKey string) *client.Client {
+	doc := loadSpec(t)
+	doc.Servers = openapi3.Servers{{URL: testBaseURL + "/api/v1"}}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient := &http.Client{Transport: &contractTransport{t: t, app: app, router: router}}
+	return client.New(testBaseURL, apiKey, client.WithHTTPClient(httpClient))
+}
+
+func expectAPIError(t *testing.T, err error, status int, code string) {
+	t.Helper()
+	apiErr, ok := err.(*client.Error)
+	if !ok {
+		t.Fatalf("expected API error %d %s got %v", status, code, err)
+	}
+	if apiErr.StatusCode != status || apiErr.Code != code {
+		t.Fatalf("expected API error %d %s got %d %s", status, code, apiErr.StatusCode, apiErr.Code)
+	}
+}
+
+func TestAPIServesSpec(t *testing.T) {
+	loadSpec(t)
+	app := newTestApp()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/openapi.yaml", nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(b, api.Spec) {
+		t.Fatalf("expected the spec to be served without an API key got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIContractUnauthorized(t *testing.T) {
+	c := newContractClient(t, newTestApp(), "")
+	_, err := c.ListTrackings(context.Background(), client.ListTrackingsParams{})
+	expectAPIError(t, err, http.StatusUnauthorized, "unauthorized")
+}
+
+// testMember is the membership of the test user in its organization, it is
+// set by TestIntegrationAPIContract.
+var testMember *data.OrganizationMember
+
+func createTestAPIKey(t *testing.T, scopes ...string) string {
+	key, apiKey, err := data.NewAPIKey(testMember, "test", scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.InsertAPIKey(apiKey); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func insertTestTracking(t *testing.T, domain string) *data.DomainTracking {
+	tracking := &data.DomainTracking{
+		UserID:         testUserID,
+		OrganizationID: testMember.OrganizationID,
+		DomainName:     domain,
+		DomainTrackingInfo: data.DomainTrackingInfo{
+			Status:     data.StatusHealthy,
+			Issuer:     "Let's Encrypt",
+			DNSNames:   domain + ", www." + domain,
+			Expires:    time.Now().AddDate(0, 2, 0),
+			LastPollAt: time.Now(),
+			Latency:    42,
+		},
+	}
+	if err := data.InsertDomainTracking(context.Background(), tracking); err != nil {
+		t.Fatal(err)
+	}
+	return tracking
+}
+
+func TestIntegrationAPIContract(t *testing.T) {
+	dbtest.Setup(t)
+	dbtest.CreateUser(t, testUserID, "test@certpulse.com")
+	member, err := data.CreateOrganization("test", &data.User{ID: testUserID, Email: "test@certpulse.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMember = member
+	var (
+		ctx     = context.Background()
+		app     = newTestApp()
+		c       = newContractClient(t, app, createTestAPIKey(t, data.ScopeRead, data.ScopeWrite))
+		readC   = newContractClient(t, app, createTestAPIKey(t, data.ScopeRead))
+		revoked = createTestAPIKey(t, data.ScopeRead)
+	)
+
+	account, err := c.Account(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Plan != "starter" || account.Trackings != 0 {
+		t.Fatalf("unexpected account %+v", account)
+	}
+
+	foo := insertTestTracking(t, "foo.com")
+	insertTestTracking(t, "bar.com")
+	list, err := c.ListTrackings(ctx, client.ListTrackingsParams{Status: data.StatusHealthy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 2 {
+		t.Fatalf("expected 2 trackings got %d", len(list.Data))
+	}
+	_, err = c.ListTrackings(ctx, client.ListTrackingsParams{Limit: 1000})
+	expectAPIError(t, err, http.StatusBadRequest, "bad_request")
+
+	tracking, err := readC.GetTracking(ctx, foo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking.Domain != "foo.com" || len(tracking.DNSNames) != 2 {
+		t.Fatalf("unexpected tracking %+v", tracking)
+	}
+	_, err = c.GetTracking(ctx, foo.ID+100)
+	expectAPIError(t, err, http.StatusNotFound, "not_found")
+
+	// The starter plan allows 2 trackings.
+	_, err = c.CreateTracking(ctx, client.CreateTrackingParams{Domain: "baz.com"})
+	expectAPIError(t, err, http.StatusForbidden, "plan_limit_reached")
+	_, err = c.CreateTracking(ctx, client.CreateTrackingParams{Domain: "not a domain"})
+	expectAPIError(t, err, http.StatusBadRequest, "bad_request")
+
+	err = readC.DeleteTracking(ctx, foo.ID)
+	expectAPIError(t, err, http.StatusForbidden, "insufficient_scope")
+
+	// Viewers can't write, whatever the scopes of their key.
+	dbtest.CreateUser(t, testViewerID, "viewer@certpulse.com")
+	viewer := &data.OrganizationMember{
+		OrganizationID: testMember.OrganizationID,
+		UserID:         testViewerID,
+		Email:          "viewer@certpulse.com",
+		Role:           data.RoleViewer,
+	}
+	if _, err := db.Bun.NewInsert().Model(viewer).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	key, apiKey, err := data.NewAPIKey(viewer, "viewer", []string{data.ScopeRead, data.ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.InsertAPIKey(apiKey); err != nil {
+		t.Fatal(err)
+	}
+	viewerC := newContractClient(t, app, key)
+	if _, err := viewerC.GetTracking(ctx, foo.ID); err != nil {
+		t.Fatal(err)
+	}
+	err = viewerC.DeleteTracking(ctx, foo.ID)
+	expectAPIError(t, err, http.StatusForbidden, "insufficient_role")
+	if err := c.DeleteTracking(ctx, foo.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetTracking(ctx, foo.ID)
+	if !client.IsNotFound(err) {
+		t.Fatalf("expected deleted tracking to be not found got %v", err)
+	}
+
+	notification := &data.Notification{
+		UserID:         testUserID,
+		OrganizationID: testMember.OrganizationID,
+		Kind:           data.NotificationKindExpires,
+		Channel:        data.ChannelEmail,
+		Target:         "test@certpulse.com",
+		DomainName:     "bar.com",
+		Status:         data.StatusExpires,
+		State:          data.NotificationStateDead,
+		Attempts:       data.MaxNotificationAttempts,
+		NextAttemptAt:  time.Now(),
+	}
+	if _, err := db.Bun.NewInsert().Model(notification).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	notifications, err := c.ListNotifications(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications.Data) != 1 || notifications.Data[0].State != data.NotificationStateDead {
+		t.Fatalf("expected the dead notification got %+v", notifications.Data)
+	}
+	if err := c.RetryNotification(ctx, notification.ID); err != nil {
+		t.Fatal(err)
+	}
+	err = c.RetryNotification(ctx, notification.ID)
+	expectAPIError(t, err, http.StatusNotFound, "not_found")
+
+	if err := data.RevokeAPIKey(fiber.Map{"organization_id": testMember.OrganizationID, "prefix": revoked[:12]}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = newContractClient(t, app, revoked).Account(ctx)
+	expectAPIError(t, err, http.StatusUnauthorized, "unauthorized")
+}
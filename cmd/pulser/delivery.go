@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/metrics"
+	"github.com/anthdm/ssltracker/pkg/notify"
+	"github.com/anthdm/ssltracker/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const deliveryBatchSize = 50
+
+// Deliverer delivers the notifications queued in the outbox by the monitor.
+// Failed deliveries are retried with a backoff until they are dead-lettered.
+type Deliverer struct {
+	interval time.Duration
+	quitch   chan struct{}
+	donech   chan struct{}
+}
+
+func NewDeliverer(interval time.Duration) *Deliverer {
+	return &Deliverer{
+		interval: interval,
+		quitch:   make(chan struct{}),
+		donech:   make(chan struct{}),
+	}
+}
+
+func (d *Deliverer) Start() {
+	defer close(d.donech)
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := d.deliverAll(); err != nil {
+				logger.Log("error", "notification delivery error", "err", err)
+			}
+		case <-d.quitch:
+			logger.Log("msg", "deliverer quitting...")
+			return
+		}
+	}
+}
+
+// Stop blocks until the batch that is being delivered is finished.
+func (d *Deliverer) Stop() {
+	close(d.quitch)
+	<-d.donech
+}
+
+// deliverAll keeps delivering batches until there are no due notifications
+// left in the outbox.
+func (d *Deliverer) deliverAll() error {
+	for {
+		n, err := data.DeliverPendingNotifications(deliveryBatchSize, d.deliver)
+		if err != nil {
+			return err
+		}
+		if n < deliveryBatchSize {
+			return nil
+		}
+		select {
+		case <-d.quitch:
+			return nil
+		default:
+		}
+	}
+}
+
+func (d *Deliverer) deliver(notification *data.Notification) error {
+	notifier, err := notify.NewForChannel(notification.Channel, notification.Target)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(context.Background(), "notify."+notifier.Kind(),
+		attribute.Int64("notification.id", notification.ID),
+		attribute.String("notification.kind", notification.Kind),
+		attribute.Int("notification.attempt", notification.Attempts+1),
+	)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	tracking := notification.TrackingAndAccount()
+	if notification.Kind == data.NotificationKindStatus {
+		err = notifier.NotifyStatus(ctx, tracking)
+	} else {
+		err = notifier.NotifyExpires(ctx, tracking)
+	}
+	tracing.End(span, err)
+	metrics.NotificationsSent.WithLabelValues(notifier.Kind(), metrics.NotificationResult(err)).Inc()
+	if err != nil {
+		logger.Log("error", "notification delivery failed", "id", notification.ID, "kind", notifier.Kind(), "attempt", notification.Attempts+1, "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/notify"
+)
+
+func sendDigests(now time.Time) error {
+	accounts, err := data.GetAllAccounts()
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if !account.DigestDue(now) {
+			continue
+		}
+		trackings, err := data.GetAllOrganizationDomainTrackings(account.OrganizationID)
+		if err != nil {
+			return err
+		}
+		digest := data.BuildDigest(account, trackings, now)
+		if digest.IsEmpty() {
+			continue
+		}
+		// Other pulsers are running the same job, the first one to claim
+		// the digest of the account sends it.
+		previousSentAt := account.DigestSentAt
+		claimed, err := data.ClaimAccountDigest(&account, now)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		notifier := notify.NewEmailNotifier([]string{account.NotifyDefaultEmail})
+		err = notifier.NotifyDigest(ctx, digest)
+		cancel()
+		if err != nil {
+			logger.Log("error", "sending digest failed", "accountID", account.ID, "err", err)
+			// Give the digest back so it will be retried on the next run.
+			account.DigestSentAt = previousSentAt
+			if err := data.UpdateAccountDigestSentAt(&account); err != nil {
+				return err
+			}
+			continue
+		}
+		logger.Log("msg", "digest sent", "accountID", account.ID)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultHealthListenAddr = ":3001"
+
+// HealthServer exposes the liveness (/healthz), readiness (/readyz) and the
+// Prometheus metrics (/metrics) of the pulser over HTTP.
+type HealthServer struct {
+	app          *fiber.App
+	monitor      *Monitor
+	shuttingDown atomic.Bool
+}
+
+func NewHealthServer(m *Monitor) *HealthServer {
+	s := &HealthServer{
+		app:     fiber.New(fiber.Config{DisableStartupMessage: true}),
+		monitor: m,
+	}
+	s.app.Get("/healthz", s.handleHealthz)
+	s.app.Get("/readyz", s.handleReadyz)
+	s.app.Get("/metrics", metrics.Handler())
+	return s
+}
+
+func (s *HealthServer) Listen(addr string) error {
+	return s.app.Listen(addr)
+}
+
+func (s *HealthServer) Shutdown() error {
+	return s.app.ShutdownWithTimeout(time.Second * 5)
+}
+
+// SetShuttingDown makes the pulser report that it is not ready anymore.
+func (s *HealthServer) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+func (s *HealthServer) handleHealthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":   "ok",
+		"id":       s.monitor.id,
+		"lastPoll": s.lastPollOrNil(),
+	})
+}
+
+// handleReadyz reports the pulser as ready when the database is reachable and
+// the monitor completed a poll within the duration of a lease.
+func (s *HealthServer) handleReadyz(c *fiber.Ctx) error {
+	var (
+		lastPoll = s.monitor.LastPoll()
+		problems = []string{}
+	)
+	if s.shuttingDown.Load() {
+		problems = append(problems, "shutting down")
+	}
+	if lastPoll.IsZero() {
+		problems = append(problems, "no successful poll yet")
+	} else if time.Since(lastPoll) > s.monitor.lease {
+		problems = append(problems, "last successful poll is too old")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := db.Bun.PingContext(ctx); err != nil {
+		problems = append(problems, "database unreachable: "+err.Error())
+	}
+
+	status := fiber.StatusOK
+	if len(problems) > 0 {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"ready":    len(problems) == 0,
+		"problems": problems,
+		"lastPoll": s.lastPollOrNil(),
+	})
+}
+
+func (s *HealthServer) lastPollOrNil() any {
+	if lastPoll := s.monitor.LastPoll(); !lastPoll.IsZero() {
+		return lastPoll
+	}
+	return nil
+}
+
+func healthListenAddr() string {
+	if addr := os.Getenv("PULSER_HEALTH_ADDR"); len(addr) > 0 {
+		return addr
+	}
+	return defaultHealthListenAddr
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/metrics"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// digestSchedule checks every hour which accounts are due for their
+	// weekly digest. The actual day and hour are configured per account.
+	digestSchedule = "@hourly"
+	// trackingMetricsSchedule refreshes the tracking gauges.
+	trackingMetricsSchedule = "@every 1m"
+	// historySchedule rolls up the tracking history and applies its retention.
+	historySchedule = "@hourly"
+)
+
+const (
+	// historyPartitionsAhead is the number of days the partitions of the
+	// tracking history are created in advance.
+	historyPartitionsAhead = 7
+	// historyRollupPeriod is how far back the raw history is rolled up on
+	// every run. Hours that were rolled up before are simply recomputed.
+	historyRollupPeriod = time.Hour * 24
+)
+
+// startJobs starts the periodic jobs of the pulser.
+func startJobs() (*cron.Cron, error) {
+	c := cron.New()
+	if _, err := c.AddFunc(digestSchedule, func() {
+		if err := sendDigests(time.Now()); err != nil {
+			logger.Log("error", "sending digests failed", "err", err)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := c.AddFunc(trackingMetricsSchedule, func() {
+		if err := collectTrackingMetrics(time.Now()); err != nil {
+			logger.Log("error", "collecting tracking metrics failed", "err", err)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := c.AddFunc(historySchedule, func() {
+		if err := maintainHistory(time.Now()); err != nil {
+			logger.Log("error", "maintaining tracking history failed", "err", err)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	c.Start()
+	return c, nil
+}
+
+// maintainHistory creates the upcoming partitions of the tracking history,
+// downsamples the raw results to hourly rollups and drops the results that
+// are past their retention.
+func maintainHistory(now time.Time) error {
+	if err := data.EnsureHistoryPartitions(now, historyPartitionsAhead); err != nil {
+		return err
+	}
+	if err := data.RollupTrackingHistory(now.Add(-historyRollupPeriod), now); err != nil {
+		return err
+	}
+	dropped, err := data.DropExpiredHistoryPartitions(now.Add(-data.HistoryRawRetention))
+	if err != nil {
+		return err
+	}
+	if len(dropped) > 0 {
+		logger.Log("msg", "dropped expired tracking history", "partitions", dropped)
+	}
+	return data.DeleteExpiredHistoryRollups(now.Add(-data.HistoryRollupRetention))
+}
+
+func collectTrackingMetrics(now time.Time) error {
+	counts, err := data.CountTrackingsByStatus()
+	if err != nil {
+		return err
+	}
+	metrics.TrackingsByStatus.Reset()
+	for status, count := range counts {
+		metrics.TrackingsByStatus.WithLabelValues(status).Set(float64(count))
+	}
+
+	if !metrics.ExpiryPerTrackingEnabled() {
+		return nil
+	}
+	expiries, err := data.GetTrackingExpiries()
+	if err != nil {
+		return err
+	}
+	// Reset so deleted trackings don't keep being exported.
+	metrics.DaysToExpiry.Reset()
+	for _, tracking := range expiries {
+		if tracking.Expires.IsZero() {
+			continue
+		}
+		days := tracking.Expires.Sub(now).Hours() / 24
+		metrics.DaysToExpiry.WithLabelValues(strconv.FormatInt(tracking.ID, 10), tracking.DomainName).Set(days)
+	}
+	return nil
+}
@@ -2,33 +2,106 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/anthdm/ssltracker/data"
 	"github.com/anthdm/ssltracker/db"
 	"github.com/anthdm/ssltracker/logger"
-	"github.com/anthdm/ssltracker/pkg/notify"
+	"github.com/anthdm/ssltracker/pkg/metrics"
+	"github.com/anthdm/ssltracker/pkg/schedule"
 	"github.com/anthdm/ssltracker/pkg/ssl"
+	"github.com/anthdm/ssltracker/pkg/tracing"
+	"github.com/anthdm/ssltracker/settings"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultLease is how long a pulser owns the trackings it claimed. It should
+// be longer than a poll takes, otherwise other pulsers will reclaim them.
+const defaultLease = time.Minute * 5
+
 type Monitor struct {
+	id       string
 	interval time.Duration
-	lastPoll time.Time
+	lease    time.Duration
 	quitch   chan struct{}
+	donech   chan struct{}
+
+	mu       sync.RWMutex
+	lastPoll time.Time
 }
 
 func NewMonitor(interval time.Duration) *Monitor {
 	return &Monitor{
+		id:       monitorID(),
 		interval: interval,
+		lease:    defaultLease,
 		quitch:   make(chan struct{}),
+		donech:   make(chan struct{}),
 	}
 }
 
-func (m *Monitor) poll() error {
-	trackingsWithAccount, err := data.GetAllTrackingsWithAccount()
+// LastPoll returns the time of the last successful poll.
+func (m *Monitor) LastPoll() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastPoll
+}
+
+func (m *Monitor) setLastPoll(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastPoll = t
+}
+
+// monitorID identifies the pulser instance as the owner of its leases.
+func monitorID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "pulser"
+	}
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), rand.Intn(1_000_000))
+}
+
+// notifyInterval is the minimum time between 2 notifications of the same kind
+// for a single tracking. Suppressed notifications are recorded at most once
+// every suppressInterval.
+const (
+	notifyInterval   = time.Hour * 24
+	suppressInterval = time.Hour
+)
+
+type pollResult struct {
+	tracking      data.DomainTracking
+	notifications []data.Notification
+	suppressed    *data.SuppressedNotification
+}
+
+const (
+	// probeWorkers is the number of probes that run concurrently.
+	probeWorkers = 15
+	probeTimeout = time.Second * 5
+)
+
+// maxDuePerPoll is the maximum number of due trackings claimed per tick. Every
+// due tracking needs at most one probe, its subscribers share it, so even when
+// every probe runs into its timeout the claimed trackings are probed in half
+// of the lease and their leases don't expire while they are polled. The rest
+// will be picked up on the next ticks (or by other pulsers).
+func maxDuePerPoll(lease time.Duration) int {
+	return int(lease/probeTimeout) * probeWorkers / 2
+}
+
+func (m *Monitor) poll(ctx context.Context) error {
+	trackingsWithAccount, err := data.ClaimDueTrackings(m.id, m.lease, time.Now(), maxDuePerPoll(m.lease))
 	if err != nil {
 		return err
 	}
@@ -36,108 +109,321 @@ func (m *Monitor) poll() error {
 		logger.Log("msg", "nothing to pulse yet...")
 		return nil
 	}
+	observePollLag(trackingsWithAccount, time.Now())
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("trackings", len(trackingsWithAccount)))
+	windows, err := data.GetAllMaintenanceWindows()
+	if err != nil {
+		return err
+	}
+	routes, err := data.GetAllNotificationRoutes()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	recent, err := data.GetRecentNotificationKeys(now.Add(-notifyInterval), now.Add(-suppressInterval))
+	if err != nil {
+		return err
+	}
+
+	static, probed := splitStatic(trackingsWithAccount)
+	targets, err := data.GetProbeTargets(probeTargetIDs(probed))
+	if err != nil {
+		return err
+	}
+	groups := groupByProbeTarget(probed, targets)
 
 	var (
-		workers = make(chan struct{}, 15)
+		workers = make(chan struct{}, probeWorkers)
 		wg      = sync.WaitGroup{}
-		results = make(chan data.DomainTracking, len(trackingsWithAccount))
+		results = make(chan pollResult, len(trackingsWithAccount))
+		skipped = make(chan int64, len(trackingsWithAccount))
 	)
-	for _, trackingWithAccount := range trackingsWithAccount {
+	// Static trackings have nothing to probe, only their expiry is checked.
+	for _, tracking := range static {
+		tracking.DomainTracking = checkStaticExpiry(tracking, now)
+		result := pollResult{tracking: tracking.DomainTracking}
+		m.maybeNotify(tracking, windows[tracking.DomainTracking.OrganizationID], routes[tracking.DomainTracking.OrganizationID], recent, &result)
+		results <- result
+	}
+	for _, group := range groups {
 		wg.Add(1)
-		go func(tracking data.TrackingAndAccount) {
-			workers <- struct{}{}
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		go func(group probeGroup) {
+			// When the monitor is stopping we finish the probes that are in
+			// flight but don't start new ones.
+			select {
+			case workers <- struct{}{}:
+			case <-m.quitch:
+				for _, tracking := range group.trackings {
+					skipped <- tracking.DomainTracking.ID
+				}
+				wg.Done()
+				return
+			}
+			ctx, span := tracing.Start(ctx, "pulser.probe",
+				attribute.String("domain", group.target.Host),
+				attribute.String("address", group.target.Address()),
+				attribute.Int("subscribers", len(group.trackings)),
+			)
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
 			defer func() {
 				<-workers
 				wg.Done()
 				cancel()
+				span.End()
 			}()
 
-			domainName := tracking.DomainName
-			info, err := ssl.PollDomain(ctx, domainName)
+			start := time.Now()
+			info, err := ssl.PollTarget(ctx, group.target)
 			if err != nil {
+				span.RecordError(err)
+				metrics.ProbeDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
 				logger.Log("err", err)
 				return
 			}
+			metrics.ProbeDuration.WithLabelValues(info.Status).Observe(time.Since(start).Seconds())
 
-			domainTracking := tracking.DomainTracking
-			domainTracking.DomainTrackingInfo = *info
-			m.maybeNotify(context.Background(), tracking)
-
-			results <- domainTracking
-		}(trackingWithAccount)
+			// Fan the result of the probe out to every subscribed tracking.
+			// Notifications are still decided per tracking, since every
+			// account has its own settings.
+			for _, tracking := range group.trackings {
+				tracking.DomainTracking = applyProbeResult(tracking, *info)
+				result := pollResult{tracking: tracking.DomainTracking}
+				m.maybeNotify(tracking, windows[tracking.DomainTracking.OrganizationID], routes[tracking.DomainTracking.OrganizationID], recent, &result)
+				results <- result
+			}
+		}(group)
 	}
 
 	wg.Wait()
 	close(results)
+	close(skipped)
+	if err := m.releaseSkipped(skipped); err != nil {
+		logger.Log("error", "releasing leases failed", "err", err)
+	}
 	return m.processResults(results)
 }
 
-func (m *Monitor) maybeNotify(ctx context.Context, tracking data.TrackingAndAccount) error {
+// splitStatic separates the static trackings from the trackings that need
+// to be probed.
+func splitStatic(trackings []data.TrackingAndAccount) (static []data.TrackingAndAccount, probed []data.TrackingAndAccount) {
+	for _, tracking := range trackings {
+		if tracking.Static {
+			static = append(static, tracking)
+		} else {
+			probed = append(probed, tracking)
+		}
+	}
+	return static, probed
+}
+
+// staticCheckInterval is how often the expiry of static trackings is checked.
+// Checking them is cheap, the interval only bounds how late a status change
+// is noticed.
+const staticCheckInterval = time.Hour
+
+// checkStaticExpiry returns the static tracking with its status evaluated at
+// now and scheduled for its next check.
+func checkStaticExpiry(tracking data.TrackingAndAccount, now time.Time) data.DomainTracking {
+	domainTracking := tracking.DomainTracking
+	domainTracking.ApplyPollResult(ssl.CheckExpiry(domainTracking.DomainTrackingInfo, now))
+	domainTracking.NextPollAt = now.Add(staticCheckInterval)
+	return domainTracking
+}
+
+// probeGroup is a probe target and the claimed trackings subscribed to it.
+type probeGroup struct {
+	target    data.ProbeTarget
+	trackings []data.TrackingAndAccount
+}
+
+func probeTargetIDs(trackings []data.TrackingAndAccount) []int64 {
+	ids := []int64{}
+	seen := map[int64]bool{}
+	for _, tracking := range trackings {
+		id := tracking.ProbeTargetID
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// groupByProbeTarget groups the trackings by the endpoint they poll, so that
+// endpoint only needs to be probed once. Trackings that are not subscribed to
+// a probe target yet poll the default target of their domain.
+func groupByProbeTarget(trackings []data.TrackingAndAccount, targets map[int64]data.ProbeTarget) []probeGroup {
+	var (
+		groups = []probeGroup{}
+		index  = map[data.ProbeTarget]int{}
+	)
+	for _, tracking := range trackings {
+		target, ok := targets[tracking.ProbeTargetID]
+		if !ok {
+			target = data.DefaultProbeTarget(tracking.DomainName)
+		}
+		key := target
+		key.ID = 0
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, probeGroup{target: target})
+		}
+		groups[i].trackings = append(groups[i].trackings, tracking)
+	}
+	return groups
+}
+
+// applyProbeResult returns the tracking updated with the probed info and
+// scheduled for its next poll.
+func applyProbeResult(tracking data.TrackingAndAccount, info data.DomainTrackingInfo) data.DomainTracking {
+	domainTracking := tracking.DomainTracking
+	domainTracking.ApplyPollResult(info)
+	domainTracking.NextPollAt = schedule.NextPoll(info, domainTracking.PollFailures, pollInterval(tracking), time.Now())
+	return domainTracking
+}
+
+// releaseSkipped gives the trackings that were claimed but not polled back so
+// other pulsers can pick them up right away.
+func (m *Monitor) releaseSkipped(skippedch chan int64) error {
+	ids := make([]int64, 0, len(skippedch))
+	for id := range skippedch {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		logger.Log("msg", "releasing skipped trackings", "count", len(ids))
+	}
+	return data.ReleaseLeases(m.id, ids)
+}
+
+// maybeNotify decides whether the polled tracking needs to notify its owner.
+// The notifications are not sent from here, they are queued in the outbox
+// together with the poll results and delivered by the delivery worker.
+func (m *Monitor) maybeNotify(tracking data.TrackingAndAccount, windows []data.MaintenanceWindow, routes []data.NotificationRoute, recent map[data.NotificationKey]bool, result *pollResult) {
 	var (
 		expires       = tracking.Expires
 		notifyUpfront = time.Hour * 24 * time.Duration(tracking.NotifyUpfront)
-		account       = tracking.Account
+		kind          string
 	)
-	notifiers := []notify.Notifier{
-		notify.NewEmailNotifier([]string{account.NotifyDefaultEmail}),
+	switch {
+	case tracking.Status != data.StatusHealthy && tracking.Status != data.StatusExpires:
+		kind = data.NotificationKindStatus
+	case time.Until(expires) <= notifyUpfront:
+		kind = data.NotificationKindExpires
+	default:
+		return
 	}
-	if len(account.SlackAccessToken) > 0 {
-		notifiers = append(notifiers, notify.NewSlackNotifier(account.SlackWebhookURL))
+	if recent[data.NotificationKey{DomainTrackingID: tracking.DomainTracking.ID, Kind: kind}] {
+		return
 	}
 
-	for _, notifier := range notifiers {
-		if tracking.Status != data.StatusHealthy && tracking.Status != data.StatusExpires {
-			c, cancel := context.WithTimeout(ctx, time.Second*2)
-			defer cancel()
-			if err := notifier.NotifyStatus(c, tracking); err != nil {
-				logger.Log("error", err)
-			}
-		} else if time.Until(expires) <= notifyUpfront {
-			c, cancel := context.WithTimeout(ctx, time.Second*2)
-			defer cancel()
-			if err := notifier.NotifyExpires(c, tracking); err != nil {
-				logger.Log("error", err)
-			}
+	if reason := data.SuppressReason(tracking, windows, kind, time.Now()); len(reason) > 0 {
+		logger.Log("msg", "notification suppressed", "tracking", tracking.DomainTracking.ID, "kind", kind, "reason", reason)
+		result.suppressed = &data.SuppressedNotification{
+			UserID:           tracking.DomainTracking.UserID,
+			OrganizationID:   tracking.DomainTracking.OrganizationID,
+			DomainTrackingID: tracking.DomainTracking.ID,
+			Kind:             kind,
+			Reason:           reason,
 		}
+		return
 	}
 
-	return nil
+	for _, target := range data.NotificationTargets(tracking, routes) {
+		result.notifications = append(result.notifications, data.Notification{
+			UserID:           tracking.DomainTracking.UserID,
+			OrganizationID:   tracking.DomainTracking.OrganizationID,
+			DomainTrackingID: tracking.DomainTracking.ID,
+			Kind:             kind,
+			Channel:          target.Channel,
+			Target:           target.Target,
+			DomainName:       tracking.DomainName,
+			Status:           tracking.Status,
+			Expires:          tracking.Expires,
+			State:            data.NotificationStatePending,
+			NextAttemptAt:    time.Now(),
+		})
+	}
 }
 
-func (m *Monitor) processResults(resultsch chan data.DomainTracking) error {
+// observePollLag records how late the most overdue of the claimed trackings is
+// being polled. A growing lag means the pulsers can't keep up.
+func observePollLag(trackings []data.TrackingAndAccount, now time.Time) {
+	var lag time.Duration
+	for _, tracking := range trackings {
+		if late := now.Sub(tracking.NextPollAt); late > lag {
+			lag = late
+		}
+	}
+	metrics.PollLag.Set(lag.Seconds())
+}
+
+// pollInterval returns the interval configured for the tracking. Trackings can
+// be polled less often than the plan allows, but not more often.
+func pollInterval(tracking data.TrackingAndAccount) time.Duration {
+	interval := settings.Account[tracking.Plan].PollInterval
+	custom := time.Second * time.Duration(tracking.PollIntervalSeconds)
+	if custom > interval {
+		return custom
+	}
+	return interval
+}
+
+func (m *Monitor) processResults(resultsch chan pollResult) error {
 	var (
-		trackings = make([]data.DomainTracking, len(resultsch))
-		i         int
+		trackings     = make([]data.DomainTracking, 0, len(resultsch))
+		notifications = []data.Notification{}
+		suppressed    = []data.SuppressedNotification{}
 	)
 	for result := range resultsch {
-		trackings[i] = result
-		i++
+		trackings = append(trackings, result.tracking)
+		notifications = append(notifications, result.notifications...)
+		if result.suppressed != nil {
+			suppressed = append(suppressed, *result.suppressed)
+		}
 	}
-	return data.UpdateAllTrackings(trackings)
+	return data.SavePollResults(m.id, trackings, notifications, suppressed)
 }
 
 func (m *Monitor) Start() {
+	defer close(m.donech)
 	t := time.NewTicker(m.interval)
-	if err := m.poll(); err != nil {
-		log.Fatal(err)
-	}
+	defer t.Stop()
+	m.pollOnce()
 	for {
 		select {
-		case t := <-t.C:
-			start := time.Now()
-			logger.Log("msg", "new poll", "time", t)
-			if err := m.poll(); err != nil {
-				logger.Log("error", "monitor poll error", "err", err)
-			}
-			logger.Log("msg", "poll complete", "took", time.Since(start))
+		case <-t.C:
+			m.pollOnce()
 		case <-m.quitch:
-			logger.Log("msg", "monitor quitting...", "lastPoll", m.lastPoll)
+			logger.Log("msg", "monitor quitting...", "lastPoll", m.LastPoll())
 			return
 		}
 	}
 }
 
+func (m *Monitor) pollOnce() {
+	start := time.Now()
+	logger.Log("msg", "new poll", "time", start)
+	ctx, span := tracing.Start(context.Background(), "pulser.poll", attribute.String("pulser.id", m.id))
+	err := m.poll(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Log("error", "monitor poll error", "err", err)
+		return
+	}
+	m.setLastPoll(time.Now())
+	metrics.PollDuration.Observe(time.Since(start).Seconds())
+	logger.Log("msg", "poll complete", "took", time.Since(start))
+}
+
+// Stop stops the monitor from claiming new work and blocks until the probes
+// in flight are finished and their results are saved.
+func (m *Monitor) Stop() {
+	close(m.quitch)
+	<-m.donech
+}
+
 func main() {
 	if err := godotenv.Load(".env"); err != nil {
 		log.Fatal(err)
@@ -145,6 +431,48 @@ func main() {
 	db.Init()
 	logger.Init()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(ctx, "ssltracker-pulser")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Make sure the history of the polls can be stored before polling.
+	if err := data.EnsureHistoryPartitions(time.Now(), historyPartitionsAhead); err != nil {
+		log.Fatal(err)
+	}
+	jobs, err := startJobs()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d := NewDeliverer(time.Second * 5)
+	go d.Start()
+
 	m := NewMonitor(time.Second * 10)
-	m.Start()
+	logger.Log("msg", "starting pulser", "id", m.id)
+	go m.Start()
+
+	health := NewHealthServer(m)
+	go func() {
+		if err := health.Listen(healthListenAddr()); err != nil {
+			logger.Log("error", "health server failed", "err", err)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Log("msg", "shutting down pulser...")
+	health.SetShuttingDown()
+	m.Stop()
+	d.Stop()
+	<-jobs.Stop().Done()
+	if err := health.Shutdown(); err != nil {
+		logger.Log("error", "health server shutdown failed", "err", err)
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Log("error", "flushing traces failed", "err", err)
+	}
+	logger.Log("msg", "pulser stopped", "lastPoll", m.LastPoll())
 }
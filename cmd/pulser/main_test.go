@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+func trackingWithTarget(id, targetID int64, domain string) data.TrackingAndAccount {
+	return data.TrackingAndAccount{
+		DomainTracking: data.DomainTracking{
+			ID:            id,
+			DomainName:    domain,
+			ProbeTargetID: targetID,
+		},
+	}
+}
+
+func TestGroupByProbeTarget(t *testing.T) {
+	targets := map[int64]data.ProbeTarget{
+		1: {ID: 1, Host: "foo.com", Port: 443, SNI: "foo.com"},
+		2: {ID: 2, Host: "foo.com", Port: 8443, SNI: "foo.com"},
+	}
+	trackings := []data.TrackingAndAccount{
+		trackingWithTarget(1, 1, "foo.com"),
+		trackingWithTarget(2, 2, "foo.com"),
+		trackingWithTarget(3, 1, "foo.com"),
+		// Not subscribed yet, polls the default target of its domain.
+		trackingWithTarget(4, 0, "foo.com"),
+		trackingWithTarget(5, 0, "bar.com"),
+	}
+	groups := groupByProbeTarget(trackings, targets)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 probe groups got %d", len(groups))
+	}
+	expected := []struct {
+		address string
+		ids     []int64
+	}{
+		{"foo.com:443", []int64{1, 3, 4}},
+		{"foo.com:8443", []int64{2}},
+		{"bar.com:443", []int64{5}},
+	}
+	for i, group := range groups {
+		if group.target.Address() != expected[i].address {
+			t.Fatalf("expected group %d to probe %s got %s", i, expected[i].address, group.target.Address())
+		}
+		if len(group.trackings) != len(expected[i].ids) {
+			t.Fatalf("expected group %d to have %d trackings got %d", i, len(expected[i].ids), len(group.trackings))
+		}
+		for j, tracking := range group.trackings {
+			if tracking.DomainTracking.ID != expected[i].ids[j] {
+				t.Fatalf("expected tracking %d in group %d got %d", expected[i].ids[j], i, tracking.DomainTracking.ID)
+			}
+		}
+	}
+}
+
+func TestCheckStaticExpiry(t *testing.T) {
+	var (
+		now      = time.Now()
+		tracking = trackingWithTarget(1, 0, "internal.example.com")
+	)
+	tracking.Static = true
+	tracking.Status = data.StatusHealthy
+	tracking.Expires = now.Add(-time.Minute)
+	static, probed := splitStatic([]data.TrackingAndAccount{tracking, trackingWithTarget(2, 1, "foo.com")})
+	if len(static) != 1 || len(probed) != 1 {
+		t.Fatalf("expected 1 static and 1 probed tracking got %d and %d", len(static), len(probed))
+	}
+
+	checked := checkStaticExpiry(static[0], now)
+	if checked.Status != data.StatusExpired || !checked.StatusChangedAt.Equal(now) {
+		t.Fatalf("expected the static tracking to change to %s got %s", data.StatusExpired, checked.Status)
+	}
+	if !checked.NextPollAt.Equal(now.Add(staticCheckInterval)) {
+		t.Fatalf("expected the next check in %s got %s", staticCheckInterval, checked.NextPollAt.Sub(now))
+	}
+}
+
+func TestMaxDuePerPoll(t *testing.T) {
+	limit := maxDuePerPoll(defaultLease)
+	if limit <= 0 {
+		t.Fatalf("expected to claim trackings got limit %d", limit)
+	}
+	// The worst case is every probe of the claim running into its timeout.
+	worst := time.Duration((limit+probeWorkers-1)/probeWorkers) * probeTimeout
+	if worst >= defaultLease {
+		t.Fatalf("expected %d probes to finish within the lease of %s, they take up to %s", limit, defaultLease, worst)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/ssl"
+)
+
+type checkResult struct {
+	Target   string                 `json:"target"`
+	SNI      string                 `json:"sni"`
+	Status   string                 `json:"status"`
+	DaysLeft int                    `json:"days_left"`
+	Error    string                 `json:"error,omitempty"`
+	Issuer   string                 `json:"issuer,omitempty"`
+	Expires  time.Time              `json:"expires"`
+	DNSNames []string               `json:"dns_names"`
+	ServerIP string                 `json:"server_ip,omitempty"`
+	Latency  int                    `json:"latency_ms"`
+	Chain    []ssl.ChainCertificate `json:"chain"`
+}
+
+func runCheck(args []string, out io.Writer) (int, error) {
+	var (
+		fs       = flag.NewFlagSet("check", flag.ContinueOnError)
+		sni      = fs.String("sni", "", "server name to send, defaults to the host")
+		asJSON   = fs.Bool("json", false, "print the result as JSON")
+		warnDays = fs.Int("warn-days", 14, "exit with 2 when the certificate expires within this many days")
+		timeout  = fs.Duration("timeout", time.Second*10, "timeout of the check")
+		options  = fs.String("options", "", "protocol options, tls1.2 or tls1.3 to require a minimum TLS version")
+	)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError, err
+	}
+	if len(positional) != 1 {
+		return exitError, fmt.Errorf("expected a single host[:port] to check")
+	}
+	target, err := parseTarget(positional[0], *sni)
+	if err != nil {
+		return exitError, err
+	}
+	target.Options = *options
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	inspection, err := ssl.Inspect(ctx, target)
+	if err != nil {
+		return exitError, err
+	}
+	result := newCheckResult(inspection, time.Now())
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return exitError, err
+		}
+	} else {
+		printCheckResult(out, result)
+	}
+	return checkExitCode(result, *warnDays), nil
+}
+
+// parseTarget parses a host with an optional port (example.com:8443) into the
+// probe target to check.
+func parseTarget(s, sni string) (data.ProbeTarget, error) {
+	host, port := s, data.DefaultProbePort
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 || n > 65535 {
+			return data.ProbeTarget{}, fmt.Errorf("invalid port %q", p)
+		}
+		host, port = h, n
+	}
+	if len(host) == 0 {
+		return data.ProbeTarget{}, fmt.Errorf("invalid host %q", s)
+	}
+	if len(sni) == 0 {
+		sni = host
+	}
+	return data.ProbeTarget{Host: host, Port: port, SNI: sni}, nil
+}
+
+func newCheckResult(inspection *ssl.Inspection, now time.Time) checkResult {
+	info := inspection.Info
+	result := checkResult{
+		Target:   inspection.Target.Address(),
+		SNI:      inspection.Target.SNI,
+		Status:   info.Status,
+		Error:    info.Error,
+		Issuer:   info.Issuer,
+		Expires:  info.Expires,
+		DNSNames: []string{},
+		ServerIP: info.ServerIP,
+		Latency:  info.Latency,
+		Chain:    inspection.Chain,
+	}
+	if result.Chain == nil {
+		result.Chain = []ssl.ChainCertificate{}
+	}
+	if len(info.DNSNames) > 0 {
+		result.DNSNames = strings.Split(info.DNSNames, ", ")
+	}
+	// Invalid certificates are not returned, take the expiry from the chain.
+	if result.Expires.IsZero() && len(inspection.Chain) > 0 {
+		result.Expires = inspection.Chain[0].NotAfter
+	}
+	if !result.Expires.IsZero() {
+		result.DaysLeft = int(result.Expires.Sub(now) / (time.Hour * 24))
+	}
+	return result
+}
+
+func checkExitCode(result checkResult, warnDays int) int {
+	switch result.Status {
+	case data.StatusHealthy, data.StatusExpires:
+		if result.DaysLeft < warnDays {
+			return exitExpiring
+		}
+		return exitOK
+	case data.StatusExpired, data.StatusInvalid:
+		return exitInvalid
+	default:
+		return exitUnreachable
+	}
+}
+
+func printCheckResult(out io.Writer, result checkResult) {
+	fmt.Fprintf(out, "%s (SNI %s)\n", result.Target, result.SNI)
+	fmt.Fprintf(out, "  status:    %s\n", result.Status)
+	if len(result.Error) > 0 {
+		fmt.Fprintf(out, "  error:     %s\n", result.Error)
+	}
+	if !result.Expires.IsZero() {
+		fmt.Fprintf(out, "  expires:   %s (%d days)\n", result.Expires.Format(time.DateTime), result.DaysLeft)
+	}
+	if len(result.Issuer) > 0 {
+		fmt.Fprintf(out, "  issuer:    %s\n", result.Issuer)
+	}
+	if len(result.DNSNames) > 0 {
+		fmt.Fprintf(out, "  dns names: %s\n", strings.Join(result.DNSNames, ", "))
+	}
+	if len(result.ServerIP) > 0 {
+		fmt.Fprintf(out, "  server ip: %s\n", result.ServerIP)
+	}
+	fmt.Fprintf(out, "  latency:   %dms\n", result.Latency)
+	if len(result.Chain) > 0 {
+		fmt.Fprintln(out, "  chain:")
+		for i, cert := range result.Chain {
+			fmt.Fprintf(out, "    %d: %s\n", i, cert.Subject)
+			fmt.Fprintf(out, "       issuer:  %s\n", cert.Issuer)
+			fmt.Fprintf(out, "       expires: %s\n", cert.NotAfter.Format(time.DateTime))
+			fmt.Fprintf(out, "       sha256:  %s\n", cert.SHA256Fingerprint)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		input string
+		sni   string
+		addr  string
+		want  string
+	}{
+		{"example.com", "", "example.com:443", "example.com"},
+		{"example.com:8443", "foo", "example.com:8443", "foo"},
+		{"[::1]:8443", "", "[::1]:8443", "::1"},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.input, test.sni)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target.Address() != test.addr || target.SNI != test.want {
+			t.Fatalf("expected %s with SNI %s got %s with SNI %s", test.addr, test.want, target.Address(), target.SNI)
+		}
+	}
+	if _, err := parseTarget("example.com:99999", ""); err == nil {
+		t.Fatal("expected error for invalid port")
+	}
+}
+
+func TestCheckExitCode(t *testing.T) {
+	tests := []struct {
+		status   string
+		daysLeft int
+		code     int
+	}{
+		{data.StatusHealthy, 60, exitOK},
+		{data.StatusHealthy, 10, exitExpiring},
+		{data.StatusExpires, 3, exitExpiring},
+		{data.StatusExpired, -1, exitInvalid},
+		{data.StatusInvalid, 60, exitInvalid},
+		{data.StatusOffline, 0, exitUnreachable},
+		{data.StatusUnresponsive, 0, exitUnreachable},
+	}
+	for _, test := range tests {
+		result := checkResult{Status: test.status, DaysLeft: test.daysLeft, Expires: time.Now()}
+		if code := checkExitCode(result, 14); code != test.code {
+			t.Fatalf("expected exit code %d for %s with %d days left got %d", test.code, test.status, test.daysLeft, code)
+		}
+	}
+}
+
+func TestParseArgsInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	sni := fs.String("sni", "", "")
+	asJSON := fs.Bool("json", false, "")
+	positional, err := parseArgs(fs, []string{"example.com:8443", "--sni", "foo", "--json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positional) != 1 || positional[0] != "example.com:8443" || *sni != "foo" || !*asJSON {
+		t.Fatalf("unexpected parse result %v sni=%s json=%t", positional, *sni, *asJSON)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes of the CLI. They allow CI pipelines to gate on the state of a
+// certificate.
+const (
+	exitOK = iota
+	exitError
+	exitExpiring
+	exitInvalid
+	exitUnreachable
+)
+
+const usage = `Usage: ssltracker <command> [flags]
+
+Commands:
+  check   host[:port]   check the certificate of a host locally
+  add     domain        start tracking a domain
+  list                  list your trackings
+  remove  id            stop tracking a domain
+
+The add, list and remove commands use the CertPulse API. Create an API key
+on your account page and set CERTPULSE_API_KEY (or use --api-key).
+
+Exit codes of check:
+  0  the certificate is healthy
+  1  the check could not be run
+  2  the certificate expires within --warn-days
+  3  the certificate is expired or invalid
+  4  the host is offline or unresponsive
+
+Run ssltracker <command> -h for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	var cmd func([]string, io.Writer) (int, error)
+	switch args[0] {
+	case "check":
+		cmd = runCheck
+	case "add":
+		cmd = runAdd
+	case "list":
+		cmd = runList
+	case "remove":
+		cmd = runRemove
+	case "-h", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+	code, err := cmd(args[1:], stdout)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(stderr, "ssltracker %s: %s\n", args[0], err)
+		}
+		return exitError
+	}
+	return code
+}
+
+// parseArgs parses the flags of a command that can appear both before and
+// after its positional arguments, as in "check example.com --json".
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anthdm/ssltracker/pkg/client"
+)
+
+type apiFlags struct {
+	apiKey  *string
+	baseURL *string
+}
+
+func newAPIFlags(fs *flag.FlagSet) apiFlags {
+	baseURL := os.Getenv("CERTPULSE_URL")
+	if len(baseURL) == 0 {
+		baseURL = client.DefaultBaseURL
+	}
+	return apiFlags{
+		apiKey:  fs.String("api-key", os.Getenv("CERTPULSE_API_KEY"), "API key, defaults to $CERTPULSE_API_KEY"),
+		baseURL: fs.String("url", baseURL, "URL of CertPulse, defaults to $CERTPULSE_URL"),
+	}
+}
+
+func (f apiFlags) client() (*client.Client, error) {
+	if len(*f.apiKey) == 0 {
+		return nil, fmt.Errorf("missing API key, set CERTPULSE_API_KEY or use --api-key")
+	}
+	return client.New(*f.baseURL, *f.apiKey), nil
+}
+
+func runAdd(args []string, out io.Writer) (int, error) {
+	var (
+		fs     = flag.NewFlagSet("add", flag.ContinueOnError)
+		api    = newAPIFlags(fs)
+		asJSON = fs.Bool("json", false, "print the tracking as JSON")
+	)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError, err
+	}
+	if len(positional) != 1 {
+		return exitError, fmt.Errorf("expected a single domain to add")
+	}
+	c, err := api.client()
+	if err != nil {
+		return exitError, err
+	}
+	tracking, err := c.CreateTracking(context.Background(), client.CreateTrackingParams{Domain: positional[0]})
+	if err != nil {
+		return exitError, err
+	}
+	if *asJSON {
+		return exitOK, printJSON(out, tracking)
+	}
+	printTrackings(out, []client.Tracking{*tracking})
+	return exitOK, nil
+}
+
+func runList(args []string, out io.Writer) (int, error) {
+	var (
+		fs     = flag.NewFlagSet("list", flag.ContinueOnError)
+		api    = newAPIFlags(fs)
+		asJSON = fs.Bool("json", false, "print the trackings as JSON")
+		status = fs.String("status", "", "only list trackings with this status")
+		limit  = fs.Int("limit", 100, "maximum number of trackings to list")
+		page   = fs.Int("page", 0, "page of trackings to list")
+	)
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError, err
+	}
+	c, err := api.client()
+	if err != nil {
+		return exitError, err
+	}
+	list, err := c.ListTrackings(context.Background(), client.ListTrackingsParams{
+		Status: *status,
+		Limit:  *limit,
+		Page:   *page,
+	})
+	if err != nil {
+		return exitError, err
+	}
+	if *asJSON {
+		return exitOK, printJSON(out, list.Data)
+	}
+	printTrackings(out, list.Data)
+	return exitOK, nil
+}
+
+func runRemove(args []string, out io.Writer) (int, error) {
+	var (
+		fs  = flag.NewFlagSet("remove", flag.ContinueOnError)
+		api = newAPIFlags(fs)
+	)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError, err
+	}
+	if len(positional) != 1 {
+		return exitError, fmt.Errorf("expected the id of the tracking to remove")
+	}
+	id, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil {
+		return exitError, fmt.Errorf("invalid tracking id %q", positional[0])
+	}
+	c, err := api.client()
+	if err != nil {
+		return exitError, err
+	}
+	if err := c.DeleteTracking(context.Background(), id); err != nil {
+		return exitError, err
+	}
+	fmt.Fprintf(out, "removed tracking %d\n", id)
+	return exitOK, nil
+}
+
+func printJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printTrackings(out io.Writer, trackings []client.Tracking) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDOMAIN\tSTATUS\tEXPIRES\tISSUER\tLAST POLL")
+	for _, t := range trackings {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			t.ID, t.Domain, t.Status, t.Expires.Format(time.DateOnly), t.Issuer, t.LastPollAt.Format(time.DateTime))
+	}
+	w.Flush()
+}
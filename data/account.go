@@ -2,11 +2,10 @@ package data
 
 import (
 	"context"
+	"time"
 
 	"github.com/anthdm/ssltracker/db"
-	"github.com/anthdm/ssltracker/logger"
 	"github.com/gofiber/fiber/v2"
-	"github.com/nedpals/supabase-go"
 	"github.com/uptrace/bun"
 )
 
@@ -34,6 +33,7 @@ const (
 type Account struct {
 	ID                   int64 `bun:",pk,autoincrement"`
 	UserID               string
+	OrganizationID       int64
 	StripeCustomerID     string
 	StripeSubscriptionID string
 	SubscriptionStatus   string
@@ -44,14 +44,22 @@ type Account struct {
 	SlackAccessToken     string
 	SlackChannelID       string
 	SlackWebhookURL      string
+	Timezone             string
+	QuietHoursStart      string
+	QuietHoursEnd        string
+	DigestEnabled        bool
+	DigestWeekday        int
+	DigestHour           int
+	DigestSentAt         time.Time `bun:",nullzero"`
 }
 
-func GetUserAccount(userID string) (*Account, error) {
+// GetOrganizationAccount returns the account of the organization, which
+// holds its plan, billing and notification settings.
+func GetOrganizationAccount(ctx context.Context, organizationID int64) (*Account, error) {
 	account := new(Account)
-	ctx := context.Background()
 	err := db.Bun.NewSelect().
 		Model(account).
-		Where("user_id = ?", userID).
+		Where("organization_id = ?", organizationID).
 		Scan(ctx)
 	return account, err
 }
@@ -73,21 +81,3 @@ func UpdateAccount(acc *Account) error {
 		Exec(context.Background())
 	return err
 }
-
-func CreateAccountForUserIfNotExist(user *supabase.User) (*Account, error) {
-	if acc, err := GetUserAccount(user.ID); err == nil {
-		return acc, nil
-	}
-	acc := Account{
-		UserID:             user.ID,
-		NotifyUpfront:      7,
-		NotifyDefaultEmail: user.Email,
-		Plan:               PlanStarter,
-	}
-	_, err := db.Bun.NewInsert().Model(&acc).Exec(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	logger.Log("event", "new account signup", "id", acc.ID)
-	return &acc, nil
-}
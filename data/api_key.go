@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// ScopeRead allows reading the account and its trackings.
+	ScopeRead = "read"
+	// ScopeWrite allows creating, deleting and rechecking trackings.
+	ScopeWrite = "write"
+)
+
+var APIKeyScopes = []string{ScopeRead, ScopeWrite}
+
+const (
+	apiKeyPrefix    = "ssl_"
+	apiKeyPrefixLen = len(apiKeyPrefix) + 8
+
+	apiKeyLastUsedResolution = time.Minute
+)
+
+// APIKey authenticates requests to the public API on behalf of the
+// organization, with at most the role of the member that created it.
+// Only the hash of the key is stored, the key itself is shown once when it
+// is created.
+type APIKey struct {
+	ID             int64 `bun:"id,pk,autoincrement"`
+	UserID         string
+	OrganizationID int64
+	Name           string
+	Prefix         string
+	KeyHash        string
+	Scopes         []string  `bun:",array"`
+	CreatedAt      time.Time `bun:",nullzero,default:now()"`
+	LastUsedAt     time.Time `bun:",nullzero"`
+	RevokedAt      time.Time `bun:",nullzero"`
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// NewAPIKey generates a new key of the member. It returns the key that should
+// be handed to the member together with the APIKey to store.
+func NewAPIKey(member *OrganizationMember, name string, scopes []string) (string, *APIKey, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+	apiKey := &APIKey{
+		UserID:         member.UserID,
+		OrganizationID: member.OrganizationID,
+		Name:           name,
+		Prefix:         key[:apiKeyPrefixLen],
+		KeyHash:        HashAPIKey(key),
+		Scopes:         scopes,
+	}
+	return key, apiKey, nil
+}
+
+// HashAPIKey hashes the key for storage and lookup. The keys are random with
+// enough entropy, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func InsertAPIKey(apiKey *APIKey) error {
+	_, err := db.Bun.NewInsert().Model(apiKey).Exec(context.Background())
+	return err
+}
+
+func GetOrganizationAPIKeys(organizationID int64) ([]APIKey, error) {
+	var apiKeys []APIKey
+	err := db.Bun.NewSelect().
+		Model(&apiKeys).
+		Where("organization_id = ?", organizationID).
+		Order("created_at DESC").
+		Scan(context.Background())
+	return apiKeys, err
+}
+
+// GetActiveAPIKey returns the key that is not revoked with the given (plain) key.
+func GetActiveAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	apiKey := new(APIKey)
+	err := db.Bun.NewSelect().
+		Model(apiKey).
+		Where("key_hash = ?", HashAPIKey(key)).
+		Where("revoked_at IS NULL").
+		Limit(1).
+		Scan(ctx)
+	return apiKey, err
+}
+
+// UpdateAPIKeyLastUsedAt records when the key was used. It is only written
+// when the stored time is older than apiKeyLastUsedResolution, so busy keys
+// don't write on every request.
+func UpdateAPIKeyLastUsedAt(ctx context.Context, apiKey *APIKey, now time.Time) error {
+	if now.Sub(apiKey.LastUsedAt) < apiKeyLastUsedResolution {
+		return nil
+	}
+	apiKey.LastUsedAt = now
+	_, err := db.Bun.NewUpdate().
+		Model(apiKey).
+		Column("last_used_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+func RevokeAPIKey(query fiber.Map) error {
+	builder := db.Bun.NewUpdate().
+		Model(&APIKey{}).
+		Set("revoked_at = ?", time.Now()).
+		Where("revoked_at IS NULL").
+		QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.UpdateQuery).Exec(context.Background())
+	return err
+}
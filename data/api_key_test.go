@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	member := &OrganizationMember{OrganizationID: 1, UserID: "user", Role: RoleAdmin}
+	key, apiKey, err := NewAPIKey(member, "ci", []string{ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiKey.OrganizationID != 1 || apiKey.UserID != "user" {
+		t.Fatalf("expected the key to belong to the organization of the member got %+v", apiKey)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || !strings.HasPrefix(key, apiKey.Prefix) {
+		t.Fatalf("expected key %s to start with prefix %s", key, apiKey.Prefix)
+	}
+	if strings.Contains(apiKey.KeyHash, key) || apiKey.KeyHash != HashAPIKey(key) {
+		t.Fatal("expected only the hash of the key to be stored")
+	}
+	other, _, err := NewAPIKey(member, "ci", []string{ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Fatal("expected keys to be unique")
+	}
+	if !apiKey.HasScope(ScopeRead) || apiKey.HasScope(ScopeWrite) {
+		t.Fatalf("expected key to only have the read scope got %v", apiKey.Scopes)
+	}
+}
+
+func TestUpdateAPIKeyLastUsedAtThrottled(t *testing.T) {
+	var (
+		now    = time.Now()
+		used   = now.Add(-apiKeyLastUsedResolution / 2)
+		apiKey = &APIKey{ID: 1, LastUsedAt: used}
+	)
+	// The key was used recently, so the database is not touched.
+	if err := UpdateAPIKeyLastUsedAt(context.Background(), apiKey, now); err != nil {
+		t.Fatal(err)
+	}
+	if !apiKey.LastUsedAt.Equal(used) {
+		t.Fatalf("expected the last used time to be kept got %s", apiKey.LastUsedAt)
+	}
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/anthdm/ssltracker/db"
+)
+
+// NewBadgeToken generates a random token that can't be guessed from the
+// tracking it belongs to.
+func NewBadgeToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SetTrackingBadgeToken replaces the badge token of the tracking of the
+// organization, which revokes the previous badge. An empty token removes the
+// badge.
+func SetTrackingBadgeToken(organizationID int64, id int64, token string) error {
+	res, err := db.Bun.NewUpdate().
+		Model((*DomainTracking)(nil)).
+		Set("badge_token = NULLIF(?, '')", token).
+		Where("organization_id = ?", organizationID).
+		Where("id = ?", id).
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func GetTrackingByBadgeToken(token string) (*DomainTracking, error) {
+	tracking := new(DomainTracking)
+	err := db.Bun.NewSelect().
+		Model(tracking).
+		Where("badge_token = ?", token).
+		Scan(context.Background())
+	return tracking, err
+}
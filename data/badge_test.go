@@ -0,0 +1,43 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIntegrationBadgeToken(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 1)
+
+	tracking, err := GetDomainTracking(context.Background(), fiber.Map{"organization_id": testOrganizationID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := NewBadgeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTrackingBadgeToken(testOrganizationID+1, tracking.ID, token); err == nil {
+		t.Fatal("expected the tracking of another organization not to be found")
+	}
+	if err := SetTrackingBadgeToken(testOrganizationID, tracking.ID, token); err != nil {
+		t.Fatal(err)
+	}
+	found, err := GetTrackingByBadgeToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != tracking.ID {
+		t.Fatalf("expected tracking %d got %d", tracking.ID, found.ID)
+	}
+
+	if err := SetTrackingBadgeToken(testOrganizationID, tracking.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetTrackingByBadgeToken(token); err == nil || !util.IsErrNoRecords(err) {
+		t.Fatalf("expected the revoked token not to be found got %v", err)
+	}
+}
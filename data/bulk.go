@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/uptrace/bun"
+)
+
+// Actions that can be applied to several trackings at once.
+const (
+	BulkDelete   = "delete"
+	BulkRecheck  = "recheck"
+	BulkTag      = "tag"
+	BulkUntag    = "untag"
+	BulkSnooze   = "snooze"
+	BulkUnsnooze = "unsnooze"
+	BulkMute     = "mute"
+	BulkUnmute   = "unmute"
+)
+
+var BulkActions = []string{
+	BulkDelete,
+	BulkRecheck,
+	BulkTag,
+	BulkUntag,
+	BulkSnooze,
+	BulkUnsnooze,
+	BulkMute,
+	BulkUnmute,
+}
+
+// ErrTrackingNotFound is returned when some of the trackings of a bulk action
+// don't exist or belong to another user.
+var ErrTrackingNotFound = errors.New("tracking not found")
+
+// ErrTooManyTags is returned when a bulk tag would give some of the trackings
+// more than MaxTrackingTags tags.
+var ErrTooManyTags = fmt.Errorf("a tracking can have at most %d tags", MaxTrackingTags)
+
+// BulkAction is an action on the selected trackings. Tag is only used to tag
+// and untag, SnoozedUntil only to snooze.
+type BulkAction struct {
+	Action       string
+	Tag          string
+	SnoozedUntil time.Time
+}
+
+// ApplyBulkAction applies the action to all trackings with the given ids in a
+// single transaction. Nothing is changed unless every tracking belongs to the
+// organization. Rechecks only schedule the trackings to be polled right away, the
+// pulser picks them up on its next tick.
+func ApplyBulkAction(organizationID int64, ids []int64, action BulkAction) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockOrganizationTrackings(ctx, tx, organizationID, ids); err != nil {
+			return err
+		}
+		update := tx.NewUpdate().
+			Model((*DomainTracking)(nil)).
+			Where("id IN (?)", bun.In(ids))
+		switch action.Action {
+		case BulkDelete:
+			_, err := tx.NewDelete().
+				Model((*DomainTracking)(nil)).
+				Where("id IN (?)", bun.In(ids)).
+				Exec(ctx)
+			return err
+		case BulkTag:
+			if err := checkTrackingTagLimit(ctx, tx, ids, action.Tag); err != nil {
+				return err
+			}
+			return addTrackingTags(ctx, tx, organizationID, ids, []string{action.Tag})
+		case BulkUntag:
+			return removeTrackingTags(ctx, tx, organizationID, ids, []string{action.Tag})
+		case BulkRecheck:
+			update.Set("next_poll_at = now()")
+		case BulkSnooze:
+			update.Set("snoozed_until = ?", action.SnoozedUntil)
+		case BulkUnsnooze:
+			update.Set("snoozed_until = NULL")
+		case BulkMute:
+			update.Set("muted = true")
+		case BulkUnmute:
+			update.Set("muted = false")
+		default:
+			return errors.New("unknown bulk action " + action.Action)
+		}
+		_, err := update.Exec(ctx)
+		return err
+	})
+	if err != nil && err != ErrTrackingNotFound && err != ErrTooManyTags {
+		logger.Log("error", "rollback transaction", "query", "applyBulkAction", "action", action.Action, "err", err)
+	}
+	return err
+}
+
+// checkTrackingTagLimit returns ErrTooManyTags when any of the trackings
+// already has MaxTrackingTags tags without the tag. The trackings have to be
+// locked so no tags are added in between.
+func checkTrackingTagLimit(ctx context.Context, tx bun.Tx, ids []int64, tag string) error {
+	var full []int64
+	err := tx.NewRaw(`
+		SELECT dtt.domain_tracking_id FROM domain_tracking_tags AS dtt
+		INNER JOIN tags AS t ON t.id = dtt.tag_id
+		WHERE dtt.domain_tracking_id IN (?)
+		GROUP BY dtt.domain_tracking_id
+		HAVING count(*) >= ? AND NOT bool_or(t.name = ?)
+		LIMIT 1`, bun.In(ids), MaxTrackingTags, tag).
+		Scan(ctx, &full)
+	if err != nil {
+		return err
+	}
+	if len(full) > 0 {
+		return ErrTooManyTags
+	}
+	return nil
+}
+
+// lockOrganizationTrackings locks the trackings with the given ids for the
+// rest of the transaction, or returns ErrTrackingNotFound when any of them
+// doesn't belong to the organization.
+func lockOrganizationTrackings(ctx context.Context, tx bun.Tx, organizationID int64, ids []int64) error {
+	var owned []int64
+	err := tx.NewSelect().
+		Model((*DomainTracking)(nil)).
+		Column("id").
+		Where("organization_id = ?", organizationID).
+		Where("id IN (?)", bun.In(ids)).
+		For("UPDATE").
+		Scan(ctx, &owned)
+	if err != nil {
+		return err
+	}
+	unique := map[int64]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(ids) == 0 || len(owned) != len(unique) {
+		return ErrTrackingNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIntegrationApplyBulkAction(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 3)
+
+	trackings, err := GetDomainTrackings(context.Background(), fiber.Map{"organization_id": testOrganizationID}, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int64{trackings[0].ID, trackings[1].ID}
+
+	// A single id of another organization rejects the whole action.
+	err = ApplyBulkAction(testOrganizationID, append(ids, 999999), BulkAction{Action: BulkMute})
+	if err != ErrTrackingNotFound {
+		t.Fatalf("expected %s got %v", ErrTrackingNotFound, err)
+	}
+	err = ApplyBulkAction(testOrganizationID+1, ids, BulkAction{Action: BulkDelete})
+	if err != ErrTrackingNotFound {
+		t.Fatalf("expected %s got %v", ErrTrackingNotFound, err)
+	}
+
+	until := time.Now().AddDate(0, 0, 7)
+	for _, action := range []BulkAction{
+		{Action: BulkMute},
+		{Action: BulkSnooze, SnoozedUntil: until},
+	} {
+		if err := ApplyBulkAction(testOrganizationID, ids, action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	muted, err := GetDomainTracking(context.Background(), fiber.Map{"id": ids[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !muted.Muted || !muted.IsSnoozed(time.Now()) {
+		t.Fatalf("expected the tracking to be muted and snoozed got %+v", muted)
+	}
+
+	if err := ApplyBulkAction(testOrganizationID, ids, BulkAction{Action: BulkDelete}); err != nil {
+		t.Fatal(err)
+	}
+	count, err := CountOrganizationDomainTrackings(context.Background(), testOrganizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 tracking to be left got %d", count)
+	}
+}
+
+func TestIntegrationBulkTagMaxTrackingTags(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 2)
+
+	trackings, err := GetDomainTrackings(context.Background(), fiber.Map{"organization_id": testOrganizationID}, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int64{trackings[0].ID, trackings[1].ID}
+	tags := make([]string, MaxTrackingTags)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag-%d", i)
+	}
+	if err := UpdateTrackingLabels(testOrganizationID, ids[0], tags, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tags the tracking already has don't count towards the limit.
+	if err := ApplyBulkAction(testOrganizationID, ids, BulkAction{Action: BulkTag, Tag: tags[0]}); err != nil {
+		t.Fatal(err)
+	}
+	err = ApplyBulkAction(testOrganizationID, ids, BulkAction{Action: BulkTag, Tag: "extra"})
+	if err != ErrTooManyTags {
+		t.Fatalf("expected %s got %v", ErrTooManyTags, err)
+	}
+	trackingTags, err := GetTrackingTags(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trackingTags[ids[0]]) != MaxTrackingTags || len(trackingTags[ids[1]]) != 1 {
+		t.Fatalf("expected the rejected tag not to be added to any tracking got %+v", trackingTags)
+	}
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+)
+
+const (
+	digestPeriod      = time.Hour * 24 * 7
+	digestResendAfter = digestPeriod - time.Hour*24
+)
+
+// Digest is the weekly summary of the certificate estate of an account.
+type Digest struct {
+	Account      Account
+	GeneratedAt  time.Time
+	Total        int
+	StatusCounts map[string]int
+	Expiring30   []DomainTracking
+	Expiring60   []DomainTracking
+	Expiring90   []DomainTracking
+	NewlyFailing []DomainTracking
+	Renewed      []DomainTracking
+}
+
+func (d Digest) IsEmpty() bool {
+	return d.Total == 0
+}
+
+// DigestDue returns true if the weekly digest of the account should be sent
+// at the given time. Digests that were missed at the configured hour (pulser
+// was down) will still be sent later that same day.
+func (a Account) DigestDue(now time.Time) bool {
+	if !a.DigestEnabled {
+		return false
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	if int(local.Weekday()) != a.DigestWeekday || local.Hour() < a.DigestHour {
+		return false
+	}
+	// Make sure we dont send the same digest twice.
+	return now.Sub(a.DigestSentAt) > digestResendAfter
+}
+
+// BuildDigest summarizes the given trackings of the account.
+func BuildDigest(account Account, trackings []DomainTracking, now time.Time) Digest {
+	digest := Digest{
+		Account:      account,
+		GeneratedAt:  now,
+		Total:        len(trackings),
+		StatusCounts: make(map[string]int),
+	}
+	since := now.Add(-digestPeriod)
+	for _, tracking := range trackings {
+		digest.StatusCounts[tracking.Status]++
+
+		if !tracking.Expires.IsZero() && tracking.Expires.After(now) {
+			daysLeft := tracking.Expires.Sub(now) / (time.Hour * 24)
+			switch {
+			case daysLeft < 30:
+				digest.Expiring30 = append(digest.Expiring30, tracking)
+			case daysLeft < 60:
+				digest.Expiring60 = append(digest.Expiring60, tracking)
+			case daysLeft < 90:
+				digest.Expiring90 = append(digest.Expiring90, tracking)
+			}
+		}
+		isFailing := tracking.Status != StatusHealthy && tracking.Status != StatusExpires
+		if isFailing && tracking.StatusChangedAt.After(since) {
+			digest.NewlyFailing = append(digest.NewlyFailing, tracking)
+		}
+		if tracking.RenewedAt.After(since) {
+			digest.Renewed = append(digest.Renewed, tracking)
+		}
+	}
+	return digest
+}
+
+func GetAllAccounts() ([]Account, error) {
+	var accounts []Account
+	err := db.Bun.NewSelect().Model(&accounts).Scan(context.Background())
+	return accounts, err
+}
+
+func UpdateAccountDigestSentAt(acc *Account) error {
+	_, err := db.Bun.NewUpdate().
+		Model(acc).
+		Column("digest_sent_at").
+		WherePK().
+		Exec(context.Background())
+	return err
+}
+
+// ClaimAccountDigest marks the digest of the account as sent, unless another
+// pulser already did. It returns false if the digest was claimed by someone else.
+func ClaimAccountDigest(acc *Account, now time.Time) (bool, error) {
+	res, err := db.Bun.NewUpdate().
+		Model(acc).
+		Set("digest_sent_at = ?", now).
+		WherePK().
+		Where("digest_sent_at IS NULL OR digest_sent_at < ?", now.Add(-digestResendAfter)).
+		Exec(context.Background())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	acc.DigestSentAt = now
+	return n == 1, nil
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildDigest(t *testing.T) {
+	var (
+		now       = time.Date(2023, 7, 10, 8, 0, 0, 0, time.UTC)
+		trackings = []DomainTracking{
+			{DomainName: "a.com", DomainTrackingInfo: DomainTrackingInfo{Status: StatusExpires, Expires: now.AddDate(0, 0, 10)}},
+			{DomainName: "b.com", DomainTrackingInfo: DomainTrackingInfo{Status: StatusHealthy, Expires: now.AddDate(0, 0, 45)}},
+			{DomainName: "c.com", DomainTrackingInfo: DomainTrackingInfo{Status: StatusHealthy, Expires: now.AddDate(0, 0, 80)}, RenewedAt: now.AddDate(0, 0, -2)},
+			{DomainName: "d.com", DomainTrackingInfo: DomainTrackingInfo{Status: StatusOffline}, StatusChangedAt: now.AddDate(0, 0, -1)},
+			{DomainName: "e.com", DomainTrackingInfo: DomainTrackingInfo{Status: StatusInvalid}, StatusChangedAt: now.AddDate(0, 0, -30)},
+		}
+	)
+	digest := BuildDigest(Account{}, trackings, now)
+	if digest.Total != 5 {
+		t.Fatalf("expected 5 trackings got %d", digest.Total)
+	}
+	if len(digest.Expiring30) != 1 || len(digest.Expiring60) != 1 || len(digest.Expiring90) != 1 {
+		t.Fatalf("expected 1 tracking in each expiry bucket got %d %d %d", len(digest.Expiring30), len(digest.Expiring60), len(digest.Expiring90))
+	}
+	if len(digest.NewlyFailing) != 1 || digest.NewlyFailing[0].DomainName != "d.com" {
+		t.Fatalf("expected d.com to be newly failing got %v", digest.NewlyFailing)
+	}
+	if len(digest.Renewed) != 1 || digest.Renewed[0].DomainName != "c.com" {
+		t.Fatalf("expected c.com to be renewed got %v", digest.Renewed)
+	}
+	if digest.StatusCounts[StatusHealthy] != 2 {
+		t.Fatalf("expected 2 healthy trackings got %d", digest.StatusCounts[StatusHealthy])
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	account := Account{
+		Timezone:      "UTC",
+		DigestEnabled: true,
+		DigestWeekday: int(time.Monday),
+		DigestHour:    8,
+	}
+	// 2023-07-10 is a Monday.
+	monday := time.Date(2023, 7, 10, 8, 0, 0, 0, time.UTC)
+	if !account.DigestDue(monday) {
+		t.Fatal("expected digest to be due on monday 08:00")
+	}
+	if account.DigestDue(monday.Add(-time.Hour)) {
+		t.Fatal("expected digest not to be due before 08:00")
+	}
+	account.DigestSentAt = monday
+	if account.DigestDue(monday.Add(time.Hour)) {
+		t.Fatal("expected digest not to be sent twice")
+	}
+	if !account.DigestDue(monday.AddDate(0, 0, 7)) {
+		t.Fatal("expected digest to be due the next week")
+	}
+}
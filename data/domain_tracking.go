@@ -2,11 +2,12 @@ package data
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/anthdm/ssltracker/db"
 	"github.com/anthdm/ssltracker/logger"
-	"github.com/anthdm/ssltracker/util"
 	"github.com/gofiber/fiber/v2"
 	"github.com/uptrace/bun"
 )
@@ -35,90 +36,370 @@ type DomainTrackingInfo struct {
 }
 
 type DomainTracking struct {
-	ID         int64 `bun:"id,pk,autoincrement"`
-	UserID     string
-	DomainName string
+	ID     int64 `bun:"id,pk,autoincrement"`
+	UserID string
+	// OrganizationID is the organization that owns the tracking, UserID the
+	// member that created it.
+	OrganizationID int64
+	DomainName     string
+	SnoozedUntil   time.Time `bun:",nullzero"`
+	// Muted trackings are still polled but never notify.
+	Muted bool
+	// StatusChangedAt and RenewedAt are maintained by the pulser and are
+	// used to report status changes and renewals in the weekly digest.
+	StatusChangedAt time.Time `bun:",nullzero"`
+	RenewedAt       time.Time `bun:",nullzero"`
+	// NextPollAt is scheduled by the pulser after each poll. A zero
+	// PollIntervalSeconds means the default interval of the plan is used.
+	NextPollAt          time.Time `bun:",nullzero,default:now()"`
+	PollIntervalSeconds int       `bun:",nullzero"`
+	PollFailures        int
+	// The pulser that is currently polling the tracking holds a lease on
+	// it until LeaseExpiresAt.
+	LeaseOwner     string    `bun:",nullzero"`
+	LeaseExpiresAt time.Time `bun:",nullzero"`
+	// ProbeTargetID is the shared endpoint the tracking is subscribed to.
+	ProbeTargetID int64 `bun:",nullzero"`
+	// Static trackings are created from an uploaded certificate instead of
+	// a probe target. They are never polled, their status only follows the
+	// expiry of the certificate.
+	Static bool
+	Notes  string
+	// BadgeToken publishes the status badge of the tracking at
+	// /badge/<token>.svg. Trackings without a token have no badge.
+	BadgeToken string `bun:",nullzero"`
+	// Project and Environment optionally group the trackings of an
+	// organization.
+	Project     string `bun:",nullzero"`
+	Environment string `bun:",nullzero"`
+	// Tags are stored in the tags table, they are only set on trackings
+	// that were loaded with their tags.
+	Tags []string `bun:"-"`
 
 	DomainTrackingInfo
 }
 
-func CountUserDomainTrackings(userID string) (int, error) {
+func CountOrganizationDomainTrackings(ctx context.Context, organizationID int64) (int, error) {
 	return db.Bun.NewSelect().
 		Model(&DomainTracking{}).
-		Where("user_id = ?", userID).
-		Count(context.Background())
+		Where("organization_id = ?", organizationID).
+		Count(ctx)
 }
 
-func GetDomainTrackings(filter fiber.Map, limit int, page int) ([]DomainTracking, error) {
-	if limit == 0 {
-		limit = defaultLimit
+func CountTrackingsByStatus() (map[string]int, error) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	err := db.Bun.NewSelect().
+		Model((*DomainTracking)(nil)).
+		ColumnExpr("status, count(*) AS count").
+		Group("status").
+		Scan(context.Background(), &rows)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
 	}
+	return counts, nil
+}
+
+// GetTrackingExpiries returns the id, domain name and expiry of all trackings.
+func GetTrackingExpiries() ([]DomainTracking, error) {
 	var trackings []DomainTracking
-	builder := db.Bun.NewSelect().Model(&trackings).Limit(limit)
+	err := db.Bun.NewSelect().
+		Model(&trackings).
+		Column("id", "domain_name", "expires").
+		Scan(context.Background())
+	return trackings, err
+}
+
+// Keys of a tracking filter that are not columns. FilterTag matches the
+// trackings with the tag, FilterSearch the trackings with the text in their
+// domain name, issuer or SANs.
+const (
+	FilterTag    = "tag"
+	FilterSearch = "search"
+)
+
+// TrackingSorts are the orders trackings can be listed in. A leading "-"
+// reverses the order.
+var TrackingSorts = []string{
+	"domain",
+	"expires",
+	"-expires",
+	"status",
+	"latency",
+	"-latency",
+	"last_poll",
+	"-last_poll",
+}
+
+var trackingSortColumns = map[string]string{
+	"domain":  "domain_name",
+	"expires": "expires",
+	// Sorting on status puts the most severe statuses first.
+	"status": `CASE status
+		WHEN 'expired' THEN 0
+		WHEN 'invalid' THEN 1
+		WHEN 'offline' THEN 2
+		WHEN 'unresponsive' THEN 3
+		WHEN 'expires' THEN 4
+		ELSE 5 END`,
+	"latency":   "latency",
+	"last_poll": "last_poll_at",
+}
+
+func IsValidTrackingSort(sort string) bool {
+	for _, s := range TrackingSorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// whereTrackingFilter adds the conditions of the filter to the select of
+// trackings. Empty values are ignored.
+func whereTrackingFilter(q *bun.SelectQuery, filter fiber.Map) *bun.SelectQuery {
 	for k, v := range filter {
-		if v != "" {
-			builder.Where("? = ?", bun.Ident(k), v)
+		if v == "" {
+			continue
+		}
+		switch k {
+		case FilterTag:
+			q.Where(`id IN (
+				SELECT dtt.domain_tracking_id FROM domain_tracking_tags AS dtt
+				INNER JOIN tags AS t ON t.id = dtt.tag_id
+				WHERE t.name = ?)`, v)
+		case FilterSearch:
+			pattern := "%" + likeEscaper.Replace(fmt.Sprint(v)) + "%"
+			q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.
+					Where("domain_name ILIKE ?", pattern).
+					WhereOr("issuer ILIKE ?", pattern).
+					WhereOr("dns_names ILIKE ?", pattern)
+			})
+		default:
+			q.Where("? = ?", bun.Ident(k), v)
 		}
 	}
-	offset := (limit - 1) * page
-	builder.Offset(offset)
-	err := builder.Scan(context.Background())
+	return q
+}
+
+// orderTrackings orders the select of trackings by one of the TrackingSorts.
+// The id breaks ties, so pages stay stable.
+func orderTrackings(q *bun.SelectQuery, sort string) *bun.SelectQuery {
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		sort = sort[1:]
+		direction = "DESC"
+	}
+	column, ok := trackingSortColumns[sort]
+	if !ok {
+		column = trackingSortColumns["domain"]
+	}
+	return q.OrderExpr(column + " " + direction).OrderExpr("id " + direction)
+}
+
+// GetDomainTrackings returns a page of the trackings matching the filter in
+// the given sort order. Pages start at 0.
+func GetDomainTrackings(ctx context.Context, filter fiber.Map, sort string, limit int, page int) ([]DomainTracking, error) {
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if page < 0 {
+		page = 0
+	}
+	var trackings []DomainTracking
+	builder := whereTrackingFilter(db.Bun.NewSelect().Model(&trackings), filter)
+	err := orderTrackings(builder, sort).
+		Limit(limit).
+		Offset(limit * page).
+		Scan(ctx)
 	return trackings, err
 }
 
-func GetDomainTracking(query fiber.Map) (*DomainTracking, error) {
+// CountDomainTrackings returns the number of trackings matching the filter.
+func CountDomainTrackings(ctx context.Context, filter fiber.Map) (int, error) {
+	return whereTrackingFilter(db.Bun.NewSelect().Model((*DomainTracking)(nil)), filter).
+		Count(ctx)
+}
+
+// EachDomainTracking calls fn with the trackings matching the query, with their
+// tags, in batches of batchSize ordered by id, so all trackings of an
+// organization can be streamed without loading them at once.
+func EachDomainTracking(query fiber.Map, batchSize int, fn func([]DomainTracking) error) error {
 	var (
-		tracking = new(DomainTracking)
-		ctx      = context.Background()
+		ctx    = context.Background()
+		lastID int64
 	)
+	for {
+		var trackings []DomainTracking
+		err := whereTrackingFilter(db.Bun.NewSelect().Model(&trackings), query).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(batchSize).
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if len(trackings) == 0 {
+			return nil
+		}
+		if err := LoadTrackingTags(ctx, trackings); err != nil {
+			return err
+		}
+		if err := fn(trackings); err != nil {
+			return err
+		}
+		if len(trackings) < batchSize {
+			return nil
+		}
+		lastID = trackings[len(trackings)-1].ID
+	}
+}
+
+func GetAllOrganizationDomainTrackings(organizationID int64) ([]DomainTracking, error) {
+	var trackings []DomainTracking
+	err := db.Bun.NewSelect().
+		Model(&trackings).
+		Where("organization_id = ?", organizationID).
+		Order("expires").
+		Scan(context.Background())
+	return trackings, err
+}
+
+func GetDomainTracking(ctx context.Context, query fiber.Map) (*DomainTracking, error) {
+	tracking := new(DomainTracking)
 	builder := db.Bun.NewSelect().Model(tracking).QueryBuilder()
 	builder = db.WhereMap(builder, query)
 	err := builder.Unwrap().(*bun.SelectQuery).Limit(1).Scan(ctx)
 	return tracking, err
 }
 
-func DeleteDomainTracking(query fiber.Map) error {
+func DeleteDomainTracking(ctx context.Context, query fiber.Map) error {
 	builder := db.Bun.NewDelete().Model(&DomainTracking{}).QueryBuilder()
 	builder = db.WhereMap(builder, query)
-	_, err := builder.Unwrap().(*bun.DeleteQuery).Exec(context.Background())
+	_, err := builder.Unwrap().(*bun.DeleteQuery).Exec(ctx)
 	return err
 }
 
-func InsertDomainTracking(tracking *DomainTracking) error {
-	_, err := db.Bun.NewInsert().Model(tracking).Exec(context.Background())
+// InsertDomainTracking inserts the tracking and subscribes it to the probe
+// target of its domain, unless it already has a probe target or is static.
+func InsertDomainTracking(ctx context.Context, tracking *DomainTracking) error {
+	if tracking.ProbeTargetID == 0 && !tracking.Static {
+		id, err := upsertProbeTarget(ctx, db.Bun, DefaultProbeTarget(tracking.DomainName))
+		if err != nil {
+			return err
+		}
+		tracking.ProbeTargetID = id
+	}
+	_, err := db.Bun.NewInsert().Model(tracking).Exec(ctx)
 	return err
 }
 
-func CreateDomainTrackings(trackings []*DomainTracking) (err error) {
-	tx, err := db.Bun.Begin()
+// CreateDomainTrackings inserts the trackings in a single transaction, each
+// subscribed to the probe target at the same index of targets. Trackings with
+// a name the organization already tracks are skipped. The tags of the trackings are
+// created as well.
+func CreateDomainTrackings(trackings []*DomainTracking, targets []ProbeTarget) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for i, tracking := range trackings {
+			exists, err := tx.NewSelect().
+				Model((*DomainTracking)(nil)).
+				Where("organization_id = ?", tracking.OrganizationID).
+				Where("domain_name = ?", tracking.DomainName).
+				Exists(ctx)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			id, err := upsertProbeTarget(ctx, tx, targets[i])
+			if err != nil {
+				return err
+			}
+			tracking.ProbeTargetID = id
+			if _, err := tx.NewInsert().Model(tracking).Exec(ctx); err != nil {
+				return err
+			}
+			if err := addTrackingTags(ctx, tx, tracking.OrganizationID, []int64{tracking.ID}, tracking.Tags); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		logger.Log("error", "rollback transaction", "query", "createDomainTrackings", "err", err)
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-			logger.Log("error", "rollback transaction", "query", "createDomainTrackings", "err", err)
-		}
-	}()
+	return err
+}
 
-	for _, tracking := range trackings {
-		// Check if already exist. If so, skip.
-		query := fiber.Map{
-			"domain_name": tracking.DomainName,
-			"user_id":     tracking.UserID,
+// GetOrganizationTrackingNames returns the domain names the organization is
+// tracking.
+func GetOrganizationTrackingNames(organizationID int64) (map[string]bool, error) {
+	var names []string
+	err := db.Bun.NewSelect().
+		Model((*DomainTracking)(nil)).
+		Column("domain_name").
+		Where("organization_id = ?", organizationID).
+		Scan(context.Background(), &names)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	return m, nil
+}
+
+// RecordChanges compares the freshly polled info of the tracking with the
+// previous one and keeps track of when the status changed or the certificate
+// got renewed.
+func (t *DomainTracking) RecordChanges(previous DomainTrackingInfo) {
+	if previous.Status != t.Status {
+		t.StatusChangedAt = t.LastPollAt
+	}
+	if !previous.Expires.IsZero() && t.Expires.After(previous.Expires) {
+		t.RenewedAt = t.LastPollAt
+	}
+}
+
+// ApplyPollResult updates the tracking with the freshly polled info and keeps
+// track of the changes and the consecutive poll failures.
+func (t *DomainTracking) ApplyPollResult(info DomainTrackingInfo) {
+	previous := t.DomainTrackingInfo
+	t.DomainTrackingInfo = info
+	t.RecordChanges(previous)
+	if len(info.Error) > 0 {
+		t.PollFailures++
+	} else {
+		t.PollFailures = 0
+	}
+}
+
+// SavePollResult updates the tracking that was polled outside of the pulser,
+// appends the result to its history and publishes it as a tracking event.
+func SavePollResult(tracking DomainTracking) error {
+	ctx := context.Background()
+	return db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := updateAllTrackings(ctx, tx, []DomainTracking{tracking}); err != nil {
+			return err
 		}
-		_, err = GetDomainTracking(query)
-		if err != nil {
-			if util.IsErrNoRecords(err) {
-				if err := InsertDomainTracking(tracking); err != nil {
-					return err
-				}
-			} else {
-				logger.Log("error", err)
-			}
+		if err := insertTrackingHistory(ctx, tx, []TrackingHistory{NewTrackingHistory(tracking)}); err != nil {
+			return err
 		}
-	}
-	return tx.Commit()
+		return publishTrackingEvents(ctx, tx, []DomainTracking{tracking})
+	})
 }
 
 type TrackingAndAccount struct {
@@ -131,18 +412,37 @@ func GetAllTrackingsWithAccount() ([]TrackingAndAccount, error) {
 		trackings []TrackingAndAccount
 		ctx       = context.Background()
 	)
-	err := db.Bun.NewSelect().
+	err := selectTrackingsWithAccount(db.Bun.NewSelect()).Scan(ctx, &trackings)
+	return trackings, err
+}
+
+func selectTrackingsWithAccount(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.
 		ColumnExpr("dt.*").
-		ColumnExpr("a.notify_upfront, a.slack_access_token, a.slack_webhook_url").
+		ColumnExpr("a.plan, a.notify_upfront, a.notify_default_email, a.notify_webhook_url, a.slack_access_token, a.slack_webhook_url").
+		ColumnExpr("a.timezone, a.quiet_hours_start, a.quiet_hours_end").
 		TableExpr("domain_trackings as dt").
 		Join("INNER JOIN accounts AS a").
-		JoinOn("a.user_id = dt.user_id").
-		Scan(ctx, &trackings)
-	return trackings, err
+		JoinOn("a.organization_id = dt.organization_id")
+}
+
+func UpdateDomainTrackingPollInterval(query fiber.Map, seconds int) error {
+	builder := db.Bun.NewUpdate().
+		Model(&DomainTracking{}).
+		Set("poll_interval_seconds = NULLIF(?, 0)", seconds).
+		Set("next_poll_at = now()").
+		QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.UpdateQuery).Exec(context.Background())
+	return err
 }
 
 func UpdateAllTrackings(trackings []DomainTracking) error {
-	_, err := db.Bun.NewUpdate().
+	return updateAllTrackings(context.Background(), db.Bun, trackings)
+}
+
+func updateAllTrackings(ctx context.Context, idb bun.IDB, trackings []DomainTracking) error {
+	_, err := idb.NewUpdate().
 		Model(&trackings).
 		Column(
 			"issuer",
@@ -160,8 +460,12 @@ func UpdateAllTrackings(trackings []DomainTracking) error {
 			"ext_key_usages",
 			"encoded_pem",
 			"server_ip",
+			"status_changed_at",
+			"renewed_at",
+			"next_poll_at",
+			"poll_failures",
 		).
 		Bulk().
-		Exec(context.Background())
+		Exec(ctx)
 	return err
 }
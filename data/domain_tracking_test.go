@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIntegrationCreateDomainTrackings(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 1)
+
+	newTracking := func(name string) *DomainTracking {
+		return &DomainTracking{
+			UserID:         testUserID,
+			OrganizationID: testOrganizationID,
+			DomainName:     name,
+			Tags:           []string{"prod"},
+			DomainTrackingInfo: DomainTrackingInfo{
+				Status:     StatusOffline,
+				Error:      "connection refused",
+				LastPollAt: time.Now(),
+			},
+		}
+	}
+	trackings := []*DomainTracking{
+		newTracking("domain.com"),
+		newTracking("foo.com:8443"),
+	}
+	targets := []ProbeTarget{
+		DefaultProbeTarget("domain.com"),
+		{Host: "foo.com", Port: 8443, SNI: "api.foo.com"},
+	}
+	if err := CreateDomainTrackings(trackings, targets); err != nil {
+		t.Fatal(err)
+	}
+	names, err := GetOrganizationTrackingNames(testOrganizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || !names["foo.com:8443"] {
+		t.Fatalf("expected the existing domain to be skipped got %v", names)
+	}
+	foo, err := GetDomainTracking(context.Background(), fiber.Map{"id": trackings[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := probeTargetOrFail(t, foo.ProbeTargetID)
+	if target.SNI != "api.foo.com" || target.Port != 8443 {
+		t.Fatalf("unexpected tracking %+v subscribed to %+v", foo, target)
+	}
+	tags, err := GetTrackingTags(context.Background(), []int64{foo.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags[foo.ID]) != 1 || tags[foo.ID][0] != "prod" {
+		t.Fatalf("expected the tracking to be tagged prod got %v", tags[foo.ID])
+	}
+}
+
+func probeTargetOrFail(t *testing.T, id int64) ProbeTarget {
+	targets, err := GetProbeTargets([]int64{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return targets[id]
+}
+
+func TestIntegrationEachDomainTracking(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 5)
+
+	var (
+		ids     []int64
+		batches int
+	)
+	err := EachDomainTracking(fiber.Map{"organization_id": testOrganizationID}, 2, func(trackings []DomainTracking) error {
+		batches++
+		for _, tracking := range trackings {
+			ids = append(ids, tracking.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 5 || batches != 3 {
+		t.Fatalf("expected 5 trackings in 3 batches got %d in %d", len(ids), batches)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("expected trackings ordered by id got %v", ids)
+		}
+	}
+}
+
+func TestIntegrationGetDomainTrackings(t *testing.T) {
+	setupIntegrationDB(t)
+	now := time.Now()
+	for i, name := range []string{"a.com", "b.com", "c.com", "d_.com", "e.com"} {
+		tracking := &DomainTracking{
+			UserID:         testUserID,
+			OrganizationID: testOrganizationID,
+			DomainName:     name,
+			DomainTrackingInfo: DomainTrackingInfo{
+				Status:   StatusHealthy,
+				Issuer:   "Let's Encrypt",
+				DNSNames: name + ", www." + name,
+				Expires:  now.AddDate(0, 0, 10-i),
+				Latency:  i * 10,
+			},
+		}
+		if i == 1 {
+			tracking.Issuer = "DigiCert Inc"
+			tracking.Status = StatusExpired
+		}
+		if err := InsertDomainTracking(context.Background(), tracking); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := fiber.Map{"organization_id": testOrganizationID}
+
+	// The pages should neither overlap nor skip trackings.
+	var names []string
+	for page := 0; page < 3; page++ {
+		trackings, err := GetDomainTrackings(context.Background(), query, "domain", 2, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tracking := range trackings {
+			names = append(names, tracking.DomainName)
+		}
+	}
+	if len(names) != 5 || names[0] != "a.com" || names[4] != "e.com" {
+		t.Fatalf("expected all trackings in order got %v", names)
+	}
+
+	trackings, err := GetDomainTrackings(context.Background(), query, "expires", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trackings[0].DomainName != "e.com" {
+		t.Fatalf("expected e.com to expire first got %s", trackings[0].DomainName)
+	}
+	trackings, err = GetDomainTrackings(context.Background(), query, "status", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trackings[0].DomainName != "b.com" {
+		t.Fatalf("expected the expired b.com first got %s", trackings[0].DomainName)
+	}
+
+	for search, expected := range map[string]int{
+		"digicert": 1,
+		"www.c":    1,
+		"_":        1,
+		".com":     5,
+	} {
+		count, err := CountDomainTrackings(context.Background(), fiber.Map{"organization_id": testOrganizationID, FilterSearch: search})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Fatalf("expected %d trackings matching %q got %d", expected, search, count)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// HistoryRawRetention is how long the raw probe results are kept. Older
+	// results are only available as hourly rollups.
+	HistoryRawRetention = time.Hour * 24 * 8
+	// HistoryRollupRetention is how long the hourly rollups are kept.
+	HistoryRollupRetention = time.Hour * 24 * 90
+	// historyRawWindow is the period for which the history is read from the
+	// raw results. It is shorter than the raw retention, so the hours before
+	// it are guaranteed to be rolled up.
+	historyRawWindow = time.Hour * 24 * 7
+
+	historyPartitionPrefix = "tracking_history_p"
+	historyPartitionLayout = "20060102"
+)
+
+// TrackingHistory is a single probe result of a tracking. The history is
+// append-only.
+type TrackingHistory struct {
+	bun.BaseModel `bun:"table:tracking_history,alias:th"`
+
+	DomainTrackingID int64
+	UserID           string
+	PolledAt         time.Time
+	Status           string
+	Latency          int
+	Error            string
+}
+
+// NewTrackingHistory returns the history entry of the last poll of the tracking.
+func NewTrackingHistory(tracking DomainTracking) TrackingHistory {
+	return TrackingHistory{
+		DomainTrackingID: tracking.ID,
+		UserID:           tracking.UserID,
+		PolledAt:         tracking.LastPollAt,
+		Status:           tracking.Status,
+		Latency:          tracking.Latency,
+		Error:            tracking.Error,
+	}
+}
+
+// IsUp returns true if the certificate of the tracking could be checked and
+// is still valid.
+func IsUp(status string) bool {
+	return status == StatusHealthy || status == StatusExpires
+}
+
+// HistoryBucket aggregates the probe results of a tracking in a single hour.
+type HistoryBucket struct {
+	Bucket     time.Time
+	Polls      int
+	Up         int
+	AvgLatency int
+	MaxLatency int
+}
+
+// Uptime returns the percentage of polls since the given time that found the
+// tracking up. It returns -1 if there were no polls.
+func Uptime(buckets []HistoryBucket, since time.Time) float64 {
+	var polls, up int
+	for _, bucket := range buckets {
+		if bucket.Bucket.Before(since.Truncate(time.Hour)) {
+			continue
+		}
+		polls += bucket.Polls
+		up += bucket.Up
+	}
+	if polls == 0 {
+		return -1
+	}
+	return float64(up) / float64(polls) * 100
+}
+
+func InsertTrackingHistory(history []TrackingHistory) error {
+	return insertTrackingHistory(context.Background(), db.Bun, history)
+}
+
+func insertTrackingHistory(ctx context.Context, idb bun.IDB, history []TrackingHistory) error {
+	if len(history) == 0 {
+		return nil
+	}
+	_, err := idb.NewInsert().
+		Model(&history).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	return err
+}
+
+// GetTrackingHistory returns the hourly history of the tracking since the
+// given time. Recent hours are aggregated from the raw probe results, older
+// hours are read from the rollups.
+func GetTrackingHistory(ctx context.Context, trackingID int64, since time.Time, now time.Time) ([]HistoryBucket, error) {
+	var (
+		buckets []HistoryBucket
+		cutoff  = now.Add(-historyRawWindow).Truncate(time.Hour)
+		rawFrom = since
+	)
+	if rawFrom.Before(cutoff) {
+		rawFrom = cutoff
+	}
+	err := db.Bun.NewRaw(`
+		SELECT bucket, polls, up, avg_latency, max_latency
+		FROM tracking_history_hourly
+		WHERE domain_tracking_id = ? AND bucket >= ? AND bucket < ?
+		UNION ALL
+		SELECT date_trunc('hour', polled_at) AS bucket,
+			count(*) AS polls,
+			count(*) FILTER (WHERE status IN (?)) AS up,
+			coalesce(avg(latency), 0)::int AS avg_latency,
+			coalesce(max(latency), 0) AS max_latency
+		FROM tracking_history
+		WHERE domain_tracking_id = ? AND polled_at >= ?
+		GROUP BY 1
+		ORDER BY bucket`,
+		trackingID, since.Truncate(time.Hour), cutoff,
+		bun.In([]string{StatusHealthy, StatusExpires}),
+		trackingID, rawFrom,
+	).Scan(ctx, &buckets)
+	return buckets, err
+}
+
+// RollupTrackingHistory aggregates the raw probe results between from and to
+// into hourly rollups. Hours that were rolled up before are recomputed, so it
+// is safe to run this more than once for the same period.
+func RollupTrackingHistory(from, to time.Time) error {
+	_, err := db.Bun.NewRaw(`
+		INSERT INTO tracking_history_hourly (domain_tracking_id, bucket, polls, up, avg_latency, max_latency)
+		SELECT domain_tracking_id, date_trunc('hour', polled_at),
+			count(*),
+			count(*) FILTER (WHERE status IN (?)),
+			coalesce(avg(latency), 0)::int,
+			coalesce(max(latency), 0)
+		FROM tracking_history
+		WHERE polled_at >= ? AND polled_at < ?
+		GROUP BY 1, 2
+		ON CONFLICT (domain_tracking_id, bucket) DO UPDATE SET
+			polls = EXCLUDED.polls,
+			up = EXCLUDED.up,
+			avg_latency = EXCLUDED.avg_latency,
+			max_latency = EXCLUDED.max_latency`,
+		bun.In([]string{StatusHealthy, StatusExpires}),
+		from.Truncate(time.Hour), to.Truncate(time.Hour),
+	).Exec(context.Background())
+	return err
+}
+
+// DeleteExpiredHistoryRollups deletes the hourly rollups older than before.
+func DeleteExpiredHistoryRollups(before time.Time) error {
+	_, err := db.Bun.NewDelete().
+		Table("tracking_history_hourly").
+		Where("bucket < ?", before).
+		Exec(context.Background())
+	return err
+}
+
+// historyPartitionName returns the name of the daily partition of the raw
+// history the given day is stored in.
+func historyPartitionName(day time.Time) string {
+	return historyPartitionPrefix + day.UTC().Format(historyPartitionLayout)
+}
+
+// EnsureHistoryPartitions creates the daily partitions of the raw history
+// from the day of now until the given number of days ahead.
+func EnsureHistoryPartitions(now time.Time, daysAhead int) error {
+	ctx := context.Background()
+	start := now.UTC().Truncate(time.Hour * 24)
+	for i := 0; i <= daysAhead; i++ {
+		day := start.AddDate(0, 0, i)
+		_, err := db.Bun.ExecContext(ctx,
+			"CREATE TABLE IF NOT EXISTS ? PARTITION OF tracking_history FOR VALUES FROM (?) TO (?)",
+			bun.Ident(historyPartitionName(day)), day.Format(time.DateOnly), day.AddDate(0, 0, 1).Format(time.DateOnly))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropExpiredHistoryPartitions drops the daily partitions of the raw history
+// that only contain results from before the given time. It returns the names
+// of the dropped partitions.
+func DropExpiredHistoryPartitions(before time.Time) ([]string, error) {
+	var (
+		ctx        = context.Background()
+		partitions []string
+		dropped    = []string{}
+	)
+	err := db.Bun.NewRaw(`
+		SELECT child.relname FROM pg_inherits
+		JOIN pg_class parent ON pg_inherits.inhparent = parent.oid
+		JOIN pg_class child ON pg_inherits.inhrelid = child.oid
+		WHERE parent.relname = 'tracking_history'`).
+		Scan(ctx, &partitions)
+	if err != nil {
+		return nil, err
+	}
+	for _, partition := range partitions {
+		expired, err := historyPartitionExpired(partition, before)
+		if err != nil {
+			return dropped, err
+		}
+		if !expired {
+			continue
+		}
+		if _, err := db.Bun.ExecContext(ctx, "DROP TABLE IF EXISTS ?", bun.Ident(partition)); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, partition)
+	}
+	return dropped, nil
+}
+
+// historyPartitionExpired returns true if the whole day of the partition is
+// before the given time.
+func historyPartitionExpired(partition string, before time.Time) (bool, error) {
+	if !strings.HasPrefix(partition, historyPartitionPrefix) {
+		return false, fmt.Errorf("unexpected tracking history partition %q", partition)
+	}
+	day, err := time.Parse(historyPartitionLayout, strings.TrimPrefix(partition, historyPartitionPrefix))
+	if err != nil {
+		return false, fmt.Errorf("unexpected tracking history partition %q", partition)
+	}
+	return !day.AddDate(0, 0, 1).After(before), nil
+}
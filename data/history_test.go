@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUptime(t *testing.T) {
+	now := time.Date(2023, 7, 24, 12, 30, 0, 0, time.UTC)
+	buckets := []HistoryBucket{
+		{Bucket: now.Add(-time.Hour * 48).Truncate(time.Hour), Polls: 10, Up: 0},
+		{Bucket: now.Add(-time.Hour * 2).Truncate(time.Hour), Polls: 10, Up: 10},
+		{Bucket: now.Truncate(time.Hour), Polls: 10, Up: 5},
+	}
+	if uptime := Uptime(buckets, now.Add(-time.Hour*24)); uptime != 75 {
+		t.Fatalf("expected 24h uptime of 75 got %f", uptime)
+	}
+	if uptime := Uptime(buckets, now.Add(-time.Hour*24*7)); uptime != 50 {
+		t.Fatalf("expected 7d uptime of 50 got %f", uptime)
+	}
+	if uptime := Uptime(nil, now); uptime != -1 {
+		t.Fatalf("expected unknown uptime without polls got %f", uptime)
+	}
+}
+
+func TestHistoryPartitionExpired(t *testing.T) {
+	before := time.Date(2023, 7, 24, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		partition string
+		expired   bool
+	}{
+		{historyPartitionName(before.AddDate(0, 0, -2)), true},
+		{historyPartitionName(before.AddDate(0, 0, -1)), false},
+		{historyPartitionName(before), false},
+	}
+	for _, test := range tests {
+		expired, err := historyPartitionExpired(test.partition, before.Add(-time.Hour*24))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired != test.expired {
+			t.Fatalf("expected partition %s expired to be %t", test.partition, test.expired)
+		}
+	}
+	if _, err := historyPartitionExpired("tracking_history_default", before); err == nil {
+		t.Fatal("expected error for partition without a date")
+	}
+}
+
+func TestIntegrationTrackingHistory(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 1)
+	if err := EnsureHistoryPartitions(time.Now().AddDate(0, 0, -10), 12); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		now     = time.Now().UTC()
+		history = []TrackingHistory{}
+	)
+	trackings, err := GetAllOrganizationDomainTrackings(testOrganizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One poll every hour for the last 10 days, down every 4th hour.
+	for i := 0; i < 24*10; i++ {
+		status := StatusHealthy
+		if i%4 == 0 {
+			status = StatusOffline
+		}
+		history = append(history, TrackingHistory{
+			DomainTrackingID: trackings[0].ID,
+			UserID:           testUserID,
+			PolledAt:         now.Add(-time.Hour * time.Duration(i)),
+			Status:           status,
+			Latency:          100,
+		})
+	}
+	if err := InsertTrackingHistory(history); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollupTrackingHistory(now.AddDate(0, 0, -11), now); err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := DropExpiredHistoryPartitions(now.Add(-HistoryRawRetention))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) == 0 {
+		t.Fatal("expected expired partitions to be dropped")
+	}
+
+	buckets, err := GetTrackingHistory(context.Background(), trackings[0].ID, now.AddDate(0, 0, -30), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The raw results of the dropped partitions are still available as rollups.
+	if len(buckets) != 24*10 {
+		t.Fatalf("expected %d hourly buckets got %d", 24*10, len(buckets))
+	}
+	if uptime := Uptime(buckets, now.AddDate(0, 0, -30)); uptime != 75 {
+		t.Fatalf("expected 30d uptime of 75 got %f", uptime)
+	}
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/uptrace/bun"
+)
+
+// ClaimDueTrackings leases up to limit trackings that are due to be polled to
+// the given owner. Rows locked by other pulsers are skipped, so multiple
+// pulsers can claim work at the same time without polling the same tracking
+// twice. Leases that expired (the pulser holding them died) are reclaimed.
+//
+// The claim is grouped by probe target: all trackings subscribed to the probe
+// target of a due tracking are claimed together, even when they are not due
+// yet, so the result of a single probe can be fanned out to all of them. The
+// limit caps the due trackings and with them the number of probes, the
+// returned batch includes the subscribers and can be larger than the limit.
+//
+// The targets are only locked while the claim runs, which keeps two pulsers
+// claiming at the same time from both taking the same target. Subscribers
+// whose lease is held or that are added after the claim can still be claimed
+// by another pulser later, so a target is occasionally probed twice within a
+// lease. A tracking itself is never leased to two pulsers at once.
+func ClaimDueTrackings(owner string, lease time.Duration, now time.Time, limit int) ([]TrackingAndAccount, error) {
+	var (
+		ctx       = context.Background()
+		ids       []int64
+		trackings []TrackingAndAccount
+	)
+	err := db.Bun.NewRaw(`
+		WITH due AS (
+			SELECT id, probe_target_id FROM domain_trackings
+			WHERE next_poll_at <= ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)
+			ORDER BY next_poll_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		), targets AS (
+			SELECT id FROM probe_targets
+			WHERE id IN (SELECT probe_target_id FROM due)
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE domain_trackings SET lease_owner = ?, lease_expires_at = ?
+		WHERE (lease_expires_at IS NULL OR lease_expires_at < ?)
+		AND (
+			(probe_target_id IS NULL AND id IN (SELECT id FROM due))
+			OR probe_target_id IN (SELECT id FROM targets)
+		)
+		RETURNING id`, now, now, limit, owner, now.Add(lease), now).
+		Scan(ctx, &ids)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	err = selectTrackingsWithAccount(db.Bun.NewSelect()).
+		Where("dt.id IN (?)", bun.In(ids)).
+		Where("dt.lease_owner = ?", owner).
+		Order("dt.next_poll_at").
+		Scan(ctx, &trackings)
+	if err != nil {
+		return nil, err
+	}
+	// The tags are needed to route and suppress the notifications.
+	tags, err := GetTrackingTags(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range trackings {
+		trackings[i].DomainTracking.Tags = tags[trackings[i].DomainTracking.ID]
+	}
+	return trackings, nil
+}
+
+// ReleaseLeases releases the leases the owner holds on the given trackings.
+func ReleaseLeases(owner string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return releaseLeases(context.Background(), db.Bun, owner, ids)
+}
+
+func releaseLeases(ctx context.Context, idb bun.IDB, owner string, ids []int64) error {
+	_, err := idb.NewUpdate().
+		Model((*DomainTracking)(nil)).
+		Set("lease_owner = NULL").
+		Set("lease_expires_at = NULL").
+		Where("id IN (?)", bun.In(ids)).
+		Where("lease_owner = ?", owner).
+		Exec(ctx)
+	return err
+}
+
+// ownedTrackingIDs locks and returns the ids of the given trackings the owner
+// still holds a lease on. Results of trackings that were reclaimed by another
+// pulser in the meantime must be discarded.
+func ownedTrackingIDs(ctx context.Context, tx bun.Tx, owner string, ids []int64) (map[int64]bool, error) {
+	var owned []int64
+	err := tx.NewSelect().
+		Model((*DomainTracking)(nil)).
+		Column("id").
+		Where("id IN (?)", bun.In(ids)).
+		Where("lease_owner = ?", owner).
+		For("UPDATE").
+		Scan(ctx, &owned)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[int64]bool, len(owned))
+	for _, id := range owned {
+		m[id] = true
+	}
+	return m, nil
+}
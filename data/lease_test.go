@@ -0,0 +1,232 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/db/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testUserID = "6c6d9d2a-1b0e-4a8e-9d1c-4f7f3b2f3a11"
+
+// testOrganizationID is the organization of the test user, it is set by
+// setupIntegrationDB.
+var testOrganizationID int64
+
+// setupIntegrationDB (re)creates the local test database and creates an
+// organization with its account for the test user.
+func setupIntegrationDB(t *testing.T) {
+	dbtest.Setup(t)
+	dbtest.CreateUser(t, testUserID, "test@certpulse.com")
+	member, err := CreateOrganization("test", &User{ID: testUserID, Email: "test@certpulse.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOrganizationID = member.OrganizationID
+}
+
+func insertDueTrackings(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		tracking := &DomainTracking{
+			UserID:         testUserID,
+			OrganizationID: testOrganizationID,
+			DomainName:     "domain.com",
+			NextPollAt:     time.Now().Add(-time.Minute),
+			DomainTrackingInfo: DomainTrackingInfo{
+				Status:     StatusHealthy,
+				Expires:    time.Now().AddDate(0, 3, 0),
+				LastPollAt: time.Now(),
+			},
+		}
+		if err := InsertDomainTracking(context.Background(), tracking); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIntegrationClaimDueTrackings(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 100)
+
+	var (
+		wg      = sync.WaitGroup{}
+		mu      = sync.Mutex{}
+		claimed = map[int64]string{}
+		owners  = []string{"pulser-1", "pulser-2", "pulser-3", "pulser-4"}
+	)
+	for _, owner := range owners {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for {
+				trackings, err := ClaimDueTrackings(owner, time.Minute, time.Now(), 10)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(trackings) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, tracking := range trackings {
+					if other, ok := claimed[tracking.DomainTracking.ID]; ok {
+						t.Errorf("tracking %d claimed by both %s and %s", tracking.DomainTracking.ID, other, owner)
+					}
+					claimed[tracking.DomainTracking.ID] = owner
+				}
+				mu.Unlock()
+			}
+		}(owner)
+	}
+	wg.Wait()
+
+	if len(claimed) != 100 {
+		t.Fatalf("expected all 100 trackings to be claimed got %d", len(claimed))
+	}
+	trackings, err := ClaimDueTrackings("pulser-5", time.Minute, time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trackings) != 0 {
+		t.Fatalf("expected leased trackings not to be claimed again got %d", len(trackings))
+	}
+}
+
+func TestIntegrationReclaimExpiredLeases(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 5)
+
+	trackings, err := ClaimDueTrackings("pulser-1", time.Minute, time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trackings) != 5 {
+		t.Fatalf("expected 5 claimed trackings got %d", len(trackings))
+	}
+	// pulser-1 died, once its leases expire another pulser takes over.
+	trackings, err = ClaimDueTrackings("pulser-2", time.Minute, time.Now().Add(time.Minute*2), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trackings) != 5 {
+		t.Fatalf("expected 5 reclaimed trackings got %d", len(trackings))
+	}
+
+	// The results of pulser-1 should be discarded since it lost its leases.
+	results := make([]DomainTracking, len(trackings))
+	for i, tracking := range trackings {
+		results[i] = tracking.DomainTracking
+		results[i].Status = StatusOffline
+	}
+	if err := SavePollResults("pulser-1", results, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	tracking, err := GetDomainTracking(context.Background(), fiber.Map{"id": results[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking.Status != StatusHealthy || tracking.LeaseOwner != "pulser-2" {
+		t.Fatalf("expected results of expired lease to be discarded got status %s owner %s", tracking.Status, tracking.LeaseOwner)
+	}
+
+	if err := SavePollResults("pulser-2", results, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	tracking, err = GetDomainTracking(context.Background(), fiber.Map{"id": results[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking.Status != StatusOffline || len(tracking.LeaseOwner) != 0 {
+		t.Fatalf("expected results to be saved and lease released got status %s owner %s", tracking.Status, tracking.LeaseOwner)
+	}
+}
+
+func TestIntegrationClaimProbeTargetSubscribers(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 1)
+	// Subscribed to the same probe target but not due yet.
+	tracking := &DomainTracking{
+		UserID:     testUserID,
+		DomainName: "domain.com",
+		NextPollAt: time.Now().Add(time.Hour),
+	}
+	if err := InsertDomainTracking(context.Background(), tracking); err != nil {
+		t.Fatal(err)
+	}
+	other := &DomainTracking{
+		UserID:     testUserID,
+		DomainName: "other.com",
+		NextPollAt: time.Now().Add(time.Hour),
+	}
+	if err := InsertDomainTracking(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	trackings, err := ClaimDueTrackings("pulser-1", time.Minute, time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trackings) != 2 {
+		t.Fatalf("expected the due tracking and its subscriber to be claimed got %d", len(trackings))
+	}
+	if trackings[0].ProbeTargetID == 0 || trackings[0].ProbeTargetID != trackings[1].ProbeTargetID {
+		t.Fatalf("expected trackings to share a probe target got %d and %d", trackings[0].ProbeTargetID, trackings[1].ProbeTargetID)
+	}
+}
+
+func TestIntegrationClaimGroupsByProbeTarget(t *testing.T) {
+	setupIntegrationDB(t)
+	for i := 0; i < 40; i++ {
+		tracking := &DomainTracking{
+			UserID:         testUserID,
+			OrganizationID: testOrganizationID,
+			DomainName:     fmt.Sprintf("domain%d.com", i%8),
+			NextPollAt:     time.Now().Add(-time.Minute),
+		}
+		if err := InsertDomainTracking(context.Background(), tracking); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		wg     = sync.WaitGroup{}
+		mu     = sync.Mutex{}
+		owners = map[int64]string{}
+		count  = 0
+	)
+	for _, owner := range []string{"pulser-1", "pulser-2", "pulser-3", "pulser-4"} {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for {
+				trackings, err := ClaimDueTrackings(owner, time.Minute, time.Now(), 2)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(trackings) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, tracking := range trackings {
+					targetID := tracking.DomainTracking.ProbeTargetID
+					if other, ok := owners[targetID]; ok && other != owner {
+						t.Errorf("probe target %d claimed by both %s and %s", targetID, other, owner)
+					}
+					owners[targetID] = owner
+					count++
+				}
+				mu.Unlock()
+			}
+		}(owner)
+	}
+	wg.Wait()
+
+	if len(owners) != 8 || count != 40 {
+		t.Fatalf("expected 40 trackings of 8 probe targets to be claimed got %d of %d", count, len(owners))
+	}
+}
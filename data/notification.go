@@ -0,0 +1,306 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+)
+
+const (
+	NotificationStatePending   = "pending"
+	NotificationStateSending   = "sending"
+	NotificationStateDelivered = "delivered"
+	NotificationStateDead      = "dead"
+)
+
+const (
+	ChannelEmail   = "email"
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+)
+
+const (
+	// MaxNotificationAttempts is the number of delivery attempts before a
+	// notification is dead-lettered.
+	MaxNotificationAttempts = 8
+
+	notificationBaseBackoff = time.Second * 30
+	notificationMaxBackoff  = time.Hour
+	// notificationSendLease is how long a claimed batch is reserved for the
+	// worker delivering it. It has to outlast a batch of deliveries that all
+	// run into their timeout.
+	notificationSendLease = time.Minute * 10
+)
+
+// Notification is an intent to notify an organization over a single channel. They are
+// written to the notifications table (outbox) together with the poll results
+// and delivered by a separate worker.
+type Notification struct {
+	ID               int64 `bun:"id,pk,autoincrement"`
+	UserID           string
+	OrganizationID   int64
+	DomainTrackingID int64 `bun:",nullzero"`
+	Kind             string
+	Channel          string
+	Target           string
+	DomainName       string
+	Status           string
+	Expires          time.Time `bun:",nullzero"`
+	State            string
+	Attempts         int
+	LastError        string
+	NextAttemptAt    time.Time
+	CreatedAt        time.Time `bun:",nullzero,default:now()"`
+	DeliveredAt      time.Time `bun:",nullzero"`
+}
+
+// TrackingAndAccount returns the snapshot of the tracking the notification
+// was created for, so it can be handed to the notifiers.
+func (n Notification) TrackingAndAccount() TrackingAndAccount {
+	tracking := TrackingAndAccount{
+		DomainTracking: DomainTracking{
+			ID:             n.DomainTrackingID,
+			UserID:         n.UserID,
+			OrganizationID: n.OrganizationID,
+			DomainName:     n.DomainName,
+			DomainTrackingInfo: DomainTrackingInfo{
+				Status:  n.Status,
+				Expires: n.Expires,
+			},
+		},
+	}
+	if n.Channel == ChannelEmail {
+		tracking.Account.NotifyDefaultEmail = n.Target
+	}
+	return tracking
+}
+
+func (n *Notification) MarkDelivered(now time.Time) {
+	n.Attempts++
+	n.State = NotificationStateDelivered
+	n.DeliveredAt = now
+	n.LastError = ""
+}
+
+// MarkFailed schedules the next delivery attempt with an exponential backoff
+// or dead-letters the notification when it ran out of attempts.
+func (n *Notification) MarkFailed(err error, now time.Time) {
+	n.Attempts++
+	n.State = NotificationStatePending
+	n.LastError = err.Error()
+	if n.Attempts >= MaxNotificationAttempts {
+		n.State = NotificationStateDead
+		return
+	}
+	backoff := notificationBaseBackoff << (n.Attempts - 1)
+	if backoff > notificationMaxBackoff {
+		backoff = notificationMaxBackoff
+	}
+	n.NextAttemptAt = now.Add(backoff)
+}
+
+type NotificationKey struct {
+	DomainTrackingID int64
+	Kind             string
+}
+
+// GetRecentNotificationKeys returns the trackings (and kind) that already have
+// a notification queued since notifiedSince or a suppressed notification since
+// suppressedSince. These should not be notified again.
+func GetRecentNotificationKeys(notifiedSince, suppressedSince time.Time) (map[NotificationKey]bool, error) {
+	var (
+		ctx  = context.Background()
+		keys = []NotificationKey{}
+	)
+	err := db.Bun.NewSelect().
+		ColumnExpr("domain_tracking_id, kind").
+		Table("notifications").
+		Where("created_at >= ?", notifiedSince).
+		Where("domain_tracking_id IS NOT NULL").
+		Union(db.Bun.NewSelect().
+			ColumnExpr("domain_tracking_id, kind").
+			Table("suppressed_notifications").
+			Where("created_at >= ?", suppressedSince)).
+		Scan(ctx, &keys)
+	if err != nil {
+		return nil, err
+	}
+	recent := make(map[NotificationKey]bool, len(keys))
+	for _, key := range keys {
+		recent[key] = true
+	}
+	return recent, nil
+}
+
+// SavePollResults updates the polled trackings, appends the results to their
+// history, queues the notifications for delivery and releases the leases of
+// the owner in a single transaction.
+// Results of trackings the owner lost its lease on are discarded.
+func SavePollResults(owner string, trackings []DomainTracking, notifications []Notification, suppressed []SuppressedNotification) error {
+	if len(trackings) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(trackings))
+	for i, tracking := range trackings {
+		ids[i] = tracking.ID
+	}
+	ctx := context.Background()
+	return db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		owned, err := ownedTrackingIDs(ctx, tx, owner, ids)
+		if err != nil {
+			return err
+		}
+		var (
+			ownedTrackings      = []DomainTracking{}
+			ownedNotifications  = []Notification{}
+			ownedSuppressed     = []SuppressedNotification{}
+			ownedTrackingIDList = []int64{}
+		)
+		for _, tracking := range trackings {
+			if owned[tracking.ID] {
+				ownedTrackings = append(ownedTrackings, tracking)
+				ownedTrackingIDList = append(ownedTrackingIDList, tracking.ID)
+			}
+		}
+		for _, notification := range notifications {
+			if owned[notification.DomainTrackingID] {
+				ownedNotifications = append(ownedNotifications, notification)
+			}
+		}
+		for _, s := range suppressed {
+			if owned[s.DomainTrackingID] {
+				ownedSuppressed = append(ownedSuppressed, s)
+			}
+		}
+		if len(ownedTrackings) == 0 {
+			return nil
+		}
+		if err := updateAllTrackings(ctx, tx, ownedTrackings); err != nil {
+			return err
+		}
+		history := make([]TrackingHistory, len(ownedTrackings))
+		for i, tracking := range ownedTrackings {
+			history[i] = NewTrackingHistory(tracking)
+		}
+		if err := insertTrackingHistory(ctx, tx, history); err != nil {
+			return err
+		}
+		if err := publishTrackingEvents(ctx, tx, ownedTrackings); err != nil {
+			return err
+		}
+		if len(ownedNotifications) > 0 {
+			if _, err := tx.NewInsert().Model(&ownedNotifications).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		if len(ownedSuppressed) > 0 {
+			if _, err := tx.NewInsert().Model(&ownedSuppressed).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return releaseLeases(ctx, tx, owner, ownedTrackingIDList)
+	})
+}
+
+// DeliverPendingNotifications claims up to limit notifications that are due
+// and hands them to deliver. The notifications are delivered outside of a
+// transaction and the result of each delivery is saved on its own, so a slow
+// channel doesn't hold locks and a crash doesn't forget the notifications that
+// were already delivered. It returns the number of notifications that were
+// processed.
+func DeliverPendingNotifications(limit int, deliver func(*Notification) error) (int, error) {
+	notifications, err := claimNotifications(limit, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for i := range notifications {
+		notification := &notifications[i]
+		if err := deliver(notification); err != nil {
+			notification.MarkFailed(err, time.Now())
+		} else {
+			notification.MarkDelivered(time.Now())
+		}
+		if err := saveDelivery(notification); err != nil {
+			return i, err
+		}
+	}
+	return len(notifications), nil
+}
+
+// claimNotifications marks up to limit due notifications as sending until the
+// send lease expires. Rows locked by other workers are skipped, so multiple
+// workers never deliver the same notification. Notifications of a worker that
+// died while sending are claimed again once their lease expired.
+func claimNotifications(limit int, now time.Time) ([]Notification, error) {
+	var notifications []Notification
+	err := db.Bun.NewRaw(`
+		UPDATE notifications SET state = ?, next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE state IN (?, ?) AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		NotificationStateSending, now.Add(notificationSendLease),
+		NotificationStatePending, NotificationStateSending, now, limit).
+		Scan(context.Background(), &notifications)
+	return notifications, err
+}
+
+// saveDelivery stores the result of the delivery of a claimed notification.
+func saveDelivery(notification *Notification) error {
+	_, err := db.Bun.NewUpdate().
+		Model(notification).
+		Column("state", "attempts", "last_error", "next_attempt_at", "delivered_at").
+		WherePK().
+		Where("state = ?", NotificationStateSending).
+		Exec(context.Background())
+	return err
+}
+
+func GetOrganizationNotifications(ctx context.Context, organizationID int64, limit int) ([]Notification, error) {
+	var notifications []Notification
+	err := db.Bun.NewSelect().
+		Model(&notifications).
+		Where("organization_id = ?", organizationID).
+		Order("created_at DESC").
+		Limit(limit).
+		Scan(ctx)
+	return notifications, err
+}
+
+func GetOrganizationSuppressedNotifications(organizationID int64, limit int) ([]SuppressedNotification, error) {
+	var suppressed []SuppressedNotification
+	err := db.Bun.NewSelect().
+		Model(&suppressed).
+		ColumnExpr("sn.*, dt.domain_name").
+		Join("INNER JOIN domain_trackings AS dt").
+		JoinOn("dt.id = sn.domain_tracking_id").
+		Where("sn.organization_id = ?", organizationID).
+		Order("sn.created_at DESC").
+		Limit(limit).
+		Scan(context.Background())
+	return suppressed, err
+}
+
+// RetryNotification puts a (dead) notification back in the queue. It returns
+// the number of notifications that were requeued.
+func RetryNotification(ctx context.Context, query fiber.Map) (int64, error) {
+	builder := db.Bun.NewUpdate().
+		Model(&Notification{}).
+		Set("state = ?", NotificationStatePending).
+		Set("attempts = 0").
+		Set("next_attempt_at = ?", time.Now()).
+		QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	res, err := builder.Unwrap().(*bun.UpdateQuery).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
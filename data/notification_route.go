@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+)
+
+// NotificationRoute sends the notifications of the trackings with a tag to an
+// extra target, on top of the default targets of the account.
+type NotificationRoute struct {
+	ID             int64 `bun:"id,pk,autoincrement"`
+	UserID         string
+	OrganizationID int64
+	Tag            string
+	Channel        string
+	Target         string
+	CreatedAt      time.Time `bun:",nullzero,default:now()"`
+}
+
+// Matches returns true if the route applies to a tracking with the given tags.
+func (r NotificationRoute) Matches(tags []string) bool {
+	return hasTag(tags, r.Tag)
+}
+
+// NotificationTarget is a single channel and target (email address, webhook
+// URL) a notification is delivered to.
+type NotificationTarget struct {
+	Channel string
+	Target  string
+}
+
+// NotificationTargets returns the default targets of the account followed by
+// the targets of the routes matching the tags of the tracking. A target is
+// only notified once, even when several routes lead to it.
+func NotificationTargets(tracking TrackingAndAccount, routes []NotificationRoute) []NotificationTarget {
+	account := tracking.Account
+	targets := []NotificationTarget{{ChannelEmail, account.NotifyDefaultEmail}}
+	if len(account.SlackAccessToken) > 0 {
+		targets = append(targets, NotificationTarget{ChannelSlack, account.SlackWebhookURL})
+	}
+	if len(account.NotifyWebhookURL) > 0 {
+		targets = append(targets, NotificationTarget{ChannelWebhook, account.NotifyWebhookURL})
+	}
+	seen := map[NotificationTarget]bool{}
+	for _, target := range targets {
+		seen[target] = true
+	}
+	for _, route := range routes {
+		target := NotificationTarget{route.Channel, route.Target}
+		if route.Matches(tracking.DomainTracking.Tags) && !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func GetNotificationRoutes(organizationID int64) ([]NotificationRoute, error) {
+	var routes []NotificationRoute
+	err := db.Bun.NewSelect().
+		Model(&routes).
+		Where("organization_id = ?", organizationID).
+		Order("tag", "id").
+		Scan(context.Background())
+	return routes, err
+}
+
+// GetAllNotificationRoutes returns all the notification routes grouped by the
+// organization they belong to.
+func GetAllNotificationRoutes() (map[int64][]NotificationRoute, error) {
+	var routes []NotificationRoute
+	if err := db.Bun.NewSelect().Model(&routes).Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	byOrganization := make(map[int64][]NotificationRoute)
+	for _, route := range routes {
+		byOrganization[route.OrganizationID] = append(byOrganization[route.OrganizationID], route)
+	}
+	return byOrganization, nil
+}
+
+func InsertNotificationRoute(route *NotificationRoute) error {
+	_, err := db.Bun.NewInsert().Model(route).Exec(context.Background())
+	return err
+}
+
+func DeleteNotificationRoute(query fiber.Map) error {
+	builder := db.Bun.NewDelete().Model(&NotificationRoute{}).QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.DeleteQuery).Exec(context.Background())
+	return err
+}
@@ -0,0 +1,32 @@
+package data
+
+import "testing"
+
+func TestNotificationTargets(t *testing.T) {
+	tracking := TrackingAndAccount{
+		Account: Account{
+			NotifyDefaultEmail: "owner@foo.com",
+			NotifyWebhookURL:   "https://foo.com/hooks/certpulse",
+		},
+		DomainTracking: DomainTracking{ID: 1, DomainName: "foo.com", Tags: []string{"payments"}},
+	}
+	routes := []NotificationRoute{
+		{Tag: "payments", Channel: ChannelEmail, Target: "payments@foo.com"},
+		{Tag: "payments", Channel: ChannelEmail, Target: "owner@foo.com"},
+		{Tag: "marketing", Channel: ChannelEmail, Target: "marketing@foo.com"},
+	}
+	targets := NotificationTargets(tracking, routes)
+	expected := []NotificationTarget{
+		{ChannelEmail, "owner@foo.com"},
+		{ChannelWebhook, "https://foo.com/hooks/certpulse"},
+		{ChannelEmail, "payments@foo.com"},
+	}
+	if len(targets) != len(expected) {
+		t.Fatalf("expected %d targets got %+v", len(expected), targets)
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Fatalf("expected target %+v got %+v", expected[i], targets[i])
+		}
+	}
+}
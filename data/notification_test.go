@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+)
+
+func TestNotificationMarkFailed(t *testing.T) {
+	var (
+		now          = time.Now()
+		notification = Notification{State: NotificationStateSending}
+		err          = fmt.Errorf("slack returned non 200 response: 500")
+	)
+	notification.MarkFailed(err, now)
+	if notification.NextAttemptAt != now.Add(notificationBaseBackoff) {
+		t.Fatalf("expected first retry after %s got %s", notificationBaseBackoff, notification.NextAttemptAt.Sub(now))
+	}
+	notification.MarkFailed(err, now)
+	if notification.NextAttemptAt != now.Add(notificationBaseBackoff*2) {
+		t.Fatalf("expected second retry after %s got %s", notificationBaseBackoff*2, notification.NextAttemptAt.Sub(now))
+	}
+	for notification.State == NotificationStatePending {
+		notification.MarkFailed(err, now)
+		if notification.NextAttemptAt.Sub(now) > notificationMaxBackoff {
+			t.Fatalf("expected backoff to be capped at %s", notificationMaxBackoff)
+		}
+	}
+	if notification.Attempts != MaxNotificationAttempts {
+		t.Fatalf("expected notification to be dead after %d attempts got %d", MaxNotificationAttempts, notification.Attempts)
+	}
+	if notification.LastError != err.Error() {
+		t.Fatalf("expected last error to be %s got %s", err, notification.LastError)
+	}
+}
+
+func TestIntegrationDeliverPendingNotifications(t *testing.T) {
+	setupIntegrationDB(t)
+	notification := &Notification{
+		UserID:         testUserID,
+		OrganizationID: testOrganizationID,
+		Kind:           NotificationKindExpires,
+		Channel:        ChannelEmail,
+		Target:         "test@certpulse.com",
+		DomainName:     "domain.com",
+		State:          NotificationStatePending,
+		NextAttemptAt:  time.Now().Add(-time.Minute),
+	}
+	if _, err := db.Bun.NewInsert().Model(notification).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var claimed []Notification
+	n, err := DeliverPendingNotifications(10, func(n *Notification) error {
+		// Other workers must not claim the notification while it is sent.
+		others, err := claimNotifications(10, time.Now())
+		if err != nil {
+			return err
+		}
+		claimed = append(claimed, others...)
+		return fmt.Errorf("webhook returned non 200 response: 500")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(claimed) != 0 {
+		t.Fatalf("expected the notification to be delivered once got %d and %d claimed by others", n, len(claimed))
+	}
+	if err := db.Bun.NewSelect().Model(notification).WherePK().Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if notification.State != NotificationStatePending || notification.Attempts != 1 {
+		t.Fatalf("expected the failed notification to be retried later got %+v", notification)
+	}
+
+	// A worker died while sending, the notification is claimed again once
+	// its lease expired.
+	notification.State = NotificationStateSending
+	notification.NextAttemptAt = time.Now().Add(-time.Second)
+	if _, err := db.Bun.NewUpdate().Model(notification).Column("state", "next_attempt_at").WherePK().Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n, err = DeliverPendingNotifications(10, func(*Notification) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Bun.NewSelect().Model(notification).WherePK().Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || notification.State != NotificationStateDelivered || notification.Attempts != 2 {
+		t.Fatalf("expected the expired claim to be delivered got %d %+v", n, notification)
+	}
+}
@@ -0,0 +1,466 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+)
+
+const (
+	MaxOrganizations       = 5
+	MaxOrganizationName    = 80
+	OrganizationInviteTTL  = time.Hour * 24 * 7
+	organizationTokenBytes = 24
+)
+
+// Role is the role of a member in an organization. Each role has all the
+// permissions of the roles below it:
+//
+//   - viewer: sees the trackings, notifications and settings.
+//   - editor: manages the trackings, their labels and the status pages.
+//   - admin: manages the notifications, integrations, API keys and members.
+//   - owner: manages the billing and the other owners.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+var Roles = []Role{RoleOwner, RoleAdmin, RoleEditor, RoleViewer}
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[Role(role)]
+	return ok
+}
+
+// Can reports whether the role has the permissions of the given role.
+func (r Role) Can(role Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[role]
+}
+
+var (
+	// ErrLastOwner is returned when the only owner of an organization would
+	// be removed or demoted.
+	ErrLastOwner = errors.New("an organization needs at least one owner")
+	// ErrInvitationEmail is returned when an invitation is accepted by a user
+	// with another email address than the one that was invited.
+	ErrInvitationEmail = errors.New("the invitation was sent to another email address")
+	// ErrTooManyOrganizations is returned when an invitation is accepted by a
+	// user that already is a member of MaxOrganizations organizations.
+	ErrTooManyOrganizations = errors.New("the user is a member of too many organizations")
+)
+
+// Organization owns the trackings, integrations and the account (billing)
+// that are shared by its members.
+type Organization struct {
+	ID        int64 `bun:"id,pk,autoincrement"`
+	Name      string
+	CreatedBy string    `bun:",nullzero"`
+	CreatedAt time.Time `bun:",nullzero,default:now()"`
+}
+
+// OrganizationMember gives the user access to the organization with the
+// permissions of the role.
+type OrganizationMember struct {
+	OrganizationID int64  `bun:",pk"`
+	UserID         string `bun:",pk"`
+	Email          string
+	Role           Role
+	CreatedAt      time.Time `bun:",nullzero,default:now()"`
+	// OrganizationName is only set on members that were loaded with their
+	// organization.
+	OrganizationName string `bun:",scanonly"`
+}
+
+// OrganizationInvitation invites the email address to join the organization
+// with the role. Only the hash of the token is stored, the token itself is
+// sent by email.
+type OrganizationInvitation struct {
+	ID             int64 `bun:"id,pk,autoincrement"`
+	OrganizationID int64
+	Email          string
+	Role           Role
+	TokenHash      string
+	InvitedBy      string
+	CreatedAt      time.Time `bun:",nullzero,default:now()"`
+	ExpiresAt      time.Time
+	AcceptedAt     time.Time `bun:",nullzero"`
+	// OrganizationName is only set on invitations that were loaded by their
+	// token.
+	OrganizationName string `bun:",scanonly"`
+}
+
+func newAccount(user *User, organizationID int64) *Account {
+	return &Account{
+		UserID:             user.ID,
+		OrganizationID:     organizationID,
+		NotifyUpfront:      7,
+		NotifyDefaultEmail: user.Email,
+		Plan:               PlanStarter,
+		Timezone:           "UTC",
+		DigestEnabled:      true,
+		DigestWeekday:      int(time.Monday),
+		DigestHour:         8,
+	}
+}
+
+// CreateOrganization creates the organization with its account on the
+// starter plan and the user as its owner.
+func CreateOrganization(name string, user *User) (*OrganizationMember, error) {
+	var (
+		ctx    = context.Background()
+		org    = &Organization{Name: name, CreatedBy: user.ID}
+		member *OrganizationMember
+	)
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(org).Exec(ctx); err != nil {
+			return err
+		}
+		member = &OrganizationMember{
+			OrganizationID:   org.ID,
+			UserID:           user.ID,
+			Email:            user.Email,
+			Role:             RoleOwner,
+			OrganizationName: org.Name,
+		}
+		if _, err := tx.NewInsert().Model(member).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(newAccount(user, org.ID)).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		logger.Log("error", "rollback transaction", "query", "createOrganization", "err", err)
+		return nil, err
+	}
+	logger.Log("event", "new organization", "id", org.ID)
+	return member, nil
+}
+
+// CreatePersonalOrganizationIfNotExist makes sure the user is a member of at
+// least one organization, new users become the owner of an organization
+// named after their email address. Organizations of the user without an
+// account get one on the starter plan.
+func CreatePersonalOrganizationIfNotExist(user *User) (*OrganizationMember, error) {
+	members, err := GetUserMemberships(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) > 0 {
+		if err := createMissingAccounts(user); err != nil {
+			return nil, err
+		}
+		return &members[0], nil
+	}
+	member, err := CreateOrganization(user.Email, user)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log("event", "new account signup", "organizationID", member.OrganizationID)
+	return member, nil
+}
+
+// createMissingAccounts creates the accounts of the organizations of the user
+// that have none, which is the case for users that never finished signing in
+// before organizations were introduced.
+func createMissingAccounts(user *User) error {
+	ctx := context.Background()
+	var organizationIDs []int64
+	err := db.Bun.NewSelect().
+		Table("organization_members").
+		Column("organization_id").
+		Where("user_id = ?", user.ID).
+		Where("NOT EXISTS (SELECT 1 FROM accounts AS a WHERE a.organization_id = organization_members.organization_id)").
+		Scan(ctx, &organizationIDs)
+	if err != nil {
+		return err
+	}
+	for _, organizationID := range organizationIDs {
+		_, err := db.Bun.NewInsert().
+			Model(newAccount(user, organizationID)).
+			On("CONFLICT (organization_id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Log("event", "new account for organization", "organizationID", organizationID)
+	}
+	return nil
+}
+
+func selectMembers(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.
+		ColumnExpr("organization_member.*").
+		ColumnExpr("o.name AS organization_name").
+		Join("INNER JOIN organizations AS o").
+		JoinOn("o.id = organization_member.organization_id")
+}
+
+// GetOrganizationMember returns the membership of the user in the
+// organization, or sql.ErrNoRows when the user is not a member.
+func GetOrganizationMember(ctx context.Context, organizationID int64, userID string) (*OrganizationMember, error) {
+	member := new(OrganizationMember)
+	err := selectMembers(db.Bun.NewSelect().Model(member)).
+		Where("organization_member.organization_id = ?", organizationID).
+		Where("organization_member.user_id = ?", userID).
+		Scan(ctx)
+	return member, err
+}
+
+// GetUserMemberships returns the memberships of the user in all of their
+// organizations, ordered by the name of the organization.
+func GetUserMemberships(ctx context.Context, userID string) ([]OrganizationMember, error) {
+	var members []OrganizationMember
+	err := selectMembers(db.Bun.NewSelect().Model(&members)).
+		Where("organization_member.user_id = ?", userID).
+		Order("o.name", "organization_member.organization_id").
+		Scan(ctx)
+	return members, err
+}
+
+func GetOrganizationMembers(organizationID int64) ([]OrganizationMember, error) {
+	var members []OrganizationMember
+	err := db.Bun.NewSelect().
+		Model(&members).
+		Where("organization_id = ?", organizationID).
+		Order("created_at").
+		Scan(context.Background())
+	return members, err
+}
+
+func RenameOrganization(organizationID int64, name string) error {
+	_, err := db.Bun.NewUpdate().
+		Model((*Organization)(nil)).
+		Set("name = ?", name).
+		Where("id = ?", organizationID).
+		Exec(context.Background())
+	return err
+}
+
+// UpdateOrganizationMemberRole changes the role of the member. The last
+// owner can't be demoted.
+func UpdateOrganizationMemberRole(organizationID int64, userID string, role Role) error {
+	return changeOrganizationMember("updateOrganizationMemberRole", organizationID, userID, role != RoleOwner,
+		func(ctx context.Context, tx bun.Tx) (sql.Result, error) {
+			return tx.NewUpdate().
+				Model((*OrganizationMember)(nil)).
+				Set("role = ?", role).
+				Where("organization_id = ?", organizationID).
+				Where("user_id = ?", userID).
+				Exec(ctx)
+		})
+}
+
+// DeleteOrganizationMember removes the member from the organization. The
+// last owner can't be removed.
+func DeleteOrganizationMember(organizationID int64, userID string) error {
+	return changeOrganizationMember("deleteOrganizationMember", organizationID, userID, true,
+		func(ctx context.Context, tx bun.Tx) (sql.Result, error) {
+			return tx.NewDelete().
+				Model((*OrganizationMember)(nil)).
+				Where("organization_id = ?", organizationID).
+				Where("user_id = ?", userID).
+				Exec(ctx)
+		})
+}
+
+// changeOrganizationMember runs the change of the member while the owners of
+// the organization are locked. When removesOwner is set, the change fails
+// with ErrLastOwner if the member is the only owner.
+func changeOrganizationMember(query string, organizationID int64, userID string, removesOwner bool, change func(context.Context, bun.Tx) (sql.Result, error)) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var owners []string
+		err := tx.NewSelect().
+			Model((*OrganizationMember)(nil)).
+			Column("user_id").
+			Where("organization_id = ?", organizationID).
+			Where("role = ?", RoleOwner).
+			For("UPDATE").
+			Scan(ctx, &owners)
+		if err != nil {
+			return err
+		}
+		if removesOwner && len(owners) == 1 && owners[0] == userID {
+			return ErrLastOwner
+		}
+		res, err := change(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil && err != ErrLastOwner && err != sql.ErrNoRows {
+		logger.Log("error", "rollback transaction", "query", query, "err", err)
+	}
+	return err
+}
+
+// NewOrganizationInvitation generates an invitation of the email address to
+// the organization. It returns the token that should be sent to the invited
+// user together with the invitation to store.
+func NewOrganizationInvitation(organizationID int64, email string, role Role, invitedBy string, now time.Time) (string, *OrganizationInvitation, error) {
+	b := make([]byte, organizationTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(b)
+	invitation := &OrganizationInvitation{
+		OrganizationID: organizationID,
+		Email:          strings.ToLower(email),
+		Role:           role,
+		TokenHash:      hashInvitationToken(token),
+		InvitedBy:      invitedBy,
+		ExpiresAt:      now.Add(OrganizationInviteTTL),
+	}
+	return token, invitation, nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// InsertOrganizationInvitation stores the invitation and replaces the pending
+// invitation of the same email address, so only the latest one can be
+// accepted.
+func InsertOrganizationInvitation(invitation *OrganizationInvitation) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().
+			Model((*OrganizationInvitation)(nil)).
+			Where("organization_id = ?", invitation.OrganizationID).
+			Where("email = ?", invitation.Email).
+			Where("accepted_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(invitation).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		logger.Log("error", "rollback transaction", "query", "insertOrganizationInvitation", "err", err)
+	}
+	return err
+}
+
+// GetPendingInvitations returns the invitations of the organization that are
+// neither accepted nor expired.
+func GetPendingInvitations(organizationID int64) ([]OrganizationInvitation, error) {
+	var invitations []OrganizationInvitation
+	err := db.Bun.NewSelect().
+		Model(&invitations).
+		Where("organization_id = ?", organizationID).
+		Where("accepted_at IS NULL").
+		Where("expires_at > now()").
+		Order("created_at DESC").
+		Scan(context.Background())
+	return invitations, err
+}
+
+// GetPendingInvitation returns the pending invitation with the given (plain)
+// token together with the name of its organization.
+func GetPendingInvitation(token string) (*OrganizationInvitation, error) {
+	invitation := new(OrganizationInvitation)
+	err := db.Bun.NewSelect().
+		Model(invitation).
+		ColumnExpr("organization_invitation.*").
+		ColumnExpr("o.name AS organization_name").
+		Join("INNER JOIN organizations AS o").
+		JoinOn("o.id = organization_invitation.organization_id").
+		Where("organization_invitation.token_hash = ?", hashInvitationToken(token)).
+		Where("organization_invitation.accepted_at IS NULL").
+		Where("organization_invitation.expires_at > now()").
+		Scan(context.Background())
+	return invitation, err
+}
+
+// AcceptOrganizationInvitation adds the user to the organization of the
+// invitation. Users that already are a member keep their role, other users
+// can only join while they are a member of less than MaxOrganizations.
+func AcceptOrganizationInvitation(invitation *OrganizationInvitation, user *User) error {
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return ErrInvitationEmail
+	}
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var organizationIDs []int64
+		err := tx.NewSelect().
+			Model((*OrganizationMember)(nil)).
+			Column("organization_id").
+			Where("user_id = ?", user.ID).
+			For("UPDATE").
+			Scan(ctx, &organizationIDs)
+		if err != nil {
+			return err
+		}
+		isMember := false
+		for _, id := range organizationIDs {
+			if id == invitation.OrganizationID {
+				isMember = true
+			}
+		}
+		if !isMember && len(organizationIDs) >= MaxOrganizations {
+			return ErrTooManyOrganizations
+		}
+		res, err := tx.NewUpdate().
+			Model((*OrganizationInvitation)(nil)).
+			Set("accepted_at = now()").
+			Where("id = ?", invitation.ID).
+			Where("accepted_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		member := &OrganizationMember{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         user.ID,
+			Email:          user.Email,
+			Role:           invitation.Role,
+		}
+		_, err = tx.NewInsert().
+			Model(member).
+			On("CONFLICT (organization_id, user_id) DO NOTHING").
+			Exec(ctx)
+		return err
+	})
+	if err != nil && err != sql.ErrNoRows && err != ErrTooManyOrganizations {
+		logger.Log("error", "rollback transaction", "query", "acceptOrganizationInvitation", "err", err)
+	}
+	return err
+}
+
+func DeleteOrganizationInvitation(query fiber.Map) error {
+	builder := db.Bun.NewDelete().Model(&OrganizationInvitation{}).QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.DeleteQuery).Exec(context.Background())
+	return err
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/db/dbtest"
+	"github.com/anthdm/ssltracker/util"
+)
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role   Role
+		needed Role
+		can    bool
+	}{
+		{RoleOwner, RoleOwner, true},
+		{RoleOwner, RoleViewer, true},
+		{RoleAdmin, RoleOwner, false},
+		{RoleAdmin, RoleEditor, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleEditor, RoleEditor, true},
+		{RoleViewer, RoleEditor, false},
+		{RoleViewer, RoleViewer, true},
+		{Role("root"), RoleViewer, false},
+	}
+	for _, test := range tests {
+		if can := test.role.Can(test.needed); can != test.can {
+			t.Errorf("expected %s can %s to be %t", test.role, test.needed, test.can)
+		}
+	}
+}
+
+func TestIsValidRole(t *testing.T) {
+	for _, role := range Roles {
+		if !IsValidRole(string(role)) {
+			t.Errorf("expected %s to be valid", role)
+		}
+	}
+	if IsValidRole("") || IsValidRole("Owner") {
+		t.Fatal("expected unknown roles to be invalid")
+	}
+}
+
+func TestNewOrganizationInvitation(t *testing.T) {
+	now := time.Now()
+	token, invitation, err := NewOrganizationInvitation(1, "Jane@Acme.com", RoleEditor, "user", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invitation.Email != "jane@acme.com" || !invitation.ExpiresAt.Equal(now.Add(OrganizationInviteTTL)) {
+		t.Fatalf("unexpected invitation %+v", invitation)
+	}
+	if invitation.TokenHash == token || invitation.TokenHash != hashInvitationToken(token) {
+		t.Fatal("expected only the hash of the token to be stored")
+	}
+}
+
+func TestIntegrationOrganizationMembers(t *testing.T) {
+	setupIntegrationDB(t)
+	const otherUserID = "2f0c8d4e-6a1b-4c3d-8e9f-0a1b2c3d4e5f"
+	dbtest.CreateUser(t, otherUserID, "jane@certpulse.com")
+
+	if err := DeleteOrganizationMember(testOrganizationID, testUserID); err != ErrLastOwner {
+		t.Fatalf("expected the last owner not to be removed got %v", err)
+	}
+	if err := UpdateOrganizationMemberRole(testOrganizationID, testUserID, RoleAdmin); err != ErrLastOwner {
+		t.Fatalf("expected the last owner not to be demoted got %v", err)
+	}
+
+	token, invitation, err := NewOrganizationInvitation(testOrganizationID, "jane@certpulse.com", RoleViewer, testUserID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertOrganizationInvitation(invitation); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := GetPendingInvitation(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.OrganizationName != "test" {
+		t.Fatalf("expected the invitation to the test organization got %+v", pending)
+	}
+	if err := AcceptOrganizationInvitation(pending, &User{ID: testUserID, Email: "test@certpulse.com"}); err != ErrInvitationEmail {
+		t.Fatalf("expected the invitation of another email address to be refused got %v", err)
+	}
+	if err := AcceptOrganizationInvitation(pending, &User{ID: otherUserID, Email: "Jane@certpulse.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetPendingInvitation(token); err == nil || !util.IsErrNoRecords(err) {
+		t.Fatalf("expected the accepted invitation not to be pending got %v", err)
+	}
+	member, err := GetOrganizationMember(context.Background(), testOrganizationID, otherUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.Role != RoleViewer || member.OrganizationName != "test" {
+		t.Fatalf("unexpected member %+v", member)
+	}
+
+	if err := UpdateOrganizationMemberRole(testOrganizationID, otherUserID, RoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteOrganizationMember(testOrganizationID, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	memberships, err := GetUserMemberships(context.Background(), testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memberships) != 0 {
+		t.Fatalf("expected the user to have left the organization got %+v", memberships)
+	}
+	if err := DeleteOrganizationMember(testOrganizationID, testUserID); err == nil || !util.IsErrNoRecords(err) {
+		t.Fatalf("expected the former member not to be found got %v", err)
+	}
+}
+
+func TestIntegrationCreatePersonalOrganizationWithoutAccount(t *testing.T) {
+	dbtest.Setup(t)
+	dbtest.CreateUser(t, testUserID, "test@certpulse.com")
+	// Organizations created by the migration for users that never signed in
+	// have a member but no account.
+	ctx := context.Background()
+	org := &Organization{Name: "test@certpulse.com", CreatedBy: testUserID}
+	if _, err := db.Bun.NewInsert().Model(org).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	member := &OrganizationMember{OrganizationID: org.ID, UserID: testUserID, Email: "test@certpulse.com", Role: RoleOwner}
+	if _, err := db.Bun.NewInsert().Model(member).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{ID: testUserID, Email: "test@certpulse.com"}
+	for i := 0; i < 2; i++ {
+		member, err := CreatePersonalOrganizationIfNotExist(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member.OrganizationID != org.ID {
+			t.Fatalf("expected the existing organization %d got %d", org.ID, member.OrganizationID)
+		}
+	}
+	account, err := GetOrganizationAccount(ctx, org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Plan != PlanStarter || account.NotifyDefaultEmail != "test@certpulse.com" {
+		t.Fatalf("unexpected account %+v", account)
+	}
+}
+
+func TestIntegrationAcceptInvitationMaxOrganizations(t *testing.T) {
+	setupIntegrationDB(t)
+	const otherUserID = "2f0c8d4e-6a1b-4c3d-8e9f-0a1b2c3d4e5f"
+	dbtest.CreateUser(t, otherUserID, "jane@certpulse.com")
+	jane := &User{ID: otherUserID, Email: "jane@certpulse.com"}
+	for i := 0; i < MaxOrganizations; i++ {
+		if _, err := CreateOrganization(fmt.Sprintf("jane %d", i), jane); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invite := func(organizationID int64) *OrganizationInvitation {
+		token, invitation, err := NewOrganizationInvitation(organizationID, jane.Email, RoleViewer, testUserID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := InsertOrganizationInvitation(invitation); err != nil {
+			t.Fatal(err)
+		}
+		pending, err := GetPendingInvitation(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pending
+	}
+	if err := AcceptOrganizationInvitation(invite(testOrganizationID), jane); err != ErrTooManyOrganizations {
+		t.Fatalf("expected the invitation to exceed the organizations of the user got %v", err)
+	}
+	memberships, err := GetUserMemberships(context.Background(), otherUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AcceptOrganizationInvitation(invite(memberships[0].OrganizationID), jane); err != nil {
+		t.Fatalf("expected members to accept invitations to their organizations got %v", err)
+	}
+}
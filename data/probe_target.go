@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/uptrace/bun"
+)
+
+const DefaultProbePort = 443
+
+// ProbeTarget is the endpoint a tracking polls. Trackings of different
+// accounts that poll the same endpoint share a single probe target, so the
+// pulser only needs to do a single handshake for all of them.
+type ProbeTarget struct {
+	ID   int64 `bun:"id,pk,autoincrement"`
+	Host string
+	Port int
+	SNI  string `bun:"sni"`
+	// Options are the protocol options the probe is made with, for example
+	// the minimum TLS version ("tls1.2", "tls1.3"). Empty means the defaults.
+	Options string
+}
+
+// DefaultProbeTarget returns the target of a tracking that polls the domain
+// on the default HTTPS port.
+func DefaultProbeTarget(domain string) ProbeTarget {
+	return ProbeTarget{
+		Host: domain,
+		Port: DefaultProbePort,
+		SNI:  domain,
+	}
+}
+
+// Address returns the host:port address of the target.
+func (t ProbeTarget) Address() string {
+	port := t.Port
+	if port == 0 {
+		port = DefaultProbePort
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(port))
+}
+
+// Name returns the name trackings of the target are shown with, the host
+// followed by the port when it is not the default port.
+func (t ProbeTarget) Name() string {
+	if t.Port == 0 || t.Port == DefaultProbePort {
+		return t.Host
+	}
+	return t.Address()
+}
+
+// UpsertProbeTarget returns the id of the probe target, creating it when no
+// tracking subscribed to it yet.
+func UpsertProbeTarget(target ProbeTarget) (int64, error) {
+	return upsertProbeTarget(context.Background(), db.Bun, target)
+}
+
+func upsertProbeTarget(ctx context.Context, idb bun.IDB, target ProbeTarget) (int64, error) {
+	if target.Port == 0 {
+		target.Port = DefaultProbePort
+	}
+	if len(target.SNI) == 0 {
+		target.SNI = target.Host
+	}
+	// DO UPDATE instead of DO NOTHING so the id of the existing target is
+	// returned as well.
+	var id int64
+	err := idb.NewInsert().
+		Model(&target).
+		On("CONFLICT (host, port, sni, options) DO UPDATE").
+		Set("host = EXCLUDED.host").
+		Returning("id").
+		Scan(ctx, &id)
+	return id, err
+}
+
+// GetProbeTargets returns the probe targets with the given ids by id.
+func GetProbeTargets(ids []int64) (map[int64]ProbeTarget, error) {
+	targets := make(map[int64]ProbeTarget, len(ids))
+	if len(ids) == 0 {
+		return targets, nil
+	}
+	var rows []ProbeTarget
+	err := db.Bun.NewSelect().
+		Model(&rows).
+		Where("id IN (?)", bun.In(ids)).
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range rows {
+		targets[target.ID] = target
+	}
+	return targets, nil
+}
@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MaxStatusPages          = 10
+	MaxStatusPageTrackings  = 50
+	MaxStatusPageSlugLength = 64
+	MaxStatusPageTitle      = 80
+)
+
+// ErrStatusPageSlugTaken is returned when another status page is already
+// published at the slug.
+var ErrStatusPageSlugTaken = errors.New("status page slug is taken")
+
+// A slug is one or more path segments, so pages can be published at a custom
+// path like acme/production.
+var statusPageSlugRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*(/[a-z0-9][a-z0-9-]*)*$`)
+
+// StatusPage publishes the status of selected trackings of the organization at
+// /status/<slug>. Pages with a password are only shown after it is entered.
+type StatusPage struct {
+	ID             int64 `bun:"id,pk,autoincrement"`
+	UserID         string
+	OrganizationID int64
+	Slug           string
+	Title          string
+	PasswordHash   string    `bun:",nullzero"`
+	CreatedAt      time.Time `bun:",nullzero,default:now()"`
+}
+
+// NormalizeStatusPageSlug returns the slug in lower case without surrounding
+// spaces and slashes and whether it is a valid slug.
+func NormalizeStatusPageSlug(slug string) (string, bool) {
+	slug = strings.Trim(strings.ToLower(strings.TrimSpace(slug)), "/")
+	return slug, len(slug) <= MaxStatusPageSlugLength && statusPageSlugRegex.MatchString(slug)
+}
+
+func (p StatusPage) IsProtected() bool {
+	return len(p.PasswordHash) > 0
+}
+
+// SetPassword protects the page with the password. An empty password makes
+// the page public.
+func (p *StatusPage) SetPassword(password string) error {
+	if len(password) == 0 {
+		p.PasswordHash = ""
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	p.PasswordHash = string(hash)
+	return nil
+}
+
+func (p StatusPage) CheckPassword(password string) bool {
+	return p.IsProtected() && bcrypt.CompareHashAndPassword([]byte(p.PasswordHash), []byte(password)) == nil
+}
+
+// AccessToken is handed to visitors that entered the password of the page.
+// It is derived from the password hash, so changing the password revokes
+// all tokens.
+func (p StatusPage) AccessToken() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", p.ID, p.PasswordHash)))
+	return hex.EncodeToString(sum[:])
+}
+
+type StatusPageTracking struct {
+	StatusPageID     int64 `bun:",pk"`
+	DomainTrackingID int64 `bun:",pk"`
+	Position         int
+}
+
+func GetStatusPages(organizationID int64) ([]StatusPage, error) {
+	var pages []StatusPage
+	err := db.Bun.NewSelect().
+		Model(&pages).
+		Where("organization_id = ?", organizationID).
+		Order("slug").
+		Scan(context.Background())
+	return pages, err
+}
+
+func GetStatusPage(query fiber.Map) (*StatusPage, error) {
+	page := new(StatusPage)
+	builder := db.Bun.NewSelect().Model(page).QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	err := builder.Unwrap().(*bun.SelectQuery).Scan(context.Background())
+	return page, err
+}
+
+func CountStatusPages(organizationID int64) (int, error) {
+	return db.Bun.NewSelect().
+		Model((*StatusPage)(nil)).
+		Where("organization_id = ?", organizationID).
+		Count(context.Background())
+}
+
+// GetStatusPageTrackings returns the trackings shown on the page in the order
+// they were selected.
+func GetStatusPageTrackings(pageID int64) ([]DomainTracking, error) {
+	var trackings []DomainTracking
+	err := db.Bun.NewSelect().
+		Model(&trackings).
+		Join("INNER JOIN status_page_trackings AS spt").
+		JoinOn("spt.domain_tracking_id = domain_tracking.id").
+		Where("spt.status_page_id = ?", pageID).
+		Order("spt.position").
+		Scan(context.Background())
+	return trackings, err
+}
+
+// InsertStatusPage creates the page with the given trackings of its
+// organization.
+func InsertStatusPage(page *StatusPage, trackingIDs []int64) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(page).Exec(ctx); err != nil {
+			return err
+		}
+		return setStatusPageTrackings(ctx, tx, page, trackingIDs)
+	})
+	return statusPageError("insertStatusPage", err)
+}
+
+// UpdateStatusPage updates the slug, title and password of the page and
+// replaces its trackings.
+func UpdateStatusPage(page *StatusPage, trackingIDs []int64) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model(page).
+			Column("slug", "title", "password_hash").
+			Where("id = ?", page.ID).
+			Where("organization_id = ?", page.OrganizationID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().
+			Model((*StatusPageTracking)(nil)).
+			Where("status_page_id = ?", page.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return setStatusPageTrackings(ctx, tx, page, trackingIDs)
+	})
+	return statusPageError("updateStatusPage", err)
+}
+
+func DeleteStatusPage(query fiber.Map) error {
+	builder := db.Bun.NewDelete().Model(&StatusPage{}).QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.DeleteQuery).Exec(context.Background())
+	return err
+}
+
+// setStatusPageTrackings adds the trackings to the page, ids of trackings of
+// other organizations are ignored.
+func setStatusPageTrackings(ctx context.Context, idb bun.IDB, page *StatusPage, trackingIDs []int64) error {
+	if len(trackingIDs) == 0 {
+		return nil
+	}
+	_, err := idb.NewRaw(`
+		INSERT INTO status_page_trackings (status_page_id, domain_tracking_id, position)
+		SELECT ?, dt.id, array_position(?::int[], dt.id) FROM domain_trackings AS dt
+		WHERE dt.organization_id = ? AND dt.id IN (?)
+		ON CONFLICT DO NOTHING`, page.ID, pgdialect.Array(trackingIDs), page.OrganizationID, bun.In(trackingIDs)).
+		Exec(ctx)
+	return err
+}
+
+// statusPageError turns a unique violation of the slug into
+// ErrStatusPageSlugTaken and logs other errors of the transaction.
+func statusPageError(query string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == "23505" {
+		return ErrStatusPageSlugTaken
+	}
+	logger.Log("error", "rollback transaction", "query", query, "err", err)
+	return err
+}
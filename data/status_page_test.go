@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNormalizeStatusPageSlug(t *testing.T) {
+	tests := map[string]bool{
+		"acme":             true,
+		" /Acme/Prod/ ":    true,
+		"acme-1/eu-west-2": true,
+		"acme//prod":       false,
+		"-acme":            false,
+		"acme prod":        false,
+		"":                 false,
+	}
+	for slug, valid := range tests {
+		if _, ok := NormalizeStatusPageSlug(slug); ok != valid {
+			t.Fatalf("expected %q to be valid: %v", slug, valid)
+		}
+	}
+	if slug, _ := NormalizeStatusPageSlug(" /Acme/Prod/ "); slug != "acme/prod" {
+		t.Fatalf("expected acme/prod got %s", slug)
+	}
+}
+
+func TestStatusPagePassword(t *testing.T) {
+	page := StatusPage{ID: 1}
+	if page.IsProtected() || page.CheckPassword("") {
+		t.Fatal("expected a page without password to be public")
+	}
+	if err := page.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !page.CheckPassword("secret") || page.CheckPassword("wrong") {
+		t.Fatal("expected only the password to unlock the page")
+	}
+	token := page.AccessToken()
+	if err := page.SetPassword("other"); err != nil {
+		t.Fatal(err)
+	}
+	if page.AccessToken() == token {
+		t.Fatal("expected a new password to revoke the access tokens")
+	}
+}
+
+func TestIntegrationStatusPages(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 2)
+
+	trackings, err := GetDomainTrackings(context.Background(), fiber.Map{"organization_id": testOrganizationID}, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := &StatusPage{UserID: testUserID, OrganizationID: testOrganizationID, Slug: "acme/prod", Title: "Acme"}
+	// Trackings that don't belong to the user are ignored.
+	ids := []int64{trackings[1].ID, 999999, trackings[0].ID}
+	if err := InsertStatusPage(page, ids); err != nil {
+		t.Fatal(err)
+	}
+	shown, err := GetStatusPageTrackings(page.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shown) != 2 || shown[0].ID != trackings[1].ID {
+		t.Fatalf("expected the 2 trackings in the selected order got %+v", shown)
+	}
+
+	other := &StatusPage{UserID: testUserID, OrganizationID: testOrganizationID, Slug: "acme/prod", Title: "Other"}
+	if err := InsertStatusPage(other, nil); err != ErrStatusPageSlugTaken {
+		t.Fatalf("expected %s got %v", ErrStatusPageSlugTaken, err)
+	}
+}
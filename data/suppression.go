@@ -0,0 +1,213 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+)
+
+const (
+	NotificationKindStatus  = "status"
+	NotificationKindExpires = "expires"
+)
+
+const (
+	SuppressReasonMuted       = "muted"
+	SuppressReasonSnoozed     = "snoozed"
+	SuppressReasonMaintenance = "maintenance window"
+	SuppressReasonQuietHours  = "quiet hours"
+)
+
+// EveryDay can be used as the weekday of a maintenance window that
+// recurs every day of the week.
+const EveryDay = -1
+
+type MaintenanceWindow struct {
+	ID              int64 `bun:"id,pk,autoincrement"`
+	UserID          string
+	OrganizationID  int64
+	Description     string
+	Weekday         int
+	StartsAt        string
+	DurationMinutes int
+	Timezone        string
+	// Tag limits the window to the trackings with the tag. Windows without
+	// a tag apply to all trackings of the organization.
+	Tag string `bun:",nullzero"`
+}
+
+// AppliesTo returns true if the window applies to a tracking with the given
+// tags.
+func (w MaintenanceWindow) AppliesTo(tags []string) bool {
+	return len(w.Tag) == 0 || hasTag(tags, w.Tag)
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns true if the given time falls inside the window. Windows that
+// start late in the evening are allowed to run over into the next day.
+func (w MaintenanceWindow) Active(now time.Time) bool {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	startMinutes, err := ParseClock(w.StartsAt)
+	if err != nil {
+		return false
+	}
+	var (
+		local    = now.In(loc)
+		duration = time.Minute * time.Duration(w.DurationMinutes)
+	)
+	for _, offset := range []int{0, -1} {
+		day := local.AddDate(0, 0, offset)
+		if w.Weekday != EveryDay && int(day.Weekday()) != w.Weekday {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), startMinutes/60, startMinutes%60, 0, 0, loc)
+		if !local.Before(start) && local.Before(start.Add(duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w MaintenanceWindow) WeekdayName() string {
+	if w.Weekday == EveryDay {
+		return "every day"
+	}
+	return time.Weekday(w.Weekday).String()
+}
+
+type SuppressedNotification struct {
+	bun.BaseModel `bun:"table:suppressed_notifications,alias:sn"`
+
+	ID               int64 `bun:"id,pk,autoincrement"`
+	UserID           string
+	OrganizationID   int64
+	DomainTrackingID int64
+	Kind             string
+	Reason           string
+	CreatedAt        time.Time `bun:",nullzero,default:now()"`
+	DomainName       string    `bun:",scanonly"`
+}
+
+// InQuietHours returns true if the account has quiet hours configured and the
+// given time falls within them, in the timezone of the account.
+func (a Account) InQuietHours(now time.Time) bool {
+	if len(a.QuietHoursStart) == 0 || len(a.QuietHoursEnd) == 0 {
+		return false
+	}
+	start, err := ParseClock(a.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(a.QuietHoursEnd)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	current := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return current >= start && current < end
+	}
+	// Quiet hours that run over midnight (22:00 - 07:00).
+	return current >= start || current < end
+}
+
+func (t DomainTracking) IsSnoozed(now time.Time) bool {
+	return now.Before(t.SnoozedUntil)
+}
+
+// SuppressReason returns the reason why a notification of the given kind for
+// the tracking should not be sent right now. An empty string means the
+// notification can be sent. Status notifications are considered critical and
+// are not delayed by the quiet hours of the account.
+func SuppressReason(tracking TrackingAndAccount, windows []MaintenanceWindow, kind string, now time.Time) string {
+	if tracking.DomainTracking.Muted {
+		return SuppressReasonMuted
+	}
+	if tracking.DomainTracking.IsSnoozed(now) {
+		return SuppressReasonSnoozed
+	}
+	for _, window := range windows {
+		if window.AppliesTo(tracking.DomainTracking.Tags) && window.Active(now) {
+			return SuppressReasonMaintenance
+		}
+	}
+	if kind != NotificationKindStatus && tracking.Account.InQuietHours(now) {
+		return SuppressReasonQuietHours
+	}
+	return ""
+}
+
+// ParseClock parses a "15:04" formatted time of day into the number of
+// minutes since midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func GetMaintenanceWindows(organizationID int64) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	err := db.Bun.NewSelect().
+		Model(&windows).
+		Where("organization_id = ?", organizationID).
+		Order("id").
+		Scan(context.Background())
+	return windows, err
+}
+
+// GetAllMaintenanceWindows returns all the maintenance windows grouped by
+// the organization they belong to.
+func GetAllMaintenanceWindows() (map[int64][]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	if err := db.Bun.NewSelect().Model(&windows).Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	byOrganization := make(map[int64][]MaintenanceWindow)
+	for _, window := range windows {
+		byOrganization[window.OrganizationID] = append(byOrganization[window.OrganizationID], window)
+	}
+	return byOrganization, nil
+}
+
+func InsertMaintenanceWindow(window *MaintenanceWindow) error {
+	_, err := db.Bun.NewInsert().Model(window).Exec(context.Background())
+	return err
+}
+
+func DeleteMaintenanceWindow(query fiber.Map) error {
+	builder := db.Bun.NewDelete().Model(&MaintenanceWindow{}).QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.DeleteQuery).Exec(context.Background())
+	return err
+}
+
+func UpdateDomainTrackingSnooze(query fiber.Map, until time.Time) error {
+	builder := db.Bun.NewUpdate().
+		Model(&DomainTracking{}).
+		Set("snoozed_until = ?", bun.NullTime{Time: until}).
+		QueryBuilder()
+	builder = db.WhereMap(builder, query)
+	_, err := builder.Unwrap().(*bun.UpdateQuery).Exec(context.Background())
+	return err
+}
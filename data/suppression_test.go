@@ -0,0 +1,118 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	window := MaintenanceWindow{
+		Weekday:         int(time.Saturday),
+		StartsAt:        "23:00",
+		DurationMinutes: 120,
+		Timezone:        "UTC",
+	}
+	// 2023-07-08 is a Saturday.
+	if !window.Active(time.Date(2023, 7, 8, 23, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be active on saturday 23:30")
+	}
+	if !window.Active(time.Date(2023, 7, 9, 0, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected window to run over into sunday 00:30")
+	}
+	if window.Active(time.Date(2023, 7, 9, 1, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be over on sunday 01:00")
+	}
+	if window.Active(time.Date(2023, 7, 7, 23, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be inactive on friday")
+	}
+}
+
+func TestMaintenanceWindowTimezone(t *testing.T) {
+	window := MaintenanceWindow{
+		Weekday:         EveryDay,
+		StartsAt:        "02:00",
+		DurationMinutes: 60,
+		Timezone:        "America/New_York",
+	}
+	// 02:30 in New York during daylight saving time.
+	if !window.Active(time.Date(2023, 7, 8, 6, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be active in the timezone of the window")
+	}
+	if window.Active(time.Date(2023, 7, 8, 2, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be inactive at 02:30 UTC")
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	account := Account{
+		Timezone:        "UTC",
+		QuietHoursStart: "22:00",
+		QuietHoursEnd:   "07:00",
+	}
+	if !account.InQuietHours(time.Date(2023, 7, 8, 23, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected 23:00 to be in quiet hours")
+	}
+	if !account.InQuietHours(time.Date(2023, 7, 8, 6, 59, 0, 0, time.UTC)) {
+		t.Fatal("expected 06:59 to be in quiet hours")
+	}
+	if account.InQuietHours(time.Date(2023, 7, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected 12:00 not to be in quiet hours")
+	}
+	if (Account{}).InQuietHours(time.Now()) {
+		t.Fatal("expected account without quiet hours to never be in quiet hours")
+	}
+}
+
+func TestSuppressReason(t *testing.T) {
+	var (
+		now      = time.Date(2023, 7, 8, 23, 0, 0, 0, time.UTC)
+		tracking = TrackingAndAccount{
+			Account: Account{
+				Timezone:        "UTC",
+				QuietHoursStart: "22:00",
+				QuietHoursEnd:   "07:00",
+			},
+		}
+	)
+	if reason := SuppressReason(tracking, nil, NotificationKindStatus, now); reason != "" {
+		t.Fatalf("expected status notifications to bypass quiet hours got %s", reason)
+	}
+	if reason := SuppressReason(tracking, nil, NotificationKindExpires, now); reason != SuppressReasonQuietHours {
+		t.Fatalf("expected reason to be %s got %s", SuppressReasonQuietHours, reason)
+	}
+	tracking.SnoozedUntil = now.AddDate(0, 0, 1)
+	if reason := SuppressReason(tracking, nil, NotificationKindStatus, now); reason != SuppressReasonSnoozed {
+		t.Fatalf("expected reason to be %s got %s", SuppressReasonSnoozed, reason)
+	}
+	tracking.Muted = true
+	if reason := SuppressReason(tracking, nil, NotificationKindStatus, now); reason != SuppressReasonMuted {
+		t.Fatalf("expected reason to be %s got %s", SuppressReasonMuted, reason)
+	}
+}
+
+func TestSuppressReasonTaggedWindow(t *testing.T) {
+	var (
+		now    = time.Date(2023, 7, 8, 3, 30, 0, 0, time.UTC)
+		window = MaintenanceWindow{
+			Weekday:         EveryDay,
+			StartsAt:        "03:00",
+			DurationMinutes: 60,
+			Timezone:        "UTC",
+			Tag:             "payments",
+		}
+		tracking = TrackingAndAccount{}
+		windows  = []MaintenanceWindow{window}
+	)
+	if reason := SuppressReason(tracking, windows, NotificationKindStatus, now); reason != "" {
+		t.Fatalf("expected the window of another tag to not suppress got %s", reason)
+	}
+	tracking.Tags = []string{"prod", "payments"}
+	if reason := SuppressReason(tracking, windows, NotificationKindStatus, now); reason != SuppressReasonMaintenance {
+		t.Fatalf("expected reason to be %s got %s", SuppressReasonMaintenance, reason)
+	}
+	windows[0].Tag = ""
+	tracking.Tags = nil
+	if reason := SuppressReason(tracking, windows, NotificationKindStatus, now); reason != SuppressReasonMaintenance {
+		t.Fatalf("expected windows without a tag to apply to all trackings got %q", reason)
+	}
+}
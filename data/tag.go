@@ -0,0 +1,226 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/uptrace/bun"
+)
+
+const (
+	MaxTrackingTags = 10
+	MaxTagLength    = 32
+)
+
+var tagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]*$`)
+
+// Tag is a label of the organization that can be attached to any number of
+// its trackings.
+type Tag struct {
+	ID             int64 `bun:"id,pk,autoincrement"`
+	OrganizationID int64
+	Name           string
+	CreatedAt      time.Time `bun:",nullzero,default:now()"`
+}
+
+type DomainTrackingTag struct {
+	DomainTrackingID int64 `bun:",pk"`
+	TagID            int64 `bun:",pk"`
+}
+
+// NormalizeTag returns the tag in lower case without surrounding spaces and
+// whether it is a valid tag. Projects and environments follow the same rules.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return tag, len(tag) <= MaxTagLength && tagRegex.MatchString(tag)
+}
+
+// NormalizeTags normalizes the tags, dropping empty and duplicate ones.
+func NormalizeTags(tags []string) ([]string, error) {
+	var (
+		normalized = make([]string, 0, len(tags))
+		seen       = map[string]bool{}
+	)
+	for _, tag := range tags {
+		if len(strings.TrimSpace(tag)) == 0 {
+			continue
+		}
+		tag, ok := NormalizeTag(tag)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a valid tag, use up to %d letters, digits and - _ . :", tag, MaxTagLength)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTrackingTags {
+		return nil, fmt.Errorf("a tracking can have at most %d tags", MaxTrackingTags)
+	}
+	return normalized, nil
+}
+
+// GetOrganizationTags returns the names of the tags that are attached to at
+// least one tracking of the organization.
+func GetOrganizationTags(ctx context.Context, organizationID int64) ([]string, error) {
+	names := []string{}
+	err := db.Bun.NewSelect().
+		Model((*Tag)(nil)).
+		Column("name").
+		Where("organization_id = ?", organizationID).
+		Where("EXISTS (SELECT 1 FROM domain_tracking_tags AS dtt WHERE dtt.tag_id = tag.id)").
+		Order("name").
+		Scan(ctx, &names)
+	return names, err
+}
+
+// GetOrganizationTrackingGroups returns the projects and environments the
+// trackings of the organization are grouped in.
+func GetOrganizationTrackingGroups(ctx context.Context, organizationID int64) (projects []string, environments []string, err error) {
+	projects, err = distinctTrackingValues(ctx, organizationID, "project")
+	if err != nil {
+		return nil, nil, err
+	}
+	environments, err = distinctTrackingValues(ctx, organizationID, "environment")
+	return projects, environments, err
+}
+
+func distinctTrackingValues(ctx context.Context, organizationID int64, column string) ([]string, error) {
+	values := []string{}
+	err := db.Bun.NewSelect().
+		Model((*DomainTracking)(nil)).
+		Distinct().
+		Column(column).
+		Where("organization_id = ?", organizationID).
+		Where("? IS NOT NULL", bun.Ident(column)).
+		Order(column).
+		Scan(ctx, &values)
+	return values, err
+}
+
+// GetTrackingTags returns the tag names of the given trackings by tracking id.
+func GetTrackingTags(ctx context.Context, ids []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string, len(ids))
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	var rows []struct {
+		DomainTrackingID int64
+		Name             string
+	}
+	err := db.Bun.NewSelect().
+		ColumnExpr("dtt.domain_tracking_id, t.name").
+		TableExpr("domain_tracking_tags AS dtt").
+		Join("INNER JOIN tags AS t").
+		JoinOn("t.id = dtt.tag_id").
+		Where("dtt.domain_tracking_id IN (?)", bun.In(ids)).
+		Order("t.name").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tags[row.DomainTrackingID] = append(tags[row.DomainTrackingID], row.Name)
+	}
+	return tags, nil
+}
+
+// LoadTrackingTags sets the tags of the given trackings.
+func LoadTrackingTags(ctx context.Context, trackings []DomainTracking) error {
+	ids := make([]int64, len(trackings))
+	for i, tracking := range trackings {
+		ids[i] = tracking.ID
+	}
+	tags, err := GetTrackingTags(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range trackings {
+		trackings[i].Tags = tags[trackings[i].ID]
+	}
+	return nil
+}
+
+// UpdateTrackingLabels replaces the tags, project and environment of the
+// tracking of the organization.
+func UpdateTrackingLabels(organizationID int64, id int64, tags []string, project string, environment string) error {
+	ctx := context.Background()
+	err := db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model((*DomainTracking)(nil)).
+			Set("project = NULLIF(?, '')", project).
+			Set("environment = NULLIF(?, '')", environment).
+			Where("organization_id = ?", organizationID).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.NewDelete().
+			Model((*DomainTrackingTag)(nil)).
+			Where("domain_tracking_id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return addTrackingTags(ctx, tx, organizationID, []int64{id}, tags)
+	})
+	if err != nil && err != sql.ErrNoRows {
+		logger.Log("error", "rollback transaction", "query", "updateTrackingLabels", "err", err)
+	}
+	return err
+}
+
+func addTrackingTags(ctx context.Context, idb bun.IDB, organizationID int64, ids []int64, names []string) error {
+	if len(ids) == 0 || len(names) == 0 {
+		return nil
+	}
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i] = Tag{OrganizationID: organizationID, Name: name}
+	}
+	// DO UPDATE instead of DO NOTHING so the ids of the existing tags are
+	// returned as well.
+	err := idb.NewInsert().
+		Model(&tags).
+		On("CONFLICT (organization_id, name) DO UPDATE").
+		Set("name = EXCLUDED.name").
+		Returning("id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	tagIDs := make([]int64, len(tags))
+	for i, tag := range tags {
+		tagIDs[i] = tag.ID
+	}
+	_, err = idb.NewRaw(`
+		INSERT INTO domain_tracking_tags (domain_tracking_id, tag_id)
+		SELECT dt.id, t.id FROM domain_trackings AS dt, tags AS t
+		WHERE dt.organization_id = ? AND dt.id IN (?) AND t.id IN (?)
+		ON CONFLICT DO NOTHING`, organizationID, bun.In(ids), bun.In(tagIDs)).
+		Exec(ctx)
+	return err
+}
+
+func removeTrackingTags(ctx context.Context, idb bun.IDB, organizationID int64, ids []int64, names []string) error {
+	if len(ids) == 0 || len(names) == 0 {
+		return nil
+	}
+	_, err := idb.NewDelete().
+		Model((*DomainTrackingTag)(nil)).
+		Where("domain_tracking_id IN (SELECT id FROM domain_trackings WHERE organization_id = ? AND id IN (?))", organizationID, bun.In(ids)).
+		Where("tag_id IN (SELECT id FROM tags WHERE organization_id = ? AND name IN (?))", organizationID, bun.In(names)).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Prod", "prod", "", "eu-west-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != "prod" || tags[1] != "eu-west-1" {
+		t.Fatalf("expected the tags to be normalized without duplicates got %v", tags)
+	}
+	if _, err := NormalizeTags([]string{"not a tag"}); err == nil {
+		t.Fatal("expected an error for a tag with spaces")
+	}
+}
+
+func TestIntegrationTrackingTags(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 3)
+
+	trackings, err := GetDomainTrackings(context.Background(), fiber.Map{"organization_id": testOrganizationID}, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int64{trackings[0].ID, trackings[1].ID}
+	for _, tag := range []string{"prod", "payments"} {
+		if err := ApplyBulkAction(testOrganizationID, ids, BulkAction{Action: BulkTag, Tag: tag}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagged, err := GetDomainTrackings(context.Background(), fiber.Map{"organization_id": testOrganizationID, FilterTag: "prod"}, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagged) != 2 {
+		t.Fatalf("expected 2 trackings tagged prod got %d", len(tagged))
+	}
+
+	if err := ApplyBulkAction(testOrganizationID, ids[:1], BulkAction{Action: BulkUntag, Tag: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateTrackingLabels(testOrganizationID, ids[1], []string{"staging"}, "billing", ""); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := GetTrackingTags(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags[ids[0]]) != 1 || tags[ids[0]][0] != "payments" {
+		t.Fatalf("expected only the payments tag to be left got %v", tags[ids[0]])
+	}
+	if len(tags[ids[1]]) != 1 || tags[ids[1]][0] != "staging" {
+		t.Fatalf("expected the tags to be replaced got %v", tags[ids[1]])
+	}
+	projects, _, err := GetOrganizationTrackingGroups(context.Background(), testOrganizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0] != "billing" {
+		t.Fatalf("expected the billing project got %v", projects)
+	}
+	userTags, err := GetOrganizationTags(context.Background(), testOrganizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userTags) != 2 {
+		t.Fatalf("expected the tags in use to be payments and staging got %v", userTags)
+	}
+}
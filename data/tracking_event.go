@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// trackingEventsChannel is the Postgres channel the poll results are published
+// on. The pulser and the web app share the database, so the web app can push
+// the results to the browsers as soon as they are saved.
+const trackingEventsChannel = "tracking_events"
+
+// TrackingEvent is published whenever a new poll result of a tracking is
+// saved. It holds what the tracking list and page need to update in place.
+type TrackingEvent struct {
+	ID             int64     `json:"id"`
+	OrganizationID int64     `json:"organizationId"`
+	Status         string    `json:"status"`
+	Expires        time.Time `json:"expires"`
+	Latency        int       `json:"latency"`
+	LastPollAt     time.Time `json:"lastPollAt"`
+}
+
+// NewTrackingEvent returns the event of the last poll of the tracking.
+func NewTrackingEvent(tracking DomainTracking) TrackingEvent {
+	return TrackingEvent{
+		ID:             tracking.ID,
+		OrganizationID: tracking.OrganizationID,
+		Status:         tracking.Status,
+		Expires:        tracking.Expires,
+		Latency:        tracking.Latency,
+		LastPollAt:     tracking.LastPollAt,
+	}
+}
+
+// publishTrackingEvents publishes an event for each of the trackings. Inside
+// a transaction the events are only delivered once it commits.
+func publishTrackingEvents(ctx context.Context, idb bun.IDB, trackings []DomainTracking) error {
+	if len(trackings) == 0 {
+		return nil
+	}
+	payloads := make([]string, len(trackings))
+	for i, tracking := range trackings {
+		b, err := json.Marshal(NewTrackingEvent(tracking))
+		if err != nil {
+			return err
+		}
+		payloads[i] = string(b)
+	}
+	_, err := idb.NewRaw("SELECT pg_notify(?, payload) FROM unnest(?::text[]) AS payload",
+		trackingEventsChannel, pgdialect.Array(payloads)).
+		Exec(ctx)
+	return err
+}
+
+// ListenTrackingEvents calls handle for every tracking event until the context
+// is done. The listener reconnects to the database on its own when the
+// connection is lost.
+func ListenTrackingEvents(ctx context.Context, handle func(TrackingEvent)) error {
+	ln := pgdriver.NewListener(db.Bun)
+	defer ln.Close()
+	if err := ln.Listen(ctx, trackingEventsChannel); err != nil {
+		return err
+	}
+	notifications := ln.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case notification, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			var event TrackingEvent
+			if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+				logger.Log("error", "invalid tracking event", "payload", notification.Payload, "err", err)
+				continue
+			}
+			handle(event)
+		}
+	}
+}
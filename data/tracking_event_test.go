@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+func TestIntegrationPublishTrackingEvents(t *testing.T) {
+	setupIntegrationDB(t)
+	insertDueTrackings(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	ln := pgdriver.NewListener(db.Bun)
+	defer ln.Close()
+	if err := ln.Listen(ctx, trackingEventsChannel); err != nil {
+		t.Fatal(err)
+	}
+
+	tracking, err := GetDomainTracking(context.Background(), fiber.Map{"organization_id": testOrganizationID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracking.Status = StatusOffline
+	tracking.Latency = 42
+	if err := SavePollResult(*tracking); err != nil {
+		t.Fatal(err)
+	}
+
+	_, payload, err := ln.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event TrackingEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != tracking.ID || event.OrganizationID != testOrganizationID {
+		t.Fatalf("expected an event of tracking %d got %+v", tracking.ID, event)
+	}
+	if event.Status != StatusOffline || event.Latency != 42 {
+		t.Fatalf("expected the saved poll result got %+v", event)
+	}
+}
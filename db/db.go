@@ -12,17 +12,23 @@ import (
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
 	"github.com/uptrace/bun/extra/bundebug"
+	"github.com/uptrace/bun/extra/bunotel"
 )
 
 var Bun *bun.DB
 
 func Init() {
+	Open(fmt.Sprintf("postgres://postgres:%s%s", os.Getenv("DB_PASSWORD"), os.Getenv("DB_URI")))
+}
+
+// Open connects Bun to the database with the given DSN.
+func Open(dsn string) {
 	var (
-		uri     = fmt.Sprintf("postgres://postgres:%s%s", os.Getenv("DB_PASSWORD"), os.Getenv("DB_URI"))
-		sqldb   = sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(uri)))
+		sqldb   = sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
 		verbose = false
 	)
 	Bun = bun.NewDB(sqldb, pgdialect.New())
+	Bun.AddQueryHook(bunotel.NewQueryHook(bunotel.WithDBName("postgres")))
 	if verbose {
 		Bun.AddQueryHook(bundebug.NewQueryHook(bundebug.WithVerbose(true)))
 	}
@@ -0,0 +1,6 @@
+DROP TABLE suppressed_notifications;
+DROP TABLE maintenance_windows;
+ALTER TABLE domain_trackings DROP COLUMN snoozed_until;
+ALTER TABLE accounts DROP COLUMN quiet_hours_end;
+ALTER TABLE accounts DROP COLUMN quiet_hours_start;
+ALTER TABLE accounts DROP COLUMN timezone;
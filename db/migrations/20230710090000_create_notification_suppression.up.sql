@@ -0,0 +1,27 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS quiet_hours_start TEXT;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS quiet_hours_end TEXT;
+
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS maintenance_windows(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   description TEXT,
+   weekday INT NOT NULL DEFAULT -1,
+   starts_at TEXT NOT NULL,
+   duration_minutes INT NOT NULL,
+   timezone TEXT NOT NULL DEFAULT 'UTC',
+   FOREIGN KEY (user_id) REFERENCES auth.users (id)
+);
+
+CREATE TABLE IF NOT EXISTS suppressed_notifications(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   domain_tracking_id INT NOT NULL,
+   kind TEXT NOT NULL,
+   reason TEXT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   FOREIGN KEY (user_id) REFERENCES auth.users (id),
+   FOREIGN KEY (domain_tracking_id) REFERENCES domain_trackings (id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+ALTER TABLE domain_trackings DROP COLUMN renewed_at;
+ALTER TABLE domain_trackings DROP COLUMN status_changed_at;
+
+ALTER TABLE accounts DROP COLUMN digest_sent_at;
+ALTER TABLE accounts DROP COLUMN digest_hour;
+ALTER TABLE accounts DROP COLUMN digest_weekday;
+ALTER TABLE accounts DROP COLUMN digest_enabled;
@@ -0,0 +1,7 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS digest_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS digest_weekday INT NOT NULL DEFAULT 1;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS digest_hour INT NOT NULL DEFAULT 8;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS digest_sent_at TIMESTAMP;
+
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS renewed_at TIMESTAMP;
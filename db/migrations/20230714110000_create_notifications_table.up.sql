@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS notifications(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   domain_tracking_id INT,
+   kind TEXT NOT NULL,
+   channel TEXT NOT NULL,
+   target TEXT NOT NULL,
+   domain_name TEXT NOT NULL,
+   status TEXT NOT NULL,
+   expires TIMESTAMP,
+   state TEXT NOT NULL DEFAULT 'pending',
+   attempts INT NOT NULL DEFAULT 0,
+   last_error TEXT,
+   next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   delivered_at TIMESTAMP,
+   FOREIGN KEY (user_id) REFERENCES auth.users (id),
+   FOREIGN KEY (domain_tracking_id) REFERENCES domain_trackings (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS notifications_pending_idx ON notifications (next_attempt_at) WHERE state = 'pending';
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_at DESC);
@@ -0,0 +1,5 @@
+DROP INDEX domain_trackings_next_poll_at_idx;
+
+ALTER TABLE domain_trackings DROP COLUMN poll_failures;
+ALTER TABLE domain_trackings DROP COLUMN poll_interval_seconds;
+ALTER TABLE domain_trackings DROP COLUMN next_poll_at;
@@ -0,0 +1,5 @@
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS next_poll_at TIMESTAMP NOT NULL DEFAULT now();
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS poll_interval_seconds INT;
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS poll_failures INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS domain_trackings_next_poll_at_idx ON domain_trackings (next_poll_at);
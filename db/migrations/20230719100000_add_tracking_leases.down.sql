@@ -0,0 +1,2 @@
+ALTER TABLE domain_trackings DROP COLUMN lease_expires_at;
+ALTER TABLE domain_trackings DROP COLUMN lease_owner;
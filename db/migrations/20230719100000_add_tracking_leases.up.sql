@@ -0,0 +1,2 @@
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS lease_owner TEXT;
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP;
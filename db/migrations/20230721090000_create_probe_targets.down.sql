@@ -0,0 +1,2 @@
+ALTER TABLE domain_trackings DROP COLUMN probe_target_id;
+DROP TABLE IF EXISTS probe_targets;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS probe_targets(
+	id BIGSERIAL PRIMARY KEY,
+	host TEXT NOT NULL,
+	port INT NOT NULL DEFAULT 443,
+	sni TEXT NOT NULL,
+	options TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	UNIQUE (host, port, sni, options)
+);
+
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS probe_target_id BIGINT REFERENCES probe_targets(id);
+
+INSERT INTO probe_targets (host, port, sni)
+SELECT DISTINCT domain_name, 443, domain_name FROM domain_trackings
+ON CONFLICT DO NOTHING;
+
+UPDATE domain_trackings AS dt SET probe_target_id = pt.id
+FROM probe_targets AS pt
+WHERE pt.host = dt.domain_name AND pt.port = 443 AND pt.sni = dt.domain_name AND pt.options = '';
+
+CREATE INDEX IF NOT EXISTS domain_trackings_probe_target_id_idx ON domain_trackings (probe_target_id);
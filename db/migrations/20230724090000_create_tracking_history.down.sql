@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tracking_history_hourly;
+DROP TABLE IF EXISTS tracking_history;
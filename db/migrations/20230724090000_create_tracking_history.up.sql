@@ -0,0 +1,37 @@
+-- Raw probe results, partitioned by day so old results can be dropped cheaply.
+-- The pulser creates the partitions ahead of time and drops the expired ones.
+CREATE TABLE IF NOT EXISTS tracking_history(
+   domain_tracking_id INT NOT NULL,
+   user_id UUID NOT NULL,
+   polled_at TIMESTAMP NOT NULL,
+   status TEXT NOT NULL,
+   latency INT NOT NULL DEFAULT 0,
+   error TEXT,
+   PRIMARY KEY (domain_tracking_id, polled_at),
+   FOREIGN KEY (domain_tracking_id) REFERENCES domain_trackings (id) ON DELETE CASCADE
+) PARTITION BY RANGE (polled_at);
+
+DO $$
+DECLARE
+   day DATE;
+BEGIN
+   FOR i IN 0..7 LOOP
+      day := current_date + i;
+      EXECUTE format(
+         'CREATE TABLE IF NOT EXISTS %I PARTITION OF tracking_history FOR VALUES FROM (%L) TO (%L)',
+         'tracking_history_p' || to_char(day, 'YYYYMMDD'), day, day + 1
+      );
+   END LOOP;
+END $$;
+
+-- Hourly rollups of the raw results, kept a lot longer than the raw results.
+CREATE TABLE IF NOT EXISTS tracking_history_hourly(
+   domain_tracking_id INT NOT NULL,
+   bucket TIMESTAMP NOT NULL,
+   polls INT NOT NULL,
+   up INT NOT NULL,
+   avg_latency INT NOT NULL,
+   max_latency INT NOT NULL,
+   PRIMARY KEY (domain_tracking_id, bucket),
+   FOREIGN KEY (domain_tracking_id) REFERENCES domain_trackings (id) ON DELETE CASCADE
+);
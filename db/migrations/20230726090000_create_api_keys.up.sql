@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   name TEXT NOT NULL,
+   prefix TEXT NOT NULL,
+   key_hash TEXT NOT NULL UNIQUE,
+   scopes TEXT[] NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   last_used_at TIMESTAMP,
+   revoked_at TIMESTAMP,
+   FOREIGN KEY (user_id) REFERENCES auth.users (id)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
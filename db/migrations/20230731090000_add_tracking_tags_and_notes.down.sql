@@ -0,0 +1,2 @@
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS notes;
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS tags;
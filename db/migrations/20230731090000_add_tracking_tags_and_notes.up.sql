@@ -0,0 +1,2 @@
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS tags TEXT[];
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS notes TEXT;
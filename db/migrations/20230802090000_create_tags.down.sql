@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS notification_routes;
+
+ALTER TABLE maintenance_windows DROP COLUMN IF EXISTS tag;
+
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS environment;
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS project;
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS tags TEXT[];
+
+UPDATE domain_trackings AS dt SET tags = (
+   SELECT array_agg(t.name ORDER BY t.name) FROM domain_tracking_tags AS dtt
+   INNER JOIN tags AS t ON t.id = dtt.tag_id
+   WHERE dtt.domain_tracking_id = dt.id
+);
+
+DROP TABLE IF EXISTS domain_tracking_tags;
+DROP TABLE IF EXISTS tags;
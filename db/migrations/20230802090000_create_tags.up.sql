@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS tags(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   name TEXT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   UNIQUE (user_id, name),
+   FOREIGN KEY (user_id) REFERENCES auth.users (id)
+);
+
+CREATE TABLE IF NOT EXISTS domain_tracking_tags(
+   domain_tracking_id INT NOT NULL,
+   tag_id INT NOT NULL,
+   PRIMARY KEY (domain_tracking_id, tag_id),
+   FOREIGN KEY (domain_tracking_id) REFERENCES domain_trackings (id) ON DELETE CASCADE,
+   FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS domain_tracking_tags_tag_id_idx ON domain_tracking_tags (tag_id);
+
+-- Move the tags of the imported trackings into the tag tables.
+INSERT INTO tags (user_id, name)
+SELECT DISTINCT user_id, unnest(tags) FROM domain_trackings WHERE tags IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO domain_tracking_tags (domain_tracking_id, tag_id)
+SELECT dt.id, t.id FROM domain_trackings AS dt
+CROSS JOIN LATERAL unnest(dt.tags) AS tag(name)
+INNER JOIN tags AS t ON t.user_id = dt.user_id AND t.name = tag.name
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS tags;
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS project TEXT;
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS environment TEXT;
+
+ALTER TABLE maintenance_windows ADD COLUMN IF NOT EXISTS tag TEXT;
+
+CREATE TABLE IF NOT EXISTS notification_routes(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   tag TEXT NOT NULL,
+   channel TEXT NOT NULL,
+   target TEXT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   FOREIGN KEY (user_id) REFERENCES auth.users (id)
+);
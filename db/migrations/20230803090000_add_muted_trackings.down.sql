@@ -0,0 +1 @@
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS muted;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS status_page_trackings;
+DROP TABLE IF EXISTS status_pages;
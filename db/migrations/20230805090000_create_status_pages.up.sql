@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS status_pages(
+   id SERIAL PRIMARY KEY,
+   user_id UUID NOT NULL,
+   slug TEXT NOT NULL UNIQUE,
+   title TEXT NOT NULL,
+   password_hash TEXT,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   FOREIGN KEY (user_id) REFERENCES auth.users (id)
+);
+
+CREATE TABLE IF NOT EXISTS status_page_trackings(
+   status_page_id INT NOT NULL,
+   domain_tracking_id INT NOT NULL,
+   position INT NOT NULL DEFAULT 0,
+   PRIMARY KEY (status_page_id, domain_tracking_id),
+   FOREIGN KEY (status_page_id) REFERENCES status_pages (id) ON DELETE CASCADE,
+   FOREIGN KEY (domain_tracking_id) REFERENCES domain_trackings (id) ON DELETE CASCADE
+);
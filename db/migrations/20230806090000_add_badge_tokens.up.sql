@@ -0,0 +1 @@
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS badge_token TEXT UNIQUE;
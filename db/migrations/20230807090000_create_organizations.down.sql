@@ -0,0 +1,25 @@
+ALTER TABLE suppressed_notifications DROP COLUMN IF EXISTS organization_id;
+DROP INDEX IF EXISTS notifications_organization_id_idx;
+ALTER TABLE notifications DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE status_pages DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE maintenance_windows DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE notification_routes DROP COLUMN IF EXISTS organization_id;
+
+-- Tags go back to the user that created the organization.
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS user_id UUID REFERENCES auth.users (id);
+UPDATE tags AS t SET user_id = o.created_by FROM organizations AS o WHERE o.id = t.organization_id;
+DELETE FROM tags WHERE user_id IS NULL;
+ALTER TABLE tags ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_organization_id_name_key;
+ALTER TABLE tags DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE tags ADD CONSTRAINT tags_user_id_name_key UNIQUE (user_id, name);
+
+DROP INDEX IF EXISTS domain_trackings_organization_id_idx;
+ALTER TABLE domain_trackings DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_organization_id_key;
+ALTER TABLE accounts DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organization_invitations;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
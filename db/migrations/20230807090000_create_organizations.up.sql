@@ -0,0 +1,94 @@
+CREATE TABLE IF NOT EXISTS organizations(
+   id SERIAL PRIMARY KEY,
+   name TEXT NOT NULL,
+   created_by UUID,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   FOREIGN KEY (created_by) REFERENCES auth.users (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+   organization_id INT NOT NULL,
+   user_id UUID NOT NULL,
+   email TEXT NOT NULL,
+   role TEXT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   PRIMARY KEY (organization_id, user_id),
+   FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+   FOREIGN KEY (user_id) REFERENCES auth.users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations(
+   id SERIAL PRIMARY KEY,
+   organization_id INT NOT NULL,
+   email TEXT NOT NULL,
+   role TEXT NOT NULL,
+   token_hash TEXT NOT NULL UNIQUE,
+   invited_by UUID NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT now(),
+   expires_at TIMESTAMP NOT NULL,
+   accepted_at TIMESTAMP,
+   FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+   FOREIGN KEY (invited_by) REFERENCES auth.users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_organization_id_idx ON organization_invitations (organization_id);
+
+-- Every user gets a personal organization that owns everything the user
+-- created so far.
+INSERT INTO organizations (name, created_by)
+SELECT u.email, u.id FROM auth.users AS u;
+
+INSERT INTO organization_members (organization_id, user_id, email, role)
+SELECT o.id, u.id, u.email, 'owner' FROM organizations AS o
+INNER JOIN auth.users AS u ON u.id = o.created_by;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE accounts AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+-- Users that signed up without ever finishing the sign in have no account
+-- yet, their organization gets one on the starter plan.
+INSERT INTO accounts (user_id, organization_id, notify_upfront, notify_default_email, plan, timezone, digest_enabled, digest_weekday, digest_hour)
+SELECT u.id, o.id, 7, u.email, 0, 'UTC', TRUE, 1, 8 FROM organizations AS o
+INNER JOIN auth.users AS u ON u.id = o.created_by
+WHERE NOT EXISTS (SELECT 1 FROM accounts AS a WHERE a.organization_id = o.id);
+ALTER TABLE accounts ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE accounts ADD CONSTRAINT accounts_organization_id_key UNIQUE (organization_id);
+
+-- Trackings without a user were never listed, they stay without an
+-- organization.
+ALTER TABLE domain_trackings ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE domain_trackings AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+CREATE INDEX IF NOT EXISTS domain_trackings_organization_id_idx ON domain_trackings (organization_id);
+
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE tags AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE tags ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_user_id_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_organization_id_name_key UNIQUE (organization_id, name);
+ALTER TABLE tags DROP COLUMN IF EXISTS user_id;
+
+ALTER TABLE notification_routes ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE notification_routes AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE notification_routes ALTER COLUMN organization_id SET NOT NULL;
+
+ALTER TABLE maintenance_windows ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE maintenance_windows AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE maintenance_windows ALTER COLUMN organization_id SET NOT NULL;
+
+ALTER TABLE status_pages ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE status_pages AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE status_pages ALTER COLUMN organization_id SET NOT NULL;
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE api_keys AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE api_keys ALTER COLUMN organization_id SET NOT NULL;
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE notifications AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE notifications ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS notifications_organization_id_idx ON notifications (organization_id, created_at DESC);
+
+ALTER TABLE suppressed_notifications ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations (id) ON DELETE CASCADE;
+UPDATE suppressed_notifications AS t SET organization_id = o.id FROM organizations AS o WHERE o.created_by = t.user_id;
+ALTER TABLE suppressed_notifications ALTER COLUMN organization_id SET NOT NULL;
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/anthdm/ssltracker/data"
 	"github.com/anthdm/ssltracker/settings"
@@ -17,6 +20,12 @@ type UpdateAccountParams struct {
 	NotifyUpfront      int
 	NotifyDefaultEmail string
 	NotifyWebhookURL   string
+	Timezone           string
+	QuietHoursStart    string
+	QuietHoursEnd      string
+	DigestEnabled      bool
+	DigestWeekday      int
+	DigestHour         int
 }
 
 func (p UpdateAccountParams) validate() fiber.Map {
@@ -32,6 +41,19 @@ func (p UpdateAccountParams) validate() fiber.Map {
 			errors["notifyWebhookURLError"] = fmt.Sprintf("%s is not a valid webhook URL", p.NotifyWebhookURL)
 		}
 	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil || len(p.Timezone) == 0 {
+		errors["timezoneError"] = fmt.Sprintf("%s is not a valid timezone", p.Timezone)
+	}
+	if len(p.QuietHoursStart) > 0 || len(p.QuietHoursEnd) > 0 {
+		_, startErr := data.ParseClock(p.QuietHoursStart)
+		_, endErr := data.ParseClock(p.QuietHoursEnd)
+		if startErr != nil || endErr != nil {
+			errors["quietHoursError"] = "Please provide both the start and end of your quiet hours (HH:MM)"
+		}
+	}
+	if p.DigestWeekday < int(time.Sunday) || p.DigestWeekday > int(time.Saturday) || p.DigestHour < 0 || p.DigestHour > 23 {
+		errors["digestError"] = "Please select a valid day and hour for your weekly digest"
+	}
 	return errors
 }
 
@@ -43,13 +65,23 @@ func HandleAccountUpdate(c *fiber.Ctx) error {
 	if errors := params.validate(); len(errors) > 0 {
 		return flash.WithData(c, errors).Redirect("/account")
 	}
-	user := getAuthenticatedUser(c)
-	account, err := data.GetUserAccount(user.ID)
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
 	account.NotifyUpfront = params.NotifyUpfront
 	account.NotifyDefaultEmail = params.NotifyDefaultEmail
+	// The webhook input is disabled in plans without webhooks.
+	if settings.Account[account.Plan].Webhooks {
+		account.NotifyWebhookURL = params.NotifyWebhookURL
+	}
+	account.Timezone = params.Timezone
+	account.QuietHoursStart = params.QuietHoursStart
+	account.QuietHoursEnd = params.QuietHoursEnd
+	account.DigestEnabled = params.DigestEnabled
+	account.DigestWeekday = params.DigestWeekday
+	account.DigestHour = params.DigestHour
 	if err := data.UpdateAccount(account); err != nil {
 		return err
 	}
@@ -57,15 +89,276 @@ func HandleAccountUpdate(c *fiber.Ctx) error {
 }
 
 func HandleAccountShow(c *fiber.Ctx) error {
-	user := getAuthenticatedUser(c)
-	account, err := data.GetUserAccount(user.ID)
+	context, err := accountContext(c.UserContext(), getMember(c))
 	if err != nil {
 		return err
 	}
-	context := fiber.Map{
-		"account":           account,
-		"customerPortalURL": os.Getenv("STRIPE_PORTAL_URL"),
-		"settings":          settings.Account[account.Plan],
+	return c.Render("account/show", context)
+}
+
+func accountContext(ctx context.Context, member *data.OrganizationMember) (fiber.Map, error) {
+	account, err := data.GetOrganizationAccount(ctx, member.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	windows, err := data.GetMaintenanceWindows(member.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := data.GetOrganizationAPIKeys(member.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := data.GetNotificationRoutes(member.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := data.GetOrganizationTags(ctx, member.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"account":            account,
+		"maintenanceWindows": windows,
+		"notificationRoutes": routes,
+		"routeChannels":      notificationRouteChannels,
+		"tags":               tags,
+		"weekdays":           weekdayOptions(),
+		"digestDays":         weekdayOptions()[1:],
+		"digestHours":        digestHourOptions(),
+		"apiKeys":            apiKeys,
+		"apiKeyScopes":       data.APIKeyScopes,
+		"customerPortalURL":  os.Getenv("STRIPE_PORTAL_URL"),
+		"settings":           settings.Account[account.Plan],
+	}, nil
+}
+
+type CreateAPIKeyParams struct {
+	Name   string
+	Scopes []string
+}
+
+func (p CreateAPIKeyParams) validate() fiber.Map {
+	errors := fiber.Map{}
+	if len(strings.TrimSpace(p.Name)) == 0 {
+		errors["apiKeyError"] = "Please provide a name for the API key"
+	}
+	if len(p.Scopes) == 0 {
+		errors["apiKeyError"] = "Please select at least 1 scope"
+	}
+	for _, scope := range p.Scopes {
+		if !isValidAPIKeyScope(scope) {
+			errors["apiKeyError"] = fmt.Sprintf("%s is not a valid scope", scope)
+		}
+	}
+	return errors
+}
+
+func isValidAPIKeyScope(scope string) bool {
+	for _, s := range data.APIKeyScopes {
+		if s == scope {
+			return true
+		}
 	}
+	return false
+}
+
+// HandleAPIKeyCreate creates a new API key and renders the account page with
+// the key, since this is the only time it can be shown.
+func HandleAPIKeyCreate(c *fiber.Ctx) error {
+	var params CreateAPIKeyParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	if errors := params.validate(); len(errors) > 0 {
+		return flash.WithData(c, errors).Redirect("/account")
+	}
+	member := getMember(c)
+	key, apiKey, err := data.NewAPIKey(member, strings.TrimSpace(params.Name), params.Scopes)
+	if err != nil {
+		return err
+	}
+	if err := data.InsertAPIKey(apiKey); err != nil {
+		return err
+	}
+	context, err := accountContext(c.UserContext(), member)
+	if err != nil {
+		return err
+	}
+	context["newAPIKey"] = key
 	return c.Render("account/show", context)
 }
+
+func HandleAPIKeyRevoke(c *fiber.Ctx) error {
+	member := getMember(c)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	}
+	if err := data.RevokeAPIKey(query); err != nil {
+		return err
+	}
+	return c.Redirect("/account")
+}
+
+const maxMaintenanceWindowMinutes = 24 * 60
+
+type CreateMaintenanceWindowParams struct {
+	Description     string
+	Weekday         int
+	StartsAt        string
+	DurationMinutes int
+	Timezone        string
+	Tag             string
+}
+
+func (p CreateMaintenanceWindowParams) validate() fiber.Map {
+	errors := fiber.Map{}
+	if p.Weekday < data.EveryDay || p.Weekday > int(time.Saturday) {
+		errors["maintenanceWindowError"] = "Please select a valid day of the week"
+	}
+	if _, err := data.ParseClock(p.StartsAt); err != nil {
+		errors["maintenanceWindowError"] = "Please provide a valid start time (HH:MM)"
+	}
+	if p.DurationMinutes <= 0 || p.DurationMinutes > maxMaintenanceWindowMinutes {
+		errors["maintenanceWindowError"] = fmt.Sprintf("The duration of a maintenance window should be between 1 and %d minutes", maxMaintenanceWindowMinutes)
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil || len(p.Timezone) == 0 {
+		errors["maintenanceWindowError"] = fmt.Sprintf("%s is not a valid timezone", p.Timezone)
+	}
+	if len(p.Tag) > 0 {
+		if _, ok := data.NormalizeTag(p.Tag); !ok {
+			errors["maintenanceWindowError"] = fmt.Sprintf("%s is not a valid tag", p.Tag)
+		}
+	}
+	return errors
+}
+
+func HandleMaintenanceWindowCreate(c *fiber.Ctx) error {
+	var params CreateMaintenanceWindowParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	if errors := params.validate(); len(errors) > 0 {
+		return flash.WithData(c, errors).Redirect("/account")
+	}
+	member := getMember(c)
+	tag, _ := data.NormalizeTag(params.Tag)
+	window := &data.MaintenanceWindow{
+		UserID:          member.UserID,
+		OrganizationID:  member.OrganizationID,
+		Description:     params.Description,
+		Weekday:         params.Weekday,
+		StartsAt:        params.StartsAt,
+		DurationMinutes: params.DurationMinutes,
+		Timezone:        params.Timezone,
+		Tag:             tag,
+	}
+	if err := data.InsertMaintenanceWindow(window); err != nil {
+		return err
+	}
+	return c.Redirect("/account")
+}
+
+func HandleMaintenanceWindowDelete(c *fiber.Ctx) error {
+	member := getMember(c)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	}
+	if err := data.DeleteMaintenanceWindow(query); err != nil {
+		return err
+	}
+	return c.Redirect("/account")
+}
+
+var notificationRouteChannels = []string{
+	data.ChannelEmail,
+	data.ChannelSlack,
+}
+
+type CreateNotificationRouteParams struct {
+	Tag     string
+	Channel string
+	Target  string
+}
+
+func (p CreateNotificationRouteParams) validate(plan data.Plan) fiber.Map {
+	errors := fiber.Map{}
+	if _, ok := data.NormalizeTag(p.Tag); !ok {
+		errors["notificationRouteError"] = "Please provide a valid tag"
+	}
+	switch p.Channel {
+	case data.ChannelEmail:
+		if !util.IsValidEmail(p.Target) {
+			errors["notificationRouteError"] = "Please provide a valid email address"
+		}
+	case data.ChannelSlack:
+		if !settings.Account[plan].SlackIntegration {
+			errors["notificationRouteError"] = fmt.Sprintf("Slack is not available in the %s plan", plan)
+		} else if !strings.HasPrefix(p.Target, "https://hooks.slack.com/") {
+			errors["notificationRouteError"] = "Please provide a Slack incoming webhook URL (https://hooks.slack.com/...)"
+		}
+	default:
+		errors["notificationRouteError"] = "Please select a valid channel"
+	}
+	return errors
+}
+
+// HandleNotificationRouteCreate routes the notifications of the trackings with
+// a tag to an extra email address or Slack channel.
+func HandleNotificationRouteCreate(c *fiber.Ctx) error {
+	var params CreateNotificationRouteParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	params.Target = strings.TrimSpace(params.Target)
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if errors := params.validate(account.Plan); len(errors) > 0 {
+		return flash.WithData(c, errors).Redirect("/account")
+	}
+	tag, _ := data.NormalizeTag(params.Tag)
+	route := &data.NotificationRoute{
+		UserID:         member.UserID,
+		OrganizationID: member.OrganizationID,
+		Tag:            tag,
+		Channel:        params.Channel,
+		Target:         params.Target,
+	}
+	if err := data.InsertNotificationRoute(route); err != nil {
+		return err
+	}
+	return c.Redirect("/account")
+}
+
+func HandleNotificationRouteDelete(c *fiber.Ctx) error {
+	member := getMember(c)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	}
+	if err := data.DeleteNotificationRoute(query); err != nil {
+		return err
+	}
+	return c.Redirect("/account")
+}
+
+func weekdayOptions() []fiber.Map {
+	options := []fiber.Map{{"value": data.EveryDay, "name": "every day"}}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		options = append(options, fiber.Map{"value": int(day), "name": day.String()})
+	}
+	return options
+}
+
+func digestHourOptions() []int {
+	hours := make([]int, 24)
+	for i := range hours {
+		hours[i] = i
+	}
+	return hours
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/api"
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/settings"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+const localsAPIKey = "apiKey"
+
+// APIError is the error format of the public API. Every error is rendered as
+//
+//	{"error": {"code": "not_found", "message": "tracking not found"}}
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e APIError) Error() string {
+	return e.Message
+}
+
+func NewAPIError(status int, code string, message string) APIError {
+	return APIError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func apiBadRequest(message string) APIError {
+	return NewAPIError(fiber.StatusBadRequest, "bad_request", message)
+}
+
+func apiNotFound(message string) APIError {
+	return NewAPIError(fiber.StatusNotFound, "not_found", message)
+}
+
+// WithAPIErrors renders the errors returned by the API handlers as JSON
+// instead of the HTML pages and redirects of ErrorHandler.
+func WithAPIErrors(c *fiber.Ctx) error {
+	err := c.Next()
+	if err == nil {
+		return nil
+	}
+	var (
+		apiErr   APIError
+		fiberErr *fiber.Error
+	)
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.As(err, &fiberErr):
+		apiErr = NewAPIError(fiberErr.Code, apiErrorCode(fiberErr.Code), fiberErr.Message)
+	case util.IsErrNoRecords(err):
+		apiErr = apiNotFound("resource not found")
+	default:
+		logger.Log("error", "api error", "path", c.Path(), "err", err)
+		apiErr = NewAPIError(fiber.StatusInternalServerError, "internal_error", "internal server error")
+	}
+	return c.Status(apiErr.Status).JSON(fiber.Map{"error": apiErr})
+}
+
+// apiErrorCode turns the status code into a snake cased error code, like
+// not_found for 404.
+func apiErrorCode(status int) string {
+	text := strings.ToLower(http.StatusText(status))
+	if len(text) == 0 {
+		return "error"
+	}
+	return strings.ReplaceAll(text, " ", "_")
+}
+
+// WithAPIKey authenticates the request with the API key in the Authorization
+// header (Bearer <key>) and sets the member that created the key as the
+// authenticated user. Keys of users that left the organization stop working.
+func WithAPIKey(c *fiber.Ctx) error {
+	auth := c.Get(fiber.HeaderAuthorization)
+	key, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || len(key) == 0 {
+		return NewAPIError(fiber.StatusUnauthorized, "unauthorized", "missing API key, send it in the Authorization header as a Bearer token")
+	}
+	apiKey, err := data.GetActiveAPIKey(c.UserContext(), key)
+	if err != nil {
+		if util.IsErrNoRecords(err) {
+			return NewAPIError(fiber.StatusUnauthorized, "unauthorized", "invalid or revoked API key")
+		}
+		return err
+	}
+	member, err := data.GetOrganizationMember(c.UserContext(), apiKey.OrganizationID, apiKey.UserID)
+	if err != nil {
+		if util.IsErrNoRecords(err) {
+			return NewAPIError(fiber.StatusUnauthorized, "unauthorized", "the API key belongs to a user that left the organization")
+		}
+		return err
+	}
+	if err := data.UpdateAPIKeyLastUsedAt(c.UserContext(), apiKey, time.Now()); err != nil {
+		logger.Log("error", "updating api key last used at failed", "err", err)
+	}
+	c.Locals(localsUserKey, &data.User{ID: member.UserID, Email: member.Email})
+	c.Locals(localsMemberKey, member)
+	c.Locals(localsAPIKey, apiKey)
+	return c.Next()
+}
+
+// WithAPIScope only allows API keys with the given scope. Writing also needs
+// the member that created the key to be an editor of the organization.
+func WithAPIScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey, ok := c.Locals(localsAPIKey).(*data.APIKey)
+		if !ok || !apiKey.HasScope(scope) {
+			return NewAPIError(fiber.StatusForbidden, "insufficient_scope", "the API key is missing the "+scope+" scope")
+		}
+		if scope == data.ScopeWrite && !getMember(c).Role.Can(data.RoleEditor) {
+			return NewAPIError(fiber.StatusForbidden, "insufficient_role", "the API key belongs to a viewer of the organization")
+		}
+		return c.Next()
+	}
+}
+
+type apiAccount struct {
+	Plan                string `json:"plan"`
+	SubscriptionStatus  string `json:"subscription_status"`
+	Trackings           int    `json:"trackings"`
+	MaxTrackings        int    `json:"max_trackings"`
+	PollIntervalSeconds int    `json:"poll_interval_seconds"`
+	NotifyUpfrontDays   int    `json:"notify_upfront_days"`
+	NotifyDefaultEmail  string `json:"notify_default_email"`
+	Timezone            string `json:"timezone"`
+}
+
+func HandleAPIAccount(c *fiber.Ctx) error {
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	count, err := data.CountOrganizationDomainTrackings(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	planSettings := settings.Account[account.Plan]
+	return c.JSON(apiAccount{
+		Plan:                account.Plan.String(),
+		SubscriptionStatus:  account.SubscriptionStatus,
+		Trackings:           count,
+		MaxTrackings:        planSettings.MaxTrackings,
+		PollIntervalSeconds: int(planSettings.PollInterval.Seconds()),
+		NotifyUpfrontDays:   account.NotifyUpfront,
+		NotifyDefaultEmail:  account.NotifyDefaultEmail,
+		Timezone:            account.Timezone,
+	})
+}
+
+type apiNotification struct {
+	ID          int64      `json:"id"`
+	TrackingID  int64      `json:"tracking_id,omitempty"`
+	Domain      string     `json:"domain"`
+	Kind        string     `json:"kind"`
+	Channel     string     `json:"channel"`
+	Status      string     `json:"status"`
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+func newAPINotification(notification *data.Notification) apiNotification {
+	n := apiNotification{
+		ID:         notification.ID,
+		TrackingID: notification.DomainTrackingID,
+		Domain:     notification.DomainName,
+		Kind:       notification.Kind,
+		Channel:    notification.Channel,
+		Status:     notification.Status,
+		State:      notification.State,
+		Attempts:   notification.Attempts,
+		LastError:  notification.LastError,
+		CreatedAt:  notification.CreatedAt,
+	}
+	if !notification.DeliveredAt.IsZero() {
+		n.DeliveredAt = &notification.DeliveredAt
+	}
+	return n
+}
+
+type apiNotificationList struct {
+	Data []apiNotification `json:"data"`
+}
+
+func HandleAPINotificationList(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", notificationLogLimit)
+	if limit <= 0 || limit > maxAPILimit {
+		return apiBadRequest(fmt.Sprintf("limit should be between 1 and %d", maxAPILimit))
+	}
+	member := getMember(c)
+	notifications, err := data.GetOrganizationNotifications(c.UserContext(), member.OrganizationID, limit)
+	if err != nil {
+		return err
+	}
+	list := apiNotificationList{Data: make([]apiNotification, len(notifications))}
+	for i := range notifications {
+		list.Data[i] = newAPINotification(&notifications[i])
+	}
+	return c.JSON(list)
+}
+
+// HandleAPINotificationRetry puts a dead notification back in the delivery queue.
+func HandleAPINotificationRetry(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return apiBadRequest("invalid notification id")
+	}
+	member := getMember(c)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              id,
+		"state":           data.NotificationStateDead,
+	}
+	n, err := data.RetryNotification(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return apiNotFound("dead notification not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleAPISpec serves the OpenAPI specification of the API.
+func HandleAPISpec(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "application/yaml")
+	return c.Send(api.Spec)
+}
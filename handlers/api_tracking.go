@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/ssl"
+	"github.com/anthdm/ssltracker/settings"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxAPILimit = 100
+
+type apiTracking struct {
+	ID                  int64      `json:"id"`
+	Domain              string     `json:"domain"`
+	Status              string     `json:"status"`
+	Issuer              string     `json:"issuer"`
+	Expires             time.Time  `json:"expires"`
+	DNSNames            []string   `json:"dns_names"`
+	ServerIP            string     `json:"server_ip"`
+	SignatureAlgo       string     `json:"signature_algo"`
+	PublicKeyAlgo       string     `json:"public_key_algo"`
+	Signature           string     `json:"signature"`
+	LatencyMS           int        `json:"latency_ms"`
+	Error               string     `json:"error,omitempty"`
+	LastPollAt          time.Time  `json:"last_poll_at"`
+	NextPollAt          time.Time  `json:"next_poll_at"`
+	PollIntervalSeconds int        `json:"poll_interval_seconds,omitempty"`
+	SnoozedUntil        *time.Time `json:"snoozed_until,omitempty"`
+	Static              bool       `json:"static,omitempty"`
+	Muted               bool       `json:"muted,omitempty"`
+	Tags                []string   `json:"tags"`
+	Project             string     `json:"project,omitempty"`
+	Environment         string     `json:"environment,omitempty"`
+}
+
+func newAPITracking(tracking *data.DomainTracking) apiTracking {
+	t := apiTracking{
+		ID:                  tracking.ID,
+		Domain:              tracking.DomainName,
+		Status:              tracking.Status,
+		Issuer:              tracking.Issuer,
+		Expires:             tracking.Expires,
+		DNSNames:            []string{},
+		ServerIP:            tracking.ServerIP,
+		SignatureAlgo:       tracking.SignatureAlgo,
+		PublicKeyAlgo:       tracking.PublicKeyAlgo,
+		Signature:           tracking.Signature,
+		LatencyMS:           tracking.Latency,
+		Error:               tracking.Error,
+		LastPollAt:          tracking.LastPollAt,
+		NextPollAt:          tracking.NextPollAt,
+		PollIntervalSeconds: tracking.PollIntervalSeconds,
+		Static:              tracking.Static,
+		Muted:               tracking.Muted,
+		Tags:                []string{},
+		Project:             tracking.Project,
+		Environment:         tracking.Environment,
+	}
+	if len(tracking.Tags) > 0 {
+		t.Tags = tracking.Tags
+	}
+	if len(tracking.DNSNames) > 0 {
+		t.DNSNames = strings.Split(tracking.DNSNames, ", ")
+	}
+	if tracking.IsSnoozed(time.Now()) {
+		t.SnoozedUntil = &tracking.SnoozedUntil
+	}
+	return t
+}
+
+type apiTrackingList struct {
+	Data  []apiTracking `json:"data"`
+	Limit int           `json:"limit"`
+	Page  int           `json:"page"`
+	Total int           `json:"total"`
+}
+
+func HandleAPITrackingList(c *fiber.Ctx) error {
+	filter, err := buildTrackingFilter(c)
+	if err != nil {
+		return apiBadRequest("invalid query parameters")
+	}
+	if filter.Limit < 0 || filter.Limit > maxAPILimit {
+		return apiBadRequest(fmt.Sprintf("limit should be between 1 and %d", maxAPILimit))
+	}
+	if filter.Page < 0 {
+		return apiBadRequest("page should not be negative")
+	}
+	if len(filter.Status) > 0 && filter.Status != "all" && !isValidStatus(filter.Status) {
+		return apiBadRequest(fmt.Sprintf("%s is not a valid status", filter.Status))
+	}
+	if len(filter.Sort) > 0 && !data.IsValidTrackingSort(filter.Sort) {
+		return apiBadRequest(fmt.Sprintf("%s is not a valid sort", filter.Sort))
+	}
+	var (
+		member = getMember(c)
+		query  = filter.query(member.OrganizationID)
+	)
+	total, err := data.CountDomainTrackings(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	trackings, err := data.GetDomainTrackings(c.UserContext(), query, filter.Sort, filter.Limit, filter.Page)
+	if err != nil {
+		return err
+	}
+	if err := data.LoadTrackingTags(c.UserContext(), trackings); err != nil {
+		return err
+	}
+	list := apiTrackingList{
+		Data:  make([]apiTracking, len(trackings)),
+		Limit: filter.Limit,
+		Page:  filter.Page,
+		Total: total,
+	}
+	for i := range trackings {
+		list.Data[i] = newAPITracking(&trackings[i])
+	}
+	return c.JSON(list)
+}
+
+func isValidStatus(status string) bool {
+	for _, s := range statusFilters {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func HandleAPITrackingShow(c *fiber.Ctx) error {
+	tracking, err := getAPITracking(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newAPITracking(tracking))
+}
+
+type CreateAPITrackingParams struct {
+	Domain string `json:"domain"`
+}
+
+func HandleAPITrackingCreate(c *fiber.Ctx) error {
+	var params CreateAPITrackingParams
+	if err := c.BodyParser(&params); err != nil {
+		return apiBadRequest("invalid request body, expected {\"domain\": \"example.com\"}")
+	}
+	domain := strings.TrimSpace(params.Domain)
+	if !util.IsValidDomainName(domain) {
+		return apiBadRequest(fmt.Sprintf("%q is not a valid domain", domain))
+	}
+
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if account.Plan > data.PlanStarter && !data.IsPlanActive(account.SubscriptionStatus) {
+		return NewAPIError(fiber.StatusPaymentRequired, "subscription_inactive", "subscription status not active")
+	}
+	maxTrackings := settings.Account[account.Plan].MaxTrackings
+	count, err := data.CountOrganizationDomainTrackings(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if count+1 > maxTrackings {
+		return NewAPIError(fiber.StatusForbidden, "plan_limit_reached",
+			fmt.Sprintf("the %s plan allows %d trackings", account.Plan, maxTrackings))
+	}
+	_, err = data.GetDomainTracking(c.UserContext(), fiber.Map{"organization_id": member.OrganizationID, "domain_name": domain})
+	if err == nil {
+		return NewAPIError(fiber.StatusConflict, "already_tracked", fmt.Sprintf("%s is already tracked", domain))
+	}
+	if !util.IsErrNoRecords(err) {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*5)
+	defer cancel()
+	info, err := ssl.PollDomain(ctx, domain)
+	if err != nil {
+		return err
+	}
+	tracking := &data.DomainTracking{
+		DomainName:         domain,
+		UserID:             member.UserID,
+		OrganizationID:     member.OrganizationID,
+		DomainTrackingInfo: *info,
+	}
+	if err := data.InsertDomainTracking(c.UserContext(), tracking); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(newAPITracking(tracking))
+}
+
+func HandleAPITrackingDelete(c *fiber.Ctx) error {
+	tracking, err := getAPITracking(c)
+	if err != nil {
+		return err
+	}
+	query := fiber.Map{
+		"organization_id": getMember(c).OrganizationID,
+		"id":              tracking.ID,
+	}
+	if err := data.DeleteDomainTracking(c.UserContext(), query); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleAPITrackingRecheck polls the tracking right away instead of waiting
+// for its next scheduled poll. Static trackings only have their expiry checked.
+func HandleAPITrackingRecheck(c *fiber.Ctx) error {
+	tracking, err := getAPITracking(c)
+	if err != nil {
+		return err
+	}
+	if !recheckLimiter.Allow(strconv.FormatInt(getMember(c).OrganizationID, 10), time.Now()) {
+		return NewAPIError(fiber.StatusTooManyRequests, "rate_limited", recheckLimitMessage)
+	}
+	if err := recheckTracking(c.UserContext(), tracking); err != nil {
+		return err
+	}
+	return c.JSON(newAPITracking(tracking))
+}
+
+func getAPITracking(c *fiber.Ctx) (*data.DomainTracking, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, apiBadRequest("invalid tracking id")
+	}
+	member := getMember(c)
+	tracking, err := data.GetDomainTracking(c.UserContext(), fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              id,
+	})
+	if err != nil {
+		if util.IsErrNoRecords(err) {
+			return nil, apiNotFound("tracking not found")
+		}
+		return nil, err
+	}
+	return tracking, nil
+}
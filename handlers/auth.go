@@ -126,12 +126,12 @@ func HandleAuthCallback(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	acc, err := data.CreateAccountForUserIfNotExist(user)
+	member, err := data.CreatePersonalOrganizationIfNotExist(&data.User{ID: user.ID, Email: user.Email})
 	if err != nil {
 		return err
 	}
 
-	logger.Log("info", "user signin", "userID", user.ID, "accountID", acc.ID)
+	logger.Log("info", "user signin", "userID", user.ID, "organizationID", member.OrganizationID)
 
 	// check if there is a cookie set with a checkout session to redirect the user to
 	// when authenticated.
@@ -155,6 +155,11 @@ func HandleAuthCallback(c *fiber.Ctx) error {
 			Value:   "deleted",
 		})
 	}
+	// Users that followed an invitation while signed out are sent back to it.
+	if token := c.Cookies(invitationCookie); len(token) > 0 {
+		redirectTo = "/invitations/" + token
+		c.ClearCookie(invitationCookie)
+	}
 
 	return c.Redirect(redirectTo)
 }
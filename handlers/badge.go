@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/badge"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	badgeLabel = "certificate"
+	// Badges are cached by browsers and image proxies, a revoked or changed
+	// badge can be shown for up to badgeMaxAge seconds.
+	badgeMaxAge         = 300
+	badgeNotFoundMaxAge = 60
+)
+
+// HandleBadge renders the status badge of the tracking with the token. It is
+// public, the token is the only credential.
+func HandleBadge(c *fiber.Ctx) error {
+	tracking, err := data.GetTrackingByBadgeToken(c.Params("token"))
+	if err != nil {
+		if !util.IsErrNoRecords(err) {
+			return err
+		}
+		setBadgeHeaders(c, badgeNotFoundMaxAge)
+		return c.Status(fiber.StatusNotFound).Send(badge.Render(badgeLabel, "not found", badge.ColorGrey))
+	}
+	svg := badge.Render(badgeLabel, badgeMessage(tracking), badgeColor(tracking.Status))
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(svg))
+	setBadgeHeaders(c, badgeMaxAge)
+	c.Set(fiber.HeaderETag, etag)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.Send(svg)
+}
+
+// setBadgeHeaders replaces the no-store headers every response gets by
+// default, badges are meant to be cached for a short time.
+func setBadgeHeaders(c *fiber.Ctx, maxAge int) {
+	c.Set(fiber.HeaderContentType, "image/svg+xml; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(maxAge))
+	c.Response().Header.Del(fiber.HeaderPragma)
+	c.Response().Header.Del(fiber.HeaderExpires)
+	c.Response().Header.Del("Surrogate-Control")
+}
+
+func badgeMessage(tracking *data.DomainTracking) string {
+	switch tracking.Status {
+	case data.StatusHealthy, data.StatusExpires:
+		return tracking.Status + ", " + util.DaysLeft(tracking.Expires)
+	case "":
+		return "pending"
+	default:
+		return tracking.Status
+	}
+}
+
+func badgeColor(status string) string {
+	switch status {
+	case data.StatusHealthy:
+		return badge.ColorGreen
+	case data.StatusExpires:
+		return badge.ColorYellow
+	case data.StatusExpired, data.StatusInvalid:
+		return badge.ColorRed
+	case data.StatusOffline, data.StatusUnresponsive:
+		return badge.ColorOrange
+	default:
+		return badge.ColorGrey
+	}
+}
+
+// HandleDomainBadge creates a new badge token for the tracking. A previous
+// badge of the tracking stops working.
+func HandleDomainBadge(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return AppError(fmt.Errorf("invalid tracking id"))
+	}
+	token, err := data.NewBadgeToken()
+	if err != nil {
+		return err
+	}
+	member := getMember(c)
+	if err := data.SetTrackingBadgeToken(member.OrganizationID, id, token); err != nil {
+		return err
+	}
+	return c.Redirect(fmt.Sprintf("/domains/%d", id))
+}
+
+// HandleDomainBadgeRevoke removes the badge of the tracking.
+func HandleDomainBadgeRevoke(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return AppError(fmt.Errorf("invalid tracking id"))
+	}
+	member := getMember(c)
+	if err := data.SetTrackingBadgeToken(member.OrganizationID, id, ""); err != nil {
+		return err
+	}
+	return c.Redirect(fmt.Sprintf("/domains/%d", id))
+}
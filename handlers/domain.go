@@ -19,6 +19,8 @@ import (
 	"github.com/sujit-baniya/flash"
 )
 
+const defaultTrackingLimit = 25
+
 var limitFilters = []int{
 	5,
 	10,
@@ -37,9 +39,20 @@ var statusFilters = []string{
 	data.StatusUnresponsive,
 }
 
+var sortFilters = []fiber.Map{
+	{"value": "domain", "name": "domain"},
+	{"value": "expires", "name": "expires soonest"},
+	{"value": "-expires", "name": "expires latest"},
+	{"value": "status", "name": "status"},
+	{"value": "-latency", "name": "slowest"},
+	{"value": "latency", "name": "fastest"},
+	{"value": "-last_poll", "name": "recently polled"},
+	{"value": "last_poll", "name": "least recently polled"},
+}
+
 func HandleDomainList(c *fiber.Ctx) error {
-	user := getAuthenticatedUser(c)
-	count, err := data.CountUserDomainTrackings(user.ID)
+	member := getMember(c)
+	count, err := data.CountOrganizationDomainTrackings(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
@@ -51,22 +64,40 @@ func HandleDomainList(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	filterContext := buildFilterContext(filter)
-	query := fiber.Map{
-		"user_id": user.ID,
+	if filter.Page < 0 {
+		return AppError(fmt.Errorf("page should not be negative"))
 	}
-	if filter.Status != "all" {
-		query["status"] = filter.Status
+	// Pages start at 1 in the list, 0 is the first page as well.
+	if filter.Page < 1 {
+		filter.Page = 1
 	}
-	domainTrackings, err := data.GetDomainTrackings(query, filter.Limit, filter.Page)
+	// The list only offers the limits of the filters, anything else falls
+	// back to the default instead of querying an unbounded page.
+	if !isValidLimit(filter.Limit) {
+		filter.Limit = defaultTrackingLimit
+	}
+	filterContext, err := buildFilterContext(c.UserContext(), filter, member.OrganizationID)
 	if err != nil {
 		return err
 	}
+	query := filter.query(member.OrganizationID)
+	total, err := data.CountDomainTrackings(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	domainTrackings, err := data.GetDomainTrackings(c.UserContext(), query, filter.Sort, filter.Limit, filter.Page-1)
+	if err != nil {
+		return err
+	}
+	if err := data.LoadTrackingTags(c.UserContext(), domainTrackings); err != nil {
+		return err
+	}
 	data := fiber.Map{
 		"trackings":        domainTrackings,
 		"filters":          filterContext,
 		"userHasTrackings": true,
-		"pages":            buildPages(count, filter.Limit),
+		"total":            total,
+		"pages":            buildPages(total, filter.Limit),
 		"queryParams":      filter.encode(),
 	}
 	return c.Render("domains/index", data)
@@ -77,12 +108,12 @@ func HandleDomainNew(c *fiber.Ctx) error {
 }
 
 func HandleDomainDelete(c *fiber.Ctx) error {
-	user := getAuthenticatedUser(c)
+	member := getMember(c)
 	query := fiber.Map{
-		"user_id": user.ID,
-		"id":      c.Params("id"),
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
 	}
-	if err := data.DeleteDomainTracking(query); err != nil {
+	if err := data.DeleteDomainTracking(c.UserContext(), query); err != nil {
 		return err
 	}
 	return c.Redirect("/domains")
@@ -90,12 +121,12 @@ func HandleDomainDelete(c *fiber.Ctx) error {
 
 func HandleDomainShowRaw(c *fiber.Ctx) error {
 	trackingID := c.Params("id")
-	user := getAuthenticatedUser(c)
+	member := getMember(c)
 	query := fiber.Map{
-		"user_id": user.ID,
-		"id":      trackingID,
+		"organization_id": member.OrganizationID,
+		"id":              trackingID,
 	}
-	tracking, err := data.GetDomainTracking(query)
+	tracking, err := data.GetDomainTracking(c.UserContext(), query)
 	if err != nil {
 		return err
 	}
@@ -104,25 +135,131 @@ func HandleDomainShowRaw(c *fiber.Ctx) error {
 
 func HandleDomainShow(c *fiber.Ctx) error {
 	trackingID := c.Params("id")
-	user := getAuthenticatedUser(c)
+	member := getMember(c)
 	query := fiber.Map{
-		"user_id": user.ID,
-		"id":      trackingID,
+		"organization_id": member.OrganizationID,
+		"id":              trackingID,
+	}
+	tracking, err := data.GetDomainTracking(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	context, err := historyContext(c.UserContext(), tracking.ID, c.Query("range"), time.Now())
+	if err != nil {
+		return err
+	}
+	trackingTags, err := data.GetTrackingTags(c.UserContext(), []int64{tracking.ID})
+	if err != nil {
+		return err
 	}
-	tracking, err := data.GetDomainTracking(query)
+	tracking.Tags = trackingTags[tracking.ID]
+	tags, err := data.GetOrganizationTags(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
-	context := fiber.Map{
-		"tracking": tracking,
+	projects, environments, err := data.GetOrganizationTrackingGroups(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	context["trackingTags"] = strings.Join(tracking.Tags, ", ")
+	if len(tracking.BadgeToken) > 0 {
+		context["badgeURL"] = c.BaseURL() + "/badge/" + tracking.BadgeToken + ".svg"
+	}
+	context["tags"] = tags
+	context["projects"] = projects
+	context["environments"] = environments
+	for key, value := range trackingStatusContext(tracking, account) {
+		context[key] = value
 	}
 	return c.Render("domains/show", context)
 }
 
-func HandleSendTestNotification(c *fiber.Ctx) error {
-	time.Sleep(time.Second * 5)
-	fmt.Println("sending notification!!!!")
-	return c.Send([]byte("notification sent"))
+// trackingStatusContext returns what the status partial of the tracking page
+// needs to render.
+func trackingStatusContext(tracking *data.DomainTracking, account *data.Account) fiber.Map {
+	return fiber.Map{
+		"tracking":            tracking,
+		"isSnoozed":           tracking.IsSnoozed(time.Now()),
+		"pollIntervalOptions": pollIntervalOptions(account.Plan),
+	}
+}
+
+// HandleDomainSnooze suppresses all notifications of the tracking until the
+// start of the given date in the timezone of the account. An empty date will
+// unsnooze the tracking.
+func HandleDomainSnooze(c *fiber.Ctx) error {
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	var (
+		trackingID = c.Params("id")
+		snoozeDate = c.FormValue("snoozeUntil")
+		until      time.Time
+	)
+	if len(snoozeDate) > 0 {
+		until, err = parseSnoozeDate(account, snoozeDate)
+		if err != nil {
+			return AppError(err)
+		}
+	}
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              trackingID,
+	}
+	if err := data.UpdateDomainTrackingSnooze(query, until); err != nil {
+		return err
+	}
+	return c.Redirect("/domains/" + trackingID)
+}
+
+// parseSnoozeDate returns the start of the date in the timezone of the
+// account, which should be in the future.
+func parseSnoozeDate(account *data.Account, date string) (time.Time, error) {
+	loc, err := time.LoadLocation(account.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	until, err := time.ParseInLocation(time.DateOnly, date, loc)
+	if err != nil || until.Before(time.Now()) {
+		return time.Time{}, fmt.Errorf("please provide a valid date in the future to snooze until")
+	}
+	return until, nil
+}
+
+func HandleDomainPollInterval(c *fiber.Ctx) error {
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	var (
+		trackingID = c.Params("id")
+		seconds    = c.FormValue("pollIntervalSeconds")
+		valid      = false
+	)
+	for _, option := range pollIntervalOptions(account.Plan) {
+		if strconv.Itoa(option["seconds"].(int)) == seconds {
+			valid = true
+		}
+	}
+	if !valid {
+		return AppError(fmt.Errorf("poll interval not available in the %s plan", account.Plan))
+	}
+	n, _ := strconv.Atoi(seconds)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              trackingID,
+	}
+	if err := data.UpdateDomainTrackingPollInterval(query, n); err != nil {
+		return err
+	}
+	return c.Redirect("/domains/" + trackingID)
 }
 
 func HandleDomainCreate(c *fiber.Ctx) error {
@@ -148,83 +285,132 @@ func HandleDomainCreate(c *fiber.Ctx) error {
 		}
 	}
 
-	user := getAuthenticatedUser(c)
-	account, err := data.GetUserAccount(user.ID)
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
 
 	maxTrackings := settings.Account[account.Plan].MaxTrackings
-	count, err := data.CountUserDomainTrackings(user.ID)
+	count, err := data.CountOrganizationDomainTrackings(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
 	if account.Plan > data.PlanStarter && account.SubscriptionStatus != "active" {
 		logger.Log("error", "subscription status not active", "status", account.SubscriptionStatus)
-		// TODO: ??
 		return AppError(fmt.Errorf("subscription status not active"))
-		return flash.WithData(c, flashData).Redirect("/domains/new")
 	}
 	if len(domains)+count > maxTrackings {
 		flashData["maxTrackings"] = maxTrackings
 		flashData["domains"] = userDomainsInput
 		return flash.WithData(c, flashData).Redirect("/domains/new")
 	}
-	if err := createAllDomainTrackings(user.ID, domains); err != nil {
+	if err := createAllDomainTrackings(c.UserContext(), member, domains); err != nil {
 		return err
 	}
 	return c.Redirect("/domains")
 }
 
-func createAllDomainTrackings(userID string, domains []string) error {
+func createAllDomainTrackings(ctx context.Context, member *data.OrganizationMember, domains []string) error {
 	var (
-		trackings = []*data.DomainTracking{}
-		wg        = sync.WaitGroup{}
+		trackings = make([]*data.DomainTracking, len(domains))
+		targets   = make([]data.ProbeTarget, len(domains))
 	)
-	for _, domain := range domains {
+	for i, domain := range domains {
+		trackings[i] = &data.DomainTracking{
+			DomainName:     domain,
+			UserID:         member.UserID,
+			OrganizationID: member.OrganizationID,
+		}
+		targets[i] = data.DefaultProbeTarget(domain)
+	}
+	pollNewTrackings(ctx, trackings, targets)
+	return data.CreateDomainTrackings(trackings, targets)
+}
+
+// maxConcurrentPolls is the maximum number of targets polled at the same time
+// when creating trackings.
+const maxConcurrentPolls = 15
+
+// pollNewTrackings polls the target at the same index of every new tracking.
+// A failed poll doesn't drop the tracking, it is created with the error and
+// retried by the pulser.
+func pollNewTrackings(ctx context.Context, trackings []*data.DomainTracking, targets []data.ProbeTarget) {
+	var (
+		wg      = sync.WaitGroup{}
+		workers = make(chan struct{}, maxConcurrentPolls)
+	)
+	for i := range trackings {
 		wg.Add(1)
-		go func(domain string) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		go func(i int) {
+			workers <- struct{}{}
+			ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 			defer func() {
 				cancel()
+				<-workers
 				wg.Done()
 			}()
-			trackingInfo, err := ssl.PollDomain(ctx, domain)
+			info, err := ssl.PollTarget(ctx, targets[i])
 			if err != nil {
-				logger.Log("error", "polling domain failed", "err", err, "domain", domain)
-				return
+				logger.Log("error", "polling domain failed", "err", err, "domain", trackings[i].DomainName)
+				info = &data.DomainTrackingInfo{
+					Status:     data.StatusOffline,
+					Error:      err.Error(),
+					LastPollAt: time.Now(),
+				}
 			}
-			tracking := &data.DomainTracking{
-				DomainName:         domain,
-				UserID:             userID,
-				DomainTrackingInfo: *trackingInfo,
-			}
-			trackings = append(trackings, tracking)
-		}(domain)
+			trackings[i].DomainTrackingInfo = *info
+		}(i)
 	}
 	wg.Wait()
-
-	fmt.Println("inserting domains into the database", len(trackings))
-
-	return data.CreateDomainTrackings(trackings)
 }
 
 type TrackingFilter struct {
-	Limit  int
-	Page   int
-	Status string
-	Sort   string
+	Limit       int
+	Page        int
+	Status      string
+	Sort        string
+	Search      string
+	Tag         string
+	Project     string
+	Environment string
 }
 
+// query returns the conditions of the filter for the trackings of the
+// organization.
+func (f *TrackingFilter) query(organizationID int64) fiber.Map {
+	query := fiber.Map{
+		"organization_id": organizationID,
+		data.FilterTag:    f.Tag,
+		data.FilterSearch: f.Search,
+		"project":         f.Project,
+		"environment":     f.Environment,
+	}
+	if len(f.Status) > 0 && f.Status != "all" {
+		query["status"] = f.Status
+	}
+	return query
+}
+
+// encode returns the filter as query parameters, without the page since the
+// links to the pages add it.
 func (f *TrackingFilter) encode() string {
 	values := url.Values{}
 	if f.Limit != 0 {
 		values.Set("limit", strconv.Itoa(f.Limit))
 	}
-	if f.Page != 0 {
-		values.Set("page", strconv.Itoa(f.Page))
-	}
 	values.Set("status", f.Status)
+	for key, value := range map[string]string{
+		"sort":        f.Sort,
+		"search":      f.Search,
+		"tag":         f.Tag,
+		"project":     f.Project,
+		"environment": f.Environment,
+	} {
+		if len(value) > 0 {
+			values.Set(key, value)
+		}
+	}
 	return values.Encode()
 }
 
@@ -234,26 +420,87 @@ func buildTrackingFilter(c *fiber.Ctx) (*TrackingFilter, error) {
 		return nil, err
 	}
 	if filter.Limit == 0 {
-		filter.Limit = 25
+		filter.Limit = defaultTrackingLimit
 	}
+	filter.Search = strings.TrimSpace(filter.Search)
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+	filter.Project = strings.ToLower(strings.TrimSpace(filter.Project))
+	filter.Environment = strings.ToLower(strings.TrimSpace(filter.Environment))
 	return filter, nil
 }
 
-func buildFilterContext(filter *TrackingFilter) fiber.Map {
+func buildFilterContext(ctx context.Context, filter *TrackingFilter, organizationID int64) (fiber.Map, error) {
+	tags, err := data.GetOrganizationTags(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	projects, environments, err := data.GetOrganizationTrackingGroups(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
 	return fiber.Map{
-		"statuses":       statusFilters,
-		"limits":         limitFilters,
-		"selectedStatus": filter.Status,
-		"selectedLimit":  filter.Limit,
-		"selectedPage":   filter.Page,
+		"statuses":            statusFilters,
+		"limits":              limitFilters,
+		"sorts":               sortFilters,
+		"tags":                tags,
+		"projects":            projects,
+		"environments":        environments,
+		"selectedStatus":      filter.Status,
+		"selectedLimit":       filter.Limit,
+		"selectedPage":        filter.Page,
+		"selectedSort":        filter.Sort,
+		"search":              filter.Search,
+		"selectedTag":         filter.Tag,
+		"selectedProject":     filter.Project,
+		"selectedEnvironment": filter.Environment,
+	}, nil
+}
+
+func isValidLimit(limit int) bool {
+	for _, l := range limitFilters {
+		if l == limit {
+			return true
+		}
 	}
+	return false
 }
 
 func buildPages(results int, limit int) []int {
+	if limit <= 0 {
+		return nil
+	}
 	lenPages := float64(results) / float64(limit)
-	pages := make([]int, int(math.RoundToEven(lenPages)))
+	pages := make([]int, int(math.Ceil(lenPages)))
 	for i := 0; i < len(pages); i++ {
 		pages[i] = i + 1
 	}
 	return pages
 }
+
+var pollIntervalChoices = []struct {
+	interval time.Duration
+	name     string
+}{
+	{time.Minute * 5, "every 5 minutes"},
+	{time.Minute * 15, "every 15 minutes"},
+	{time.Hour, "every hour"},
+	{time.Hour * 6, "every 6 hours"},
+	{time.Hour * 12, "every 12 hours"},
+	{time.Hour * 24, "every day"},
+}
+
+// pollIntervalOptions returns the poll intervals a tracking can be configured
+// with. Plans can not poll more often than their default interval.
+func pollIntervalOptions(plan data.Plan) []fiber.Map {
+	planInterval := settings.Account[plan].PollInterval
+	options := []fiber.Map{{"seconds": 0, "name": "plan default"}}
+	for _, choice := range pollIntervalChoices {
+		if choice.interval >= planInterval {
+			options = append(options, fiber.Map{
+				"seconds": int(choice.interval.Seconds()),
+				"name":    choice.name,
+			})
+		}
+	}
+	return options
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sujit-baniya/flash"
+)
+
+type BulkActionParams struct {
+	IDs         []int64
+	Action      string
+	Tag         string
+	SnoozeUntil string
+	QueryParams string
+}
+
+// HandleDomainBulk applies an action to the trackings that were selected in
+// the list. Either all selected trackings are changed or none of them.
+func HandleDomainBulk(c *fiber.Ctx) error {
+	var params BulkActionParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	redirect := "/domains?" + params.QueryParams
+	if len(params.IDs) == 0 {
+		return flash.WithData(c, fiber.Map{"bulkError": "Please select at least 1 domain"}).Redirect(redirect)
+	}
+	member := getMember(c)
+	action := data.BulkAction{Action: params.Action}
+	switch params.Action {
+	case data.BulkTag, data.BulkUntag:
+		tag, ok := data.NormalizeTag(params.Tag)
+		if !ok {
+			bulkError := fmt.Sprintf("Please provide a valid tag, use up to %d letters, digits and - _ . :", data.MaxTagLength)
+			return flash.WithData(c, fiber.Map{"bulkError": bulkError}).Redirect(redirect)
+		}
+		action.Tag = tag
+	case data.BulkSnooze:
+		account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+		if err != nil {
+			return err
+		}
+		until, err := parseSnoozeDate(account, params.SnoozeUntil)
+		if err != nil {
+			return flash.WithData(c, fiber.Map{"bulkError": "Please provide a valid date in the future to snooze until"}).Redirect(redirect)
+		}
+		action.SnoozedUntil = until
+	default:
+		if !isValidBulkAction(params.Action) {
+			return AppError(fmt.Errorf("invalid action %q", params.Action))
+		}
+	}
+	if err := data.ApplyBulkAction(member.OrganizationID, params.IDs, action); err != nil {
+		if err == data.ErrTrackingNotFound {
+			return AppError(fmt.Errorf("some of the selected domains could not be found"))
+		}
+		if err == data.ErrTooManyTags {
+			bulkError := fmt.Sprintf("Some of the selected domains already have %d tags", data.MaxTrackingTags)
+			return flash.WithData(c, fiber.Map{"bulkError": bulkError}).Redirect(redirect)
+		}
+		return err
+	}
+	return c.Redirect(redirect)
+}
+
+func isValidBulkAction(action string) bool {
+	for _, a := range data.BulkActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// trackingEventsBuffer is how many updates are buffered per browser.
+	// Updates for a browser that falls further behind are dropped.
+	trackingEventsBuffer = 64
+	// trackingEventsKeepAlive is how often a comment is sent on idle streams,
+	// so proxies don't close them and closed browsers are noticed.
+	trackingEventsKeepAlive = time.Second * 15
+)
+
+// trackingUpdate is sent to the browser for every tracking event.
+type trackingUpdate struct {
+	ID       int64  `json:"id"`
+	Status   string `json:"status"`
+	Badge    string `json:"badge"`
+	DaysLeft string `json:"daysLeft"`
+	Latency  int    `json:"latency"`
+}
+
+// trackingEventHub fans the tracking events out to the open streams of the
+// owner of the tracking.
+type trackingEventHub struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan data.TrackingEvent]struct{}
+}
+
+var trackingEvents = &trackingEventHub{
+	subscribers: map[int64]map[chan data.TrackingEvent]struct{}{},
+}
+
+func (h *trackingEventHub) subscribe(organizationID int64) chan data.TrackingEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan data.TrackingEvent, trackingEventsBuffer)
+	if h.subscribers[organizationID] == nil {
+		h.subscribers[organizationID] = map[chan data.TrackingEvent]struct{}{}
+	}
+	h.subscribers[organizationID][ch] = struct{}{}
+	return ch
+}
+
+func (h *trackingEventHub) unsubscribe(organizationID int64, ch chan data.TrackingEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[organizationID], ch)
+	if len(h.subscribers[organizationID]) == 0 {
+		delete(h.subscribers, organizationID)
+	}
+}
+
+func (h *trackingEventHub) publish(event data.TrackingEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[event.OrganizationID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// ListenTrackingEvents forwards the tracking events published by the pulser
+// to the open streams until the context is done.
+func ListenTrackingEvents(ctx context.Context) {
+	for {
+		err := data.ListenTrackingEvents(ctx, trackingEvents.publish)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log("error", "listen tracking events", "err", err)
+		time.Sleep(time.Second * 5)
+	}
+}
+
+// HandleDomainEvents streams the poll results of the trackings of the
+// organization as server-sent events, so the tracking list and page update
+// live.
+func HandleDomainEvents(c *fiber.Ctx) error {
+	member := getMember(c)
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		events := trackingEvents.subscribe(member.OrganizationID)
+		defer trackingEvents.unsubscribe(member.OrganizationID, events)
+		keepAlive := time.NewTicker(trackingEventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case event := <-events:
+				b, err := json.Marshal(trackingUpdate{
+					ID:       event.ID,
+					Status:   event.Status,
+					Badge:    BadgeForStatus(event.Status),
+					DaysLeft: util.DaysLeft(event.Expires),
+					Latency:  event.Latency,
+				})
+				if err != nil {
+					logger.Log("error", "encode tracking update", "err", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: tracking\ndata: %s\n\n", b)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			// Flushing fails once the browser is gone.
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}))
+	return nil
+}
+
+// HandleDomainStatus renders the status of the tracking, the tracking page
+// reloads it when a new poll result is streamed.
+func HandleDomainStatus(c *fiber.Ctx) error {
+	member := getMember(c)
+	tracking, err := data.GetDomainTracking(c.UserContext(), fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	})
+	if err != nil {
+		return err
+	}
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	return c.Render("partials/domains/show-status", trackingStatusContext(tracking, account))
+}
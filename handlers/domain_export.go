@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/ssl"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportBatchSize is the number of trackings loaded at once while streaming
+// an export.
+const exportBatchSize = 100
+
+var exportColumns = []string{
+	"domain",
+	"status",
+	"issuer",
+	"expires",
+	"sans",
+	"key_algorithm",
+	"signature_algorithm",
+	"fingerprint_sha256",
+	"last_poll_at",
+	"tags",
+	"notes",
+	"project",
+	"environment",
+}
+
+// exportRow is a tracking as it is exported in the certificate inventory.
+type exportRow struct {
+	Domain             string     `json:"domain"`
+	Status             string     `json:"status"`
+	Issuer             string     `json:"issuer"`
+	Expires            *time.Time `json:"expires"`
+	SANs               []string   `json:"sans"`
+	KeyAlgorithm       string     `json:"key_algorithm"`
+	SignatureAlgorithm string     `json:"signature_algorithm"`
+	FingerprintSHA256  string     `json:"fingerprint_sha256"`
+	LastPollAt         *time.Time `json:"last_poll_at"`
+	Tags               []string   `json:"tags"`
+	Notes              string     `json:"notes"`
+	Project            string     `json:"project"`
+	Environment        string     `json:"environment"`
+}
+
+func newExportRow(tracking *data.DomainTracking) exportRow {
+	row := exportRow{
+		Domain:             tracking.DomainName,
+		Status:             tracking.Status,
+		Issuer:             tracking.Issuer,
+		SANs:               []string{},
+		KeyAlgorithm:       tracking.PublicKeyAlgo,
+		SignatureAlgorithm: tracking.SignatureAlgo,
+		FingerprintSHA256:  ssl.FingerprintPEM(tracking.EncodedPEM),
+		Tags:               []string{},
+		Notes:              tracking.Notes,
+		Project:            tracking.Project,
+		Environment:        tracking.Environment,
+	}
+	if len(tracking.DNSNames) > 0 {
+		row.SANs = strings.Split(tracking.DNSNames, ", ")
+	}
+	if len(tracking.Tags) > 0 {
+		row.Tags = tracking.Tags
+	}
+	// Trackings that never had a successful poll have no certificate.
+	if !tracking.Expires.IsZero() {
+		expires := tracking.Expires.UTC()
+		row.Expires = &expires
+	}
+	if !tracking.LastPollAt.IsZero() {
+		lastPollAt := tracking.LastPollAt.UTC()
+		row.LastPollAt = &lastPollAt
+	}
+	return row
+}
+
+// values returns the row as the cells of the columns in exportColumns.
+func (r exportRow) values() []string {
+	return []string{
+		r.Domain,
+		r.Status,
+		r.Issuer,
+		formatExportTime(r.Expires),
+		strings.Join(r.SANs, " "),
+		r.KeyAlgorithm,
+		r.SignatureAlgorithm,
+		r.FingerprintSHA256,
+		formatExportTime(r.LastPollAt),
+		strings.Join(r.Tags, " "),
+		r.Notes,
+		r.Project,
+		r.Environment,
+	}
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// HandleDomainExport streams all trackings of the organization matching the
+// filter as CSV, JSON or XLSX.
+func HandleDomainExport(c *fiber.Ctx) error {
+	filter, err := buildTrackingFilter(c)
+	if err != nil {
+		return err
+	}
+	if len(filter.Status) > 0 && filter.Status != "all" && !isValidStatus(filter.Status) {
+		return AppError(fmt.Errorf("%s is not a valid status", filter.Status))
+	}
+	var (
+		member = getMember(c)
+		query  = filter.query(member.OrganizationID)
+	)
+
+	var (
+		format   = c.Query("format", "csv")
+		filename = fmt.Sprintf("certpulse-trackings-%s.%s", time.Now().Format("20060102"), format)
+		write    func(w *bufio.Writer, query fiber.Map) error
+	)
+	switch format {
+	case "csv":
+		write = writeExportCSV
+	case "json":
+		write = writeExportJSON
+	case "xlsx":
+		write = writeExportXLSX
+	default:
+		return AppError(fmt.Errorf("unsupported export format %q", format))
+	}
+	c.Attachment(filename)
+	// The no-store header of the app is kept, exports should never be cached.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := write(w, query); err != nil {
+			logger.Log("error", "export failed", "format", format, "organization", member.OrganizationID, "err", err)
+		}
+	})
+	return nil
+}
+
+func writeExportCSV(w *bufio.Writer, query fiber.Map) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return err
+	}
+	err := data.EachDomainTracking(query, exportBatchSize, func(trackings []data.DomainTracking) error {
+		for i := range trackings {
+			values := newExportRow(&trackings[i]).values()
+			for j := range values {
+				values[j] = escapeCSVFormula(values[j])
+			}
+			if err := cw.Write(values); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeCSVFormula prefixes values that spreadsheets would evaluate as a
+// formula, notes are free text and the export is opened by auditors.
+func escapeCSVFormula(value string) string {
+	if len(value) > 0 && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func writeExportJSON(w *bufio.Writer, query fiber.Map) error {
+	if _, err := w.WriteString("["); err != nil {
+		return err
+	}
+	first := true
+	err := data.EachDomainTracking(query, exportBatchSize, func(trackings []data.DomainTracking) error {
+		for i := range trackings {
+			b, err := json.Marshal(newExportRow(&trackings[i]))
+			if err != nil {
+				return err
+			}
+			if !first {
+				w.WriteString(",")
+			}
+			first = false
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteString("]\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writeExportXLSX writes the trackings with the stream writer of excelize,
+// which keeps the memory usage flat for large inventories. The workbook can
+// only be written out as a whole once all rows are added.
+func writeExportXLSX(w *bufio.Writer, query fiber.Map) error {
+	const sheet = "Trackings"
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return err
+	}
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	header := make([]any, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		return err
+	}
+
+	n := 1
+	err = data.EachDomainTracking(query, exportBatchSize, func(trackings []data.DomainTracking) error {
+		for i := range trackings {
+			n++
+			row := newExportRow(&trackings[i])
+			cells := make([]any, len(exportColumns))
+			for j, value := range row.values() {
+				cells[j] = value
+			}
+			// Write the times as dates so they can be sorted and filtered.
+			if row.Expires != nil {
+				cells[3] = excelize.Cell{StyleID: dateStyle, Value: *row.Expires}
+			}
+			if row.LastPollAt != nil {
+				cells[8] = excelize.Cell{StyleID: dateStyle, Value: *row.LastPollAt}
+			}
+			cell, err := excelize.CoordinatesToCellName(1, n)
+			if err != nil {
+				return err
+			}
+			if err := sw.SetRow(cell, cells); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	if err := f.Write(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/importer"
+	"github.com/anthdm/ssltracker/settings"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxImportFileSize = 1 << 20 // 1MB
+
+func HandleDomainImportNew(c *fiber.Ctx) error {
+	return c.Render("domains/import", fiber.Map{})
+}
+
+// HandleDomainImportPreview parses and validates the uploaded file (or pasted
+// input) and renders a preview of the trackings that will be created,
+// together with the problems found per row.
+func HandleDomainImportPreview(c *fiber.Ctx) error {
+	filename, input, err := readImportInput(c)
+	if err != nil {
+		return c.Render("domains/import", fiber.Map{"importError": err.Error()})
+	}
+	format := importer.DetectFormat(filename, input)
+	rows, err := importer.Parse(format, input)
+	if err != nil {
+		return c.Render("domains/import", fiber.Map{
+			"importError": err.Error(),
+			"input":       string(input),
+		})
+	}
+	context, err := importPreviewContext(c.UserContext(), getMember(c).OrganizationID, rows)
+	if err != nil {
+		return err
+	}
+	context["format"] = format
+	return c.Render("domains/import", context)
+}
+
+// HandleDomainImportConfirm creates the trackings of the valid rows of the
+// preview in a single transaction. The rows are validated again, since the
+// trackings or the plan of the organization might have changed since the preview.
+// The trackings are not polled here, imports can be too large to poll within
+// a request. They are created due, so the pulser polls them right away.
+func HandleDomainImportConfirm(c *fiber.Ctx) error {
+	rows, err := importer.Parse(importer.FormatJSON, []byte(c.FormValue("rows")))
+	if err != nil {
+		return c.Render("domains/import", fiber.Map{"importError": err.Error()})
+	}
+	member := getMember(c)
+	context, err := importPreviewContext(c.UserContext(), member.OrganizationID, rows)
+	if err != nil {
+		return err
+	}
+	if len(context["limitError"].(string)) > 0 || context["invalidCount"].(int) > 0 {
+		return c.Render("domains/import", context)
+	}
+
+	var (
+		trackings = make([]*data.DomainTracking, len(rows))
+		targets   = make([]data.ProbeTarget, len(rows))
+	)
+	for i, row := range rows {
+		trackings[i] = &data.DomainTracking{
+			DomainName:     row.Name(),
+			UserID:         member.UserID,
+			OrganizationID: member.OrganizationID,
+			Tags:           row.Tags,
+			Notes:          row.Notes,
+		}
+		targets[i] = row.Target()
+	}
+	if err := data.CreateDomainTrackings(trackings, targets); err != nil {
+		return err
+	}
+	return c.Redirect("/domains")
+}
+
+// importPreviewContext validates the rows against the trackings and the plan
+// of the organization.
+func importPreviewContext(ctx context.Context, organizationID int64, rows []importer.Row) (fiber.Map, error) {
+	account, err := data.GetOrganizationAccount(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := data.GetOrganizationTrackingNames(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	importer.Validate(rows, existing)
+
+	var (
+		valid        = importer.ValidRows(rows)
+		maxTrackings = settings.Account[account.Plan].MaxTrackings
+		limitError   string
+	)
+	switch {
+	case account.Plan > data.PlanStarter && !data.IsPlanActive(account.SubscriptionStatus):
+		limitError = "Your subscription is not active."
+	case len(existing)+len(valid) > maxTrackings:
+		limitError = fmt.Sprintf("With your current plan you can monitor up to a total of %d domains, you are tracking %d and importing %d.",
+			maxTrackings, len(existing), len(valid))
+	}
+	payload, err := json.Marshal(valid)
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"rows":         rows,
+		"validCount":   len(valid),
+		"invalidCount": len(rows) - len(valid),
+		"limitError":   limitError,
+		"payload":      string(payload),
+	}, nil
+}
+
+// readImportInput returns the name and content of the uploaded file, or the
+// pasted input when no file was uploaded.
+func readImportInput(c *fiber.Ctx) (string, []byte, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		input := strings.TrimSpace(c.FormValue("input"))
+		if len(input) == 0 {
+			return "", nil, fmt.Errorf("Please upload a CSV or JSON file or paste a list of hosts")
+		}
+		return "", []byte(input), nil
+	}
+	if file.Size > maxImportFileSize {
+		return "", nil, fmt.Errorf("The import file can be at most 1MB")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	input, err := io.ReadAll(f)
+	return file.Filename, input, err
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/notify"
+	"github.com/anthdm/ssltracker/pkg/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// testNotificationLimiter limits how often an organization can send test
+// notifications, every test reaches all of its channels.
+var testNotificationLimiter = ratelimit.New(3, time.Minute)
+
+// testNotificationResult is the outcome of the test notification of a single
+// channel.
+type testNotificationResult struct {
+	Channel string
+	Target  string
+	Error   string
+}
+
+// HandleSendTestNotification sends a test notification for the tracking to
+// every channel it would be notified on and reports the outcome per channel.
+func HandleSendTestNotification(c *fiber.Ctx) error {
+	member := getMember(c)
+	if !testNotificationLimiter.Allow(strconv.FormatInt(member.OrganizationID, 10), time.Now()) {
+		return c.Render("partials/domains/test-notification", fiber.Map{
+			"testNotificationError": "You can send up to 3 test notifications per minute, please try again in a minute",
+		})
+	}
+	tracking, err := data.GetDomainTracking(c.UserContext(), fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	})
+	if err != nil {
+		return err
+	}
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	tags, err := data.GetTrackingTags(c.UserContext(), []int64{tracking.ID})
+	if err != nil {
+		return err
+	}
+	tracking.Tags = tags[tracking.ID]
+	routes, err := data.GetNotificationRoutes(member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	trackingAndAccount := data.TrackingAndAccount{
+		Account:        *account,
+		DomainTracking: *tracking,
+	}
+	results := sendTestNotifications(c.UserContext(), trackingAndAccount, data.NotificationTargets(trackingAndAccount, routes))
+	return c.Render("partials/domains/test-notification", fiber.Map{
+		"results": results,
+	})
+}
+
+// sendTestNotifications sends the test notifications to all targets at once,
+// so a slow channel doesn't hold up the others.
+func sendTestNotifications(ctx context.Context, tracking data.TrackingAndAccount, targets []data.NotificationTarget) []testNotificationResult {
+	var (
+		results = make([]testNotificationResult, len(targets))
+		wg      = sync.WaitGroup{}
+	)
+	for i, target := range targets {
+		results[i] = testNotificationResult{
+			Channel: target.Channel,
+			Target:  displayTarget(target),
+		}
+		wg.Add(1)
+		go func(i int, target data.NotificationTarget) {
+			defer wg.Done()
+			err := sendTestNotification(ctx, tracking, target)
+			if err != nil {
+				logger.Log("error", "test notification failed", "channel", target.Channel, "err", err)
+				results[i].Error = err.Error()
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+func sendTestNotification(ctx context.Context, tracking data.TrackingAndAccount, target data.NotificationTarget) error {
+	notifier, err := notify.NewForChannel(target.Channel, target.Target)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	return notifier.NotifyTest(ctx, tracking)
+}
+
+// displayTarget returns the target as it is shown to the user. Webhook URLs
+// carry secrets, so only their host is shown.
+func displayTarget(target data.NotificationTarget) string {
+	if target.Channel == data.ChannelEmail {
+		return target.Target
+	}
+	u, err := url.Parse(target.Target)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/ratelimit"
+	"github.com/anthdm/ssltracker/pkg/ssl"
+	"github.com/gofiber/fiber/v2"
+)
+
+// recheckLimiter limits how often an organization can poll its trackings on
+// demand, from the app and the API together.
+var recheckLimiter = ratelimit.New(5, time.Minute)
+
+const recheckLimitMessage = "You can recheck up to 5 domains per minute, please try again in a minute"
+
+// HandleDomainRecheck polls the tracking right away and renders its updated
+// status, so renewed certificates show up without waiting for the next poll.
+func HandleDomainRecheck(c *fiber.Ctx) error {
+	member := getMember(c)
+	tracking, err := data.GetDomainTracking(c.UserContext(), fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	})
+	if err != nil {
+		return err
+	}
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	context := trackingStatusContext(tracking, account)
+	if !recheckLimiter.Allow(strconv.FormatInt(member.OrganizationID, 10), time.Now()) {
+		context["recheckError"] = recheckLimitMessage
+		return c.Render("partials/domains/show-status", context)
+	}
+	if err := recheckTracking(c.UserContext(), tracking); err != nil {
+		return err
+	}
+	context["isSnoozed"] = tracking.IsSnoozed(time.Now())
+	return c.Render("partials/domains/show-status", context)
+}
+
+// recheckTracking polls the probe target of the tracking, or checks the expiry
+// of a static tracking, and saves the result with its history.
+func recheckTracking(ctx context.Context, tracking *data.DomainTracking) error {
+	if tracking.Static {
+		tracking.ApplyPollResult(ssl.CheckExpiry(tracking.DomainTrackingInfo, time.Now()))
+		return data.SavePollResult(*tracking)
+	}
+	target := data.DefaultProbeTarget(tracking.DomainName)
+	if tracking.ProbeTargetID != 0 {
+		targets, err := data.GetProbeTargets([]int64{tracking.ProbeTargetID})
+		if err != nil {
+			return err
+		}
+		if t, ok := targets[tracking.ProbeTargetID]; ok {
+			target = t
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	info, err := ssl.PollTarget(ctx, target)
+	if err != nil {
+		return err
+	}
+	tracking.ApplyPollResult(*info)
+	return data.SavePollResult(*tracking)
+}
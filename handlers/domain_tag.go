@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sujit-baniya/flash"
+)
+
+// HandleDomainLabels replaces the tags, project and environment of the
+// tracking.
+func HandleDomainLabels(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return AppError(fmt.Errorf("invalid tracking id"))
+	}
+	redirect := fmt.Sprintf("/domains/%d", id)
+	tags, err := data.NormalizeTags(strings.Split(c.FormValue("tags"), ","))
+	if err != nil {
+		return flash.WithData(c, fiber.Map{"labelsError": err.Error()}).Redirect(redirect)
+	}
+	project, err := normalizeGroup("project", c.FormValue("project"))
+	if err != nil {
+		return flash.WithData(c, fiber.Map{"labelsError": err.Error()}).Redirect(redirect)
+	}
+	environment, err := normalizeGroup("environment", c.FormValue("environment"))
+	if err != nil {
+		return flash.WithData(c, fiber.Map{"labelsError": err.Error()}).Redirect(redirect)
+	}
+	member := getMember(c)
+	if err := data.UpdateTrackingLabels(member.OrganizationID, id, tags, project, environment); err != nil {
+		if util.IsErrNoRecords(err) {
+			return AppError(fmt.Errorf("tracking not found"))
+		}
+		return err
+	}
+	return c.Redirect(redirect)
+}
+
+// normalizeGroup normalizes a project or environment, which follow the rules
+// of tags. An empty value removes the tracking from the group.
+func normalizeGroup(kind string, value string) (string, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return "", nil
+	}
+	group, ok := data.NormalizeTag(value)
+	if !ok {
+		return "", fmt.Errorf("%q is not a valid %s, use up to %d letters, digits and - _ . :", group, kind, data.MaxTagLength)
+	}
+	return group, nil
+}
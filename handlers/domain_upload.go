@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/ssl"
+	"github.com/anthdm/ssltracker/settings"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sujit-baniya/flash"
+)
+
+const (
+	maxCertificateFileSize = 1 << 20 // 1MB
+	maxTrackingNameLength  = 253
+)
+
+// trackingNameRegex limits the names of static trackings, which are not domain
+// names, to characters that are safe to show anywhere. Names derived from the
+// certificate have the other characters replaced instead.
+var (
+	trackingNameRegex       = regexp.MustCompile(`^[\w .:/@()*-]+$`)
+	trackingNameUnsafeChars = regexp.MustCompile(`[^\w .:/@()*-]+`)
+)
+
+func HandleDomainUploadNew(c *fiber.Ctx) error {
+	return c.Render("domains/upload", fiber.Map{})
+}
+
+// HandleDomainUpload creates a static tracking from an uploaded PEM, DER or
+// PKCS#12 certificate. Static trackings are never polled, they are monitored
+// by the expiry of the certificate alone.
+func HandleDomainUpload(c *fiber.Ctx) error {
+	var (
+		name      = strings.TrimSpace(c.FormValue("name"))
+		flashData = fiber.Map{"name": name}
+	)
+	input, err := readCertificateInput(c)
+	if err != nil {
+		flashData["certificateError"] = err.Error()
+		return flash.WithData(c, flashData).Redirect("/domains/upload")
+	}
+	certs, err := ssl.ParseCertificates(input, c.FormValue("password"))
+	if err != nil {
+		if err == ssl.ErrIncorrectPassword {
+			flashData["passwordError"] = "The password of the PKCS#12 file is incorrect"
+		} else {
+			flashData["certificateError"] = "No certificate found. Make sure the file is a PEM, DER or PKCS#12 (.p12, .pfx) certificate"
+		}
+		return flash.WithData(c, flashData).Redirect("/domains/upload")
+	}
+	if len(name) == 0 {
+		name = certificateName(ssl.LeafCertificate(certs))
+	} else if len(name) > maxTrackingNameLength {
+		flashData["nameError"] = fmt.Sprintf("The name can be at most %d characters long", maxTrackingNameLength)
+		return flash.WithData(c, flashData).Redirect("/domains/upload")
+	} else if !trackingNameRegex.MatchString(name) {
+		flashData["name"] = ""
+		flashData["nameError"] = "The name can only contain letters, digits, spaces and . : / @ ( ) * - _"
+		return flash.WithData(c, flashData).Redirect("/domains/upload")
+	}
+
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if account.Plan > data.PlanStarter && !data.IsPlanActive(account.SubscriptionStatus) {
+		return AppError(fmt.Errorf("subscription status not active"))
+	}
+	maxTrackings := settings.Account[account.Plan].MaxTrackings
+	count, err := data.CountOrganizationDomainTrackings(c.UserContext(), member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if count+1 > maxTrackings {
+		flashData["maxTrackings"] = maxTrackings
+		return flash.WithData(c, flashData).Redirect("/domains/upload")
+	}
+	_, err = data.GetDomainTracking(c.UserContext(), fiber.Map{"organization_id": member.OrganizationID, "domain_name": name})
+	if err == nil {
+		flashData["nameError"] = fmt.Sprintf("You are already tracking %s, choose another name for this certificate", name)
+		return flash.WithData(c, flashData).Redirect("/domains/upload")
+	}
+	if !util.IsErrNoRecords(err) {
+		return err
+	}
+
+	info, err := ssl.InfoFromCertificates(certs, time.Now())
+	if err != nil {
+		return err
+	}
+	tracking := &data.DomainTracking{
+		DomainName:         name,
+		UserID:             member.UserID,
+		OrganizationID:     member.OrganizationID,
+		Static:             true,
+		DomainTrackingInfo: info,
+	}
+	if err := data.InsertDomainTracking(c.UserContext(), tracking); err != nil {
+		return err
+	}
+	return c.Redirect(fmt.Sprintf("/domains/%d", tracking.ID))
+}
+
+// readCertificateInput returns the uploaded certificate file, or the pasted
+// PEM when no file was uploaded.
+func readCertificateInput(c *fiber.Ctx) ([]byte, error) {
+	file, err := c.FormFile("certificate")
+	if err != nil {
+		pem := strings.TrimSpace(c.FormValue("pem"))
+		if len(pem) == 0 {
+			return nil, fmt.Errorf("Please upload a certificate file or paste a PEM encoded certificate")
+		}
+		return []byte(pem), nil
+	}
+	if file.Size > maxCertificateFileSize {
+		return nil, fmt.Errorf("The certificate file can be at most 1MB")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// certificateName returns the name a static tracking gets when none was given:
+// the common name, the first DNS name or the organization of the certificate,
+// with the characters that are not allowed in names replaced. Certificates
+// without any of them are named after their serial number.
+func certificateName(cert *x509.Certificate) string {
+	var name string
+	switch {
+	case len(cert.Subject.CommonName) > 0:
+		name = cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		name = cert.DNSNames[0]
+	case len(cert.Subject.Organization) > 0:
+		name = cert.Subject.Organization[0]
+	}
+	name = strings.Join(strings.Fields(trackingNameUnsafeChars.ReplaceAllString(name, " ")), " ")
+	if len(name) == 0 {
+		name = "certificate"
+		if cert.SerialNumber != nil {
+			name += " " + cert.SerialNumber.Text(16)
+		}
+	}
+	if len(name) > maxTrackingNameLength {
+		name = strings.TrimSpace(name[:maxTrackingNameLength])
+	}
+	return name
+}
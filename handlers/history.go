@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	historyChartWidth  = 720
+	historyChartHeight = 80
+)
+
+var historyRanges = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"24h", time.Hour * 24},
+	{"7d", time.Hour * 24 * 7},
+	{"30d", time.Hour * 24 * 30},
+}
+
+var statusBarColors = map[string]string{
+	"up":      "#22c55e",
+	"down":    "#ef4444",
+	"partial": "#eab308",
+	"none":    "#e5e7eb",
+}
+
+// historyContext builds the uptime percentages and the latency and status
+// charts of the tracking over the given range (24h, 7d or 30d).
+func historyContext(ctx context.Context, trackingID int64, rangeName string, now time.Time) (fiber.Map, error) {
+	selected := historyRanges[0]
+	for _, r := range historyRanges {
+		if r.name == rangeName {
+			selected = r
+		}
+	}
+	longest := historyRanges[len(historyRanges)-1].duration
+	buckets, err := data.GetTrackingHistory(ctx, trackingID, now.Add(-longest), now)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		uptimes = []fiber.Map{}
+		ranges  = []string{}
+	)
+	for _, r := range historyRanges {
+		uptime := data.Uptime(buckets, now.Add(-r.duration))
+		uptimes = append(uptimes, fiber.Map{
+			"name":    r.name,
+			"known":   uptime >= 0,
+			"percent": uptime,
+		})
+		ranges = append(ranges, r.name)
+	}
+
+	var (
+		slots      = int(selected.duration / time.Hour)
+		start      = now.Add(-selected.duration).Truncate(time.Hour).Add(time.Hour)
+		slotWidth  = float64(historyChartWidth) / float64(slots)
+		bySlot     = make(map[int]data.HistoryBucket, slots)
+		maxLatency = 0
+	)
+	for _, bucket := range buckets {
+		slot := int(bucket.Bucket.Sub(start) / time.Hour)
+		if slot < 0 || slot >= slots || bucket.Polls == 0 {
+			continue
+		}
+		bySlot[slot] = bucket
+		if bucket.AvgLatency > maxLatency {
+			maxLatency = bucket.AvgLatency
+		}
+	}
+	var (
+		bars   = make([]fiber.Map, slots)
+		points = []string{}
+	)
+	for slot := 0; slot < slots; slot++ {
+		var (
+			bucket, ok = bySlot[slot]
+			x          = float64(slot) * slotWidth
+			state      = historyState(bucket.Up, bucket.Polls)
+			title      = start.Add(time.Hour*time.Duration(slot)).Format("Jan 02 15:04") + " "
+		)
+		if !ok {
+			title += "no data"
+		} else {
+			title += fmt.Sprintf("%d/%d polls up, %dms", bucket.Up, bucket.Polls, bucket.AvgLatency)
+			y := float64(historyChartHeight)
+			if maxLatency > 0 {
+				y -= float64(bucket.AvgLatency) / float64(maxLatency) * float64(historyChartHeight-4)
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x+slotWidth/2, y))
+		}
+		bars[slot] = fiber.Map{
+			"x":     fmt.Sprintf("%.2f", x),
+			"width": fmt.Sprintf("%.2f", slotWidth),
+			"color": statusBarColors[state],
+			"title": title,
+		}
+	}
+
+	return fiber.Map{
+		"historyRange":  selected.name,
+		"historyRanges": ranges,
+		"uptimes":       uptimes,
+		"statusBars":    bars,
+		"latencyPoints": strings.Join(points, " "),
+		"maxLatency":    maxLatency,
+		"chartWidth":    historyChartWidth,
+		"chartHeight":   historyChartHeight,
+		"hasHistory":    len(bySlot) > 0,
+	}, nil
+}
+
+// historyState returns whether the polls of a period were all up, all down,
+// partially up or if there were no polls at all.
+func historyState(up int, polls int) string {
+	switch {
+	case polls == 0:
+		return "none"
+	case up == polls:
+		return "up"
+	case up == 0:
+		return "down"
+	default:
+		return "partial"
+	}
+}
@@ -11,8 +11,8 @@ import (
 )
 
 func HandleIntegrations(c *fiber.Ctx) error {
-	user := getAuthenticatedUser(c)
-	account, err := data.GetUserAccount(user.ID)
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
@@ -38,8 +38,8 @@ func HandleSlackCallback(c *fiber.Ctx) error {
 		return err
 	}
 
-	user := getAuthenticatedUser(c)
-	account, err := data.GetUserAccount(user.ID)
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
@@ -1,15 +1,23 @@
 package handlers
 
 import (
-	"context"
+	"fmt"
+	"strconv"
 
 	"github.com/anthdm/ssltracker/data"
 	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sujit-baniya/flash"
 )
 
-const localsUserKey = "user"
+const (
+	localsUserKey   = "user"
+	localsMemberKey = "member"
+	// organizationCookie holds the id of the organization the user switched
+	// to last.
+	organizationCookie = "organization"
+)
 
 func WithFlash(c *fiber.Ctx) error {
 	values := flash.Get(c)
@@ -36,7 +44,9 @@ func WithAuthenticatedUser(c *fiber.Ctx) error {
 		return c.Next()
 	}
 
-	user, err := client.Auth.User(context.Background(), token)
+	ctx, span := tracing.Start(c.UserContext(), "supabase.auth.user")
+	user, err := client.Auth.User(ctx, token)
+	tracing.End(span, err)
 	if err != nil {
 		logger.Log("error", "authentication error", "err", "probably invalid access token")
 		c.ClearCookie("accessToken")
@@ -56,3 +66,56 @@ func WithMustBeAuthenticated(c *fiber.Ctx) error {
 	}
 	return c.Next()
 }
+
+// WithOrganization resolves the organization the authenticated user works in
+// from the organization cookie. Users that are not a member of it (anymore)
+// fall back to their first organization. Every query of the request is
+// scoped to the organization of this membership.
+func WithOrganization(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	memberships, err := data.GetUserMemberships(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+	if len(memberships) == 0 {
+		member, err := data.CreatePersonalOrganizationIfNotExist(user)
+		if err != nil {
+			return err
+		}
+		memberships = append(memberships, *member)
+	}
+	member := &memberships[0]
+	if id, err := strconv.ParseInt(c.Cookies(organizationCookie), 10, 64); err == nil {
+		for i := range memberships {
+			if memberships[i].OrganizationID == id {
+				member = &memberships[i]
+			}
+		}
+	}
+	c.Locals(localsMemberKey, member)
+	c.Locals("memberships", memberships)
+	// The views hide the actions the member is not allowed to take.
+	c.Locals("canEdit", member.Role.Can(data.RoleEditor))
+	c.Locals("canAdmin", member.Role.Can(data.RoleAdmin))
+	return c.Next()
+}
+
+// WithRole only allows members with at least the given role in the
+// organization.
+func WithRole(role data.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !getMember(c).Role.Can(role) {
+			return AppError(fmt.Errorf("you need to be %s of the organization to do this", roleWithArticle(role)))
+		}
+		return c.Next()
+	}
+}
+
+func roleWithArticle(role data.Role) string {
+	switch role {
+	case data.RoleOwner, data.RoleAdmin, data.RoleEditor:
+		return "an " + string(role)
+	default:
+		return "a " + string(role)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"github.com/anthdm/ssltracker/data"
+	"github.com/gofiber/fiber/v2"
+)
+
+const notificationLogLimit = 100
+
+func HandleNotificationLog(c *fiber.Ctx) error {
+	member := getMember(c)
+	notifications, err := data.GetOrganizationNotifications(c.UserContext(), member.OrganizationID, notificationLogLimit)
+	if err != nil {
+		return err
+	}
+	suppressed, err := data.GetOrganizationSuppressedNotifications(member.OrganizationID, notificationLogLimit)
+	if err != nil {
+		return err
+	}
+	context := fiber.Map{
+		"notifications": notifications,
+		"suppressed":    suppressed,
+		"maxAttempts":   data.MaxNotificationAttempts,
+	}
+	return c.Render("account/notifications", context)
+}
+
+func HandleNotificationRetry(c *fiber.Ctx) error {
+	member := getMember(c)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+		"state":           data.NotificationStateDead,
+	}
+	if _, err := data.RetryNotification(c.UserContext(), query); err != nil {
+		return err
+	}
+	return c.Redirect("/account/notifications")
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/notify"
+	"github.com/anthdm/ssltracker/pkg/ratelimit"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sujit-baniya/flash"
+)
+
+// invitationCookie remembers the invitation a signed out user followed, so
+// they are sent back to it after signing in.
+const invitationCookie = "invitationToken"
+
+// invitationLimiter limits the invitation emails sent per organization.
+var invitationLimiter = ratelimit.New(20, time.Hour)
+
+func HandleOrganizationShow(c *fiber.Ctx) error {
+	member := getMember(c)
+	members, err := data.GetOrganizationMembers(member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	invitations, err := data.GetPendingInvitations(member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	return c.Render("organization/show", fiber.Map{
+		"members":          members,
+		"invitations":      invitations,
+		"roles":            assignableRoles(member.Role),
+		"defaultRole":      data.RoleEditor,
+		"ownerRole":        data.RoleOwner,
+		"maxOrganizations": data.MaxOrganizations,
+	})
+}
+
+// assignableRoles returns the roles the member can give to others, only
+// owners can make others an owner.
+func assignableRoles(role data.Role) []data.Role {
+	if role == data.RoleOwner {
+		return data.Roles
+	}
+	return data.Roles[1:]
+}
+
+func canAssignRole(member *data.OrganizationMember, role data.Role) bool {
+	for _, r := range assignableRoles(member.Role) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func validateOrganizationName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, len(name) > 0 && len(name) <= data.MaxOrganizationName
+}
+
+func HandleOrganizationUpdate(c *fiber.Ctx) error {
+	name, ok := validateOrganizationName(c.FormValue("name"))
+	if !ok {
+		errors := fiber.Map{"nameError": fmt.Sprintf("Please provide a name of up to %d characters", data.MaxOrganizationName)}
+		return flash.WithData(c, errors).Redirect("/organization")
+	}
+	if err := data.RenameOrganization(getMember(c).OrganizationID, name); err != nil {
+		return err
+	}
+	return c.Redirect("/organization")
+}
+
+// HandleOrganizationCreate creates a new organization with the user as its
+// owner and switches to it.
+func HandleOrganizationCreate(c *fiber.Ctx) error {
+	name, ok := validateOrganizationName(c.FormValue("name"))
+	if !ok {
+		errors := fiber.Map{"newOrganizationError": fmt.Sprintf("Please provide a name of up to %d characters", data.MaxOrganizationName)}
+		return flash.WithData(c, errors).Redirect("/organization")
+	}
+	user := getAuthenticatedUser(c)
+	memberships, err := data.GetUserMemberships(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+	if len(memberships) >= data.MaxOrganizations {
+		return AppError(fmt.Errorf("you can be a member of up to %d organizations", data.MaxOrganizations))
+	}
+	member, err := data.CreateOrganization(name, user)
+	if err != nil {
+		return err
+	}
+	setOrganizationCookie(c, member.OrganizationID)
+	return c.Redirect("/organization")
+}
+
+// HandleOrganizationSwitch makes the organization the user is a member of the
+// one they work in.
+func HandleOrganizationSwitch(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.FormValue("organizationId"), 10, 64)
+	if err != nil {
+		return AppError(fmt.Errorf("invalid organization"))
+	}
+	if _, err := data.GetOrganizationMember(c.UserContext(), id, getAuthenticatedUser(c).ID); err != nil {
+		return err
+	}
+	setOrganizationCookie(c, id)
+	return c.Redirect("/domains")
+}
+
+func setOrganizationCookie(c *fiber.Ctx, id int64) {
+	c.Cookie(&fiber.Cookie{
+		Name:     organizationCookie,
+		Value:    strconv.FormatInt(id, 10),
+		Expires:  time.Now().AddDate(1, 0, 0),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+}
+
+// HandleOrganizationLeave removes the user from the organization, unless they
+// are its last owner.
+func HandleOrganizationLeave(c *fiber.Ctx) error {
+	member := getMember(c)
+	if err := data.DeleteOrganizationMember(member.OrganizationID, member.UserID); err != nil {
+		if err == data.ErrLastOwner {
+			return AppError(err)
+		}
+		return err
+	}
+	c.ClearCookie(organizationCookie)
+	return c.Redirect("/domains")
+}
+
+type UpdateMemberParams struct {
+	Role string
+}
+
+func HandleMemberUpdate(c *fiber.Ctx) error {
+	var params UpdateMemberParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	member := getMember(c)
+	target, err := getManagedMember(c, member)
+	if err != nil {
+		return err
+	}
+	if !data.IsValidRole(params.Role) || !canAssignRole(member, data.Role(params.Role)) {
+		return AppError(fmt.Errorf("you can't give the %s role", params.Role))
+	}
+	if err := data.UpdateOrganizationMemberRole(member.OrganizationID, target.UserID, data.Role(params.Role)); err != nil {
+		if err == data.ErrLastOwner {
+			return AppError(err)
+		}
+		return err
+	}
+	return c.Redirect("/organization")
+}
+
+func HandleMemberDelete(c *fiber.Ctx) error {
+	member := getMember(c)
+	target, err := getManagedMember(c, member)
+	if err != nil {
+		return err
+	}
+	if err := data.DeleteOrganizationMember(member.OrganizationID, target.UserID); err != nil {
+		if err == data.ErrLastOwner {
+			return AppError(err)
+		}
+		return err
+	}
+	return c.Redirect("/organization")
+}
+
+// getManagedMember returns the member of the organization in the path, which
+// only owners can change when it is an owner.
+func getManagedMember(c *fiber.Ctx, member *data.OrganizationMember) (*data.OrganizationMember, error) {
+	target, err := data.GetOrganizationMember(c.UserContext(), member.OrganizationID, c.Params("userID"))
+	if err != nil {
+		return nil, err
+	}
+	if target.Role == data.RoleOwner && member.Role != data.RoleOwner {
+		return nil, AppError(fmt.Errorf("only owners can change other owners"))
+	}
+	return target, nil
+}
+
+type CreateInvitationParams struct {
+	Email string
+	Role  string
+}
+
+// HandleInvitationCreate invites the email address to the organization and
+// sends the link to accept the invitation by email.
+func HandleInvitationCreate(c *fiber.Ctx) error {
+	var params CreateInvitationParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	member := getMember(c)
+	params.Email = strings.TrimSpace(params.Email)
+	if !util.IsValidEmail(params.Email) {
+		return flash.WithData(c, fiber.Map{"invitationError": "Please provide a valid email address"}).Redirect("/organization")
+	}
+	if !data.IsValidRole(params.Role) || !canAssignRole(member, data.Role(params.Role)) {
+		return flash.WithData(c, fiber.Map{"invitationError": "Please select a valid role"}).Redirect("/organization")
+	}
+	if !invitationLimiter.Allow(strconv.FormatInt(member.OrganizationID, 10), time.Now()) {
+		return AppError(fmt.Errorf("too many invitations, please try again later"))
+	}
+	token, invitation, err := data.NewOrganizationInvitation(member.OrganizationID, params.Email, data.Role(params.Role), member.UserID, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := data.InsertOrganizationInvitation(invitation); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.UserContext(), time.Second*10)
+	defer cancel()
+	link := c.BaseURL() + "/invitations/" + token
+	notifier := notify.NewEmailNotifier([]string{invitation.Email})
+	if err := notifier.NotifyInvitation(ctx, *invitation, member.OrganizationName, member.Email, link); err != nil {
+		logger.Log("error", "sending invitation failed", "organizationID", member.OrganizationID, "err", err)
+		if err := data.DeleteOrganizationInvitation(fiber.Map{"id": invitation.ID}); err != nil {
+			return err
+		}
+		return AppError(fmt.Errorf("the invitation could not be sent to %s, please try again", invitation.Email))
+	}
+	return c.Redirect("/organization")
+}
+
+func HandleInvitationDelete(c *fiber.Ctx) error {
+	query := fiber.Map{
+		"organization_id": getMember(c).OrganizationID,
+		"id":              c.Params("id"),
+	}
+	if err := data.DeleteOrganizationInvitation(query); err != nil {
+		return err
+	}
+	return c.Redirect("/organization")
+}
+
+// HandleInvitationShow asks the invited user to join the organization. Signed
+// out users are asked to sign in first.
+func HandleInvitationShow(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if !isUserSignedIn(c) {
+		c.Cookie(&fiber.Cookie{
+			Secure:   true,
+			HTTPOnly: true,
+			Name:     invitationCookie,
+			Value:    url.PathEscape(token),
+			Expires:  time.Now().Add(time.Hour),
+		})
+		return c.Redirect("/signin")
+	}
+	invitation, err := data.GetPendingInvitation(token)
+	if err != nil {
+		if util.IsErrNoRecords(err) {
+			return c.Render("organization/invitation", fiber.Map{"invitationError": invalidInvitationMessage})
+		}
+		return err
+	}
+	return c.Render("organization/invitation", fiber.Map{
+		"invitation": invitation,
+		"token":      token,
+	})
+}
+
+const invalidInvitationMessage = "This invitation was already accepted or has expired, please ask for a new one"
+
+func HandleInvitationAccept(c *fiber.Ctx) error {
+	invitation, err := data.GetPendingInvitation(c.Params("token"))
+	if err == nil {
+		err = data.AcceptOrganizationInvitation(invitation, getAuthenticatedUser(c))
+	}
+	switch {
+	case err == nil:
+	case util.IsErrNoRecords(err):
+		return c.Render("organization/invitation", fiber.Map{"invitationError": invalidInvitationMessage})
+	case err == data.ErrInvitationEmail:
+		return c.Render("organization/invitation", fiber.Map{
+			"invitationError": fmt.Sprintf("This invitation was sent to %s, please sign in with that email address", invitation.Email),
+		})
+	case err == data.ErrTooManyOrganizations:
+		return c.Render("organization/invitation", fiber.Map{
+			"invitationError": fmt.Sprintf("You can be a member of up to %d organizations, please leave one before accepting this invitation", data.MaxOrganizations),
+		})
+	default:
+		return err
+	}
+	setOrganizationCookie(c, invitation.OrganizationID)
+	return c.Redirect("/domains")
+}
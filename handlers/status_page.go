@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/pkg/ratelimit"
+	"github.com/anthdm/ssltracker/settings"
+	"github.com/anthdm/ssltracker/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sujit-baniya/flash"
+)
+
+const (
+	statusPageHistoryDays = 30
+	statusPageCookieAge   = time.Hour * 24 * 30
+
+	statusPagePublic    = "public"
+	statusPageProtected = "password"
+)
+
+// statusPageUnlockLimiter limits the password attempts per visitor and page.
+var statusPageUnlockLimiter = ratelimit.New(10, time.Minute)
+
+type StatusPageParams struct {
+	Title       string
+	Slug        string
+	Visibility  string
+	Password    string
+	TrackingIDs []int64
+}
+
+func (p *StatusPageParams) validate(page *data.StatusPage) fiber.Map {
+	errors := fiber.Map{}
+	p.Title = strings.TrimSpace(p.Title)
+	if len(p.Title) == 0 || len(p.Title) > data.MaxStatusPageTitle {
+		errors["titleError"] = fmt.Sprintf("Please provide a title of up to %d characters", data.MaxStatusPageTitle)
+	}
+	slug, ok := data.NormalizeStatusPageSlug(p.Slug)
+	if !ok {
+		errors["slugError"] = fmt.Sprintf("Please provide a path of up to %d characters, use letters, digits and - separated by /", data.MaxStatusPageSlugLength)
+	}
+	p.Slug = slug
+	switch p.Visibility {
+	case statusPagePublic:
+	case statusPageProtected:
+		// The password of a protected page is only required when it is set.
+		if len(p.Password) == 0 && !page.IsProtected() {
+			errors["passwordError"] = "Please provide a password to protect the page with"
+		}
+	default:
+		errors["passwordError"] = "Please select who can see the page"
+	}
+	if len(p.TrackingIDs) == 0 || len(p.TrackingIDs) > data.MaxStatusPageTrackings {
+		errors["trackingsError"] = fmt.Sprintf("Please select between 1 and %d domains", data.MaxStatusPageTrackings)
+	}
+	return errors
+}
+
+// apply sets the params on the page, keeping the password of a protected page
+// when no new password is given.
+func (p StatusPageParams) apply(page *data.StatusPage) error {
+	page.Title = p.Title
+	page.Slug = p.Slug
+	if p.Visibility == statusPagePublic {
+		return page.SetPassword("")
+	}
+	if len(p.Password) > 0 {
+		return page.SetPassword(p.Password)
+	}
+	return nil
+}
+
+func HandleStatusPageList(c *fiber.Ctx) error {
+	member := getMember(c)
+	pages, err := data.GetStatusPages(member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	return c.Render("status_pages/index", fiber.Map{
+		"pages":    pages,
+		"maxPages": data.MaxStatusPages,
+	})
+}
+
+func HandleStatusPageNew(c *fiber.Ctx) error {
+	context, err := statusPageFormContext(c.UserContext(), getMember(c), &data.StatusPage{}, nil)
+	if err != nil {
+		return err
+	}
+	return c.Render("status_pages/form", context)
+}
+
+func HandleStatusPageCreate(c *fiber.Ctx) error {
+	var params StatusPageParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	member := getMember(c)
+	count, err := data.CountStatusPages(member.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if count >= data.MaxStatusPages {
+		return AppError(fmt.Errorf("you can publish up to %d status pages", data.MaxStatusPages))
+	}
+	page := &data.StatusPage{UserID: member.UserID, OrganizationID: member.OrganizationID}
+	if errors := params.validate(page); len(errors) > 0 {
+		return flash.WithData(c, statusPageFlash(params, errors)).Redirect("/status_pages/new")
+	}
+	if err := params.apply(page); err != nil {
+		return err
+	}
+	if err := data.InsertStatusPage(page, params.TrackingIDs); err != nil {
+		if err == data.ErrStatusPageSlugTaken {
+			errors := fiber.Map{"slugError": "This path is already taken, please choose another one"}
+			return flash.WithData(c, statusPageFlash(params, errors)).Redirect("/status_pages/new")
+		}
+		return err
+	}
+	return c.Redirect("/status_pages")
+}
+
+func HandleStatusPageEdit(c *fiber.Ctx) error {
+	member := getMember(c)
+	page, err := data.GetStatusPage(fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	})
+	if err != nil {
+		return err
+	}
+	trackings, err := data.GetStatusPageTrackings(page.ID)
+	if err != nil {
+		return err
+	}
+	selected := make([]int64, len(trackings))
+	for i, tracking := range trackings {
+		selected[i] = tracking.ID
+	}
+	context, err := statusPageFormContext(c.UserContext(), member, page, selected)
+	if err != nil {
+		return err
+	}
+	return c.Render("status_pages/form", context)
+}
+
+func HandleStatusPageUpdate(c *fiber.Ctx) error {
+	var params StatusPageParams
+	if err := c.BodyParser(&params); err != nil {
+		return err
+	}
+	member := getMember(c)
+	page, err := data.GetStatusPage(fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	})
+	if err != nil {
+		return err
+	}
+	redirect := fmt.Sprintf("/status_pages/%d", page.ID)
+	if errors := params.validate(page); len(errors) > 0 {
+		return flash.WithData(c, statusPageFlash(params, errors)).Redirect(redirect)
+	}
+	if err := params.apply(page); err != nil {
+		return err
+	}
+	if err := data.UpdateStatusPage(page, params.TrackingIDs); err != nil {
+		if err == data.ErrStatusPageSlugTaken {
+			errors := fiber.Map{"slugError": "This path is already taken, please choose another one"}
+			return flash.WithData(c, statusPageFlash(params, errors)).Redirect(redirect)
+		}
+		return err
+	}
+	return c.Redirect("/status_pages")
+}
+
+func HandleStatusPageDelete(c *fiber.Ctx) error {
+	member := getMember(c)
+	query := fiber.Map{
+		"organization_id": member.OrganizationID,
+		"id":              c.Params("id"),
+	}
+	if err := data.DeleteStatusPage(query); err != nil {
+		return err
+	}
+	return c.Redirect("/status_pages")
+}
+
+// statusPageFormContext lists the trackings of the organization that can be
+// selected for the page.
+func statusPageFormContext(ctx context.Context, member *data.OrganizationMember, page *data.StatusPage, selected []int64) (fiber.Map, error) {
+	account, err := data.GetOrganizationAccount(ctx, member.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	trackings, err := data.GetDomainTrackings(ctx, fiber.Map{"organization_id": member.OrganizationID}, "domain", settings.Account[account.Plan].MaxTrackings, 0)
+	if err != nil {
+		return nil, err
+	}
+	isSelected := make(map[int64]bool, len(selected))
+	for _, id := range selected {
+		isSelected[id] = true
+	}
+	options := make([]fiber.Map, len(trackings))
+	for i, tracking := range trackings {
+		options[i] = fiber.Map{
+			"id":       tracking.ID,
+			"domain":   tracking.DomainName,
+			"selected": isSelected[tracking.ID],
+		}
+	}
+	visibility := statusPagePublic
+	if page.IsProtected() {
+		visibility = statusPageProtected
+	}
+	return fiber.Map{
+		"page":       page,
+		"visibility": visibility,
+		"trackings":  options,
+	}, nil
+}
+
+// statusPageFlash keeps the input of the form next to the errors, so it can
+// be filled in again.
+func statusPageFlash(params StatusPageParams, errors fiber.Map) fiber.Map {
+	errors["title"] = params.Title
+	errors["slug"] = params.Slug
+	return errors
+}
+
+// HandleStatusPage renders the public status page at the path after /status/.
+// Protected pages ask for the password until it was entered.
+func HandleStatusPage(c *fiber.Ctx) error {
+	page, err := getPublishedStatusPage(c)
+	if err != nil {
+		return err
+	}
+	if page.IsProtected() && c.Cookies(statusPageCookie(page)) != page.AccessToken() {
+		return c.Render("status_pages/password", fiber.Map{"page": page})
+	}
+	trackings, err := data.GetStatusPageTrackings(page.ID)
+	if err != nil {
+		return err
+	}
+	var (
+		now     = time.Now()
+		items   = make([]fiber.Map, len(trackings))
+		allUp   = true
+		history = time.Hour * 24 * statusPageHistoryDays
+	)
+	for i, tracking := range trackings {
+		buckets, err := data.GetTrackingHistory(c.UserContext(), tracking.ID, now.Add(-history), now)
+		if err != nil {
+			return err
+		}
+		if !data.IsUp(tracking.Status) {
+			allUp = false
+		}
+		items[i] = fiber.Map{
+			"domain":   tracking.DomainName,
+			"status":   tracking.Status,
+			"daysLeft": util.DaysLeft(tracking.Expires),
+			"bars":     dailyStatusBars(buckets, now, statusPageHistoryDays),
+		}
+	}
+	return c.Render("status_pages/show", fiber.Map{
+		"page":        page,
+		"trackings":   items,
+		"allUp":       allUp,
+		"historyDays": statusPageHistoryDays,
+		"updatedAt":   now.UTC().Format("Jan 02 15:04 MST"),
+	})
+}
+
+// HandleStatusPageUnlock checks the password of a protected status page and
+// remembers it in a cookie that is scoped to the page.
+func HandleStatusPageUnlock(c *fiber.Ctx) error {
+	page, err := getPublishedStatusPage(c)
+	if err != nil {
+		return err
+	}
+	redirect := "/status/" + page.Slug
+	if !statusPageUnlockLimiter.Allow(c.IP()+" "+page.Slug, time.Now()) {
+		return c.Render("status_pages/password", fiber.Map{
+			"page":          page,
+			"passwordError": "Too many attempts, please try again in a minute",
+		})
+	}
+	if !page.CheckPassword(c.FormValue("password")) {
+		return c.Render("status_pages/password", fiber.Map{
+			"page":          page,
+			"passwordError": "The password is not correct",
+		})
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     statusPageCookie(page),
+		Value:    page.AccessToken(),
+		Path:     redirect,
+		Expires:  time.Now().Add(statusPageCookieAge),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+	return c.Redirect(redirect)
+}
+
+func getPublishedStatusPage(c *fiber.Ctx) (*data.StatusPage, error) {
+	slug, ok := data.NormalizeStatusPageSlug(c.Params("*"))
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return data.GetStatusPage(fiber.Map{"slug": slug})
+}
+
+func statusPageCookie(page *data.StatusPage) string {
+	return "statusPage" + strconv.FormatInt(page.ID, 10)
+}
+
+// dailyStatusBars aggregates the hourly history into one bar per day for the
+// given number of days up to now.
+func dailyStatusBars(buckets []data.HistoryBucket, now time.Time, days int) []fiber.Map {
+	var (
+		start = now.Truncate(time.Hour*24).AddDate(0, 0, -days+1)
+		up    = make([]int, days)
+		polls = make([]int, days)
+		bars  = make([]fiber.Map, days)
+	)
+	for _, bucket := range buckets {
+		day := int(bucket.Bucket.Sub(start) / (time.Hour * 24))
+		if day < 0 || day >= days {
+			continue
+		}
+		up[day] += bucket.Up
+		polls[day] += bucket.Polls
+	}
+	for day := 0; day < days; day++ {
+		title := start.AddDate(0, 0, day).Format("Jan 02") + " "
+		if polls[day] == 0 {
+			title += "no data"
+		} else {
+			title += fmt.Sprintf("%.2f%% up", float64(up[day])/float64(polls[day])*100)
+		}
+		bars[day] = fiber.Map{
+			"color": statusBarColors[historyState(up[day], polls[day])],
+			"title": title,
+		}
+	}
+	return bars
+}
@@ -64,8 +64,8 @@ func HandleStripeCheckoutSuccess(c *fiber.Ctx) error {
 	}
 	// The checkout session may be complete but the payment processing may still be in process.
 	// Available checkout session statuses (open, complete, expired)
-	user := getAuthenticatedUser(c)
-	account, err := data.GetUserAccount(user.ID)
+	member := getMember(c)
+	account, err := data.GetOrganizationAccount(c.UserContext(), member.OrganizationID)
 	if err != nil {
 		return err
 	}
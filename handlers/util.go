@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"fmt"
+
 	"github.com/anthdm/ssltracker/data"
 	"github.com/gofiber/fiber/v2"
 )
@@ -17,3 +19,36 @@ func getAuthenticatedUser(c *fiber.Ctx) *data.User {
 	}
 	return nil
 }
+
+// getMember returns the membership of the authenticated user in the
+// organization resolved by WithOrganization.
+func getMember(c *fiber.Ctx) *data.OrganizationMember {
+	value := c.Locals(localsMemberKey)
+	if member, ok := value.(*data.OrganizationMember); ok {
+		return member
+	}
+	return nil
+}
+
+// BadgeForStatus renders the badge of a tracking status. It is used by the
+// templates and by the live updates of the tracking list.
+func BadgeForStatus(status string) string {
+	switch status {
+	case data.StatusOffline:
+		return fmt.Sprintf(`<div class="badge badge-accent">%s</div>`, status)
+	case data.StatusHealthy:
+		return fmt.Sprintf(`<div class="badge badge-success">%s</div>`, status)
+	case data.StatusExpires:
+		return fmt.Sprintf(`<div class="badge badge-warning">%s</div>`, status)
+	case data.StatusExpired:
+		return fmt.Sprintf(`<div class="badge badge-accent">%s</div>`, status)
+	case data.StatusUnresponsive:
+		return fmt.Sprintf(`<div class="badge badge-accent">%s</div>`, status)
+	case data.StatusInvalid:
+		return fmt.Sprintf(`<div class="badge badge-error">%s</div>`, status)
+	case "":
+		// Not polled yet, the pulser picks up new trackings right away.
+		return `<div class="badge badge-ghost">pending</div>`
+	}
+	return ""
+}
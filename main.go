@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log"
@@ -13,6 +14,8 @@ import (
 	"github.com/anthdm/ssltracker/db"
 	"github.com/anthdm/ssltracker/handlers"
 	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/metrics"
+	"github.com/anthdm/ssltracker/pkg/tracing"
 	"github.com/anthdm/ssltracker/util"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/favicon"
@@ -28,10 +31,19 @@ func main() {
 	}
 	db.Init()
 	logger.Init()
+	shutdownTracing, err := tracing.Init(context.Background(), "ssltracker-web")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+	go handlers.ListenTrackingEvents(context.Background())
 
 	app.Static("/static", "./static", fiber.Static{
 		CacheDuration: 0,
 	})
+	app.Use(tracing.WithTracing)
+	app.Use(metrics.WithHTTPMetrics)
+	go serveMetrics(metricsListenAddr())
 	app.Use(func(c *fiber.Ctx) error {
 		c.Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
 		c.Set("Pragma", "no-cache")
@@ -41,6 +53,9 @@ func main() {
 	})
 	app.Use(favicon.New(favicon.ConfigDefault))
 	app.Use(recover.New())
+	// The API authenticates with API keys only, it is registered before the
+	// middlewares of the web app that read the session cookie.
+	registerAPIRoutes(app)
 	app.Use(handlers.WithFlash)
 	app.Use(handlers.WithAuthenticatedUser)
 	app.Use(handlers.WithViewHelpers)
@@ -54,32 +69,123 @@ func main() {
 	app.Post("/signup", handlers.HandleSignupWithEmail)
 	app.Get("/auth/callback/:accessToken", handlers.HandleAuthCallback)
 
-	domains := app.Group("/domains", handlers.WithMustBeAuthenticated)
+	var (
+		editor = handlers.WithRole(data.RoleEditor)
+		admin  = handlers.WithRole(data.RoleAdmin)
+		owner  = handlers.WithRole(data.RoleOwner)
+	)
+
+	domains := app.Group("/domains", handlers.WithMustBeAuthenticated, handlers.WithOrganization)
 	domains.Get("/", handlers.HandleDomainList)
-	domains.Post("/", handlers.HandleDomainCreate)
-	domains.Get("/new", handlers.HandleDomainNew)
+	domains.Post("/", editor, handlers.HandleDomainCreate)
+	domains.Get("/new", editor, handlers.HandleDomainNew)
+	domains.Get("/upload", editor, handlers.HandleDomainUploadNew)
+	domains.Post("/upload", editor, handlers.HandleDomainUpload)
+	domains.Get("/export", handlers.HandleDomainExport)
+	domains.Get("/import", editor, handlers.HandleDomainImportNew)
+	domains.Post("/import", editor, handlers.HandleDomainImportPreview)
+	domains.Post("/import/confirm", editor, handlers.HandleDomainImportConfirm)
+	domains.Post("/bulk", editor, handlers.HandleDomainBulk)
+	domains.Get("/events", handlers.HandleDomainEvents)
 	domains.Get("/:id", handlers.HandleDomainShow)
+	domains.Get("/:id/status", handlers.HandleDomainStatus)
 	domains.Get("/:id/raw", handlers.HandleDomainShowRaw)
-	domains.Post("/:id/delete", handlers.HandleDomainDelete)
-	domains.Get("/:id/test_notification", handlers.HandleSendTestNotification)
+	domains.Post("/:id/delete", editor, handlers.HandleDomainDelete)
+	domains.Post("/:id/snooze", editor, handlers.HandleDomainSnooze)
+	domains.Post("/:id/recheck", editor, handlers.HandleDomainRecheck)
+	domains.Post("/:id/poll_interval", editor, handlers.HandleDomainPollInterval)
+	domains.Post("/:id/labels", editor, handlers.HandleDomainLabels)
+	domains.Post("/:id/badge", editor, handlers.HandleDomainBadge)
+	domains.Post("/:id/badge/revoke", editor, handlers.HandleDomainBadgeRevoke)
+	domains.Post("/:id/test_notification", editor, handlers.HandleSendTestNotification)
 
-	account := app.Group("/account", handlers.WithMustBeAuthenticated)
+	account := app.Group("/account", handlers.WithMustBeAuthenticated, handlers.WithOrganization)
 	account.Get("/", handlers.HandleAccountShow)
-	account.Post("/", handlers.HandleAccountUpdate)
+	account.Post("/", admin, handlers.HandleAccountUpdate)
+	account.Post("/maintenance_windows", admin, handlers.HandleMaintenanceWindowCreate)
+	account.Post("/maintenance_windows/:id/delete", admin, handlers.HandleMaintenanceWindowDelete)
+	account.Post("/notification_routes", admin, handlers.HandleNotificationRouteCreate)
+	account.Post("/notification_routes/:id/delete", admin, handlers.HandleNotificationRouteDelete)
+	account.Get("/notifications", handlers.HandleNotificationLog)
+	account.Post("/notifications/:id/retry", admin, handlers.HandleNotificationRetry)
+	account.Post("/api_keys", admin, handlers.HandleAPIKeyCreate)
+	account.Post("/api_keys/:id/revoke", admin, handlers.HandleAPIKeyRevoke)
+
+	organization := app.Group("/organization", handlers.WithMustBeAuthenticated, handlers.WithOrganization)
+	organization.Get("/", handlers.HandleOrganizationShow)
+	organization.Post("/", admin, handlers.HandleOrganizationUpdate)
+	organization.Post("/leave", handlers.HandleOrganizationLeave)
+	organization.Post("/invitations", admin, handlers.HandleInvitationCreate)
+	organization.Post("/invitations/:id/delete", admin, handlers.HandleInvitationDelete)
+	organization.Post("/members/:userID", admin, handlers.HandleMemberUpdate)
+	organization.Post("/members/:userID/delete", admin, handlers.HandleMemberDelete)
 
-	integrations := app.Group("/integrations", handlers.WithMustBeAuthenticated)
+	organizations := app.Group("/organizations", handlers.WithMustBeAuthenticated)
+	organizations.Post("/", handlers.HandleOrganizationCreate)
+	organizations.Post("/switch", handlers.HandleOrganizationSwitch)
+
+	app.Get("/invitations/:token", handlers.HandleInvitationShow)
+	app.Post("/invitations/:token", handlers.WithMustBeAuthenticated, handlers.HandleInvitationAccept)
+
+	statusPages := app.Group("/status_pages", handlers.WithMustBeAuthenticated, handlers.WithOrganization)
+	statusPages.Get("/", handlers.HandleStatusPageList)
+	statusPages.Get("/new", editor, handlers.HandleStatusPageNew)
+	statusPages.Post("/", editor, handlers.HandleStatusPageCreate)
+	statusPages.Get("/:id", editor, handlers.HandleStatusPageEdit)
+	statusPages.Post("/:id", editor, handlers.HandleStatusPageUpdate)
+	statusPages.Post("/:id/delete", editor, handlers.HandleStatusPageDelete)
+
+	app.Get("/badge/:token.svg", handlers.HandleBadge)
+	app.Get("/status/*", handlers.HandleStatusPage)
+	app.Post("/status/*", handlers.HandleStatusPageUnlock)
+
+	integrations := app.Group("/integrations", handlers.WithMustBeAuthenticated, handlers.WithOrganization)
 	integrations.Get("/", handlers.HandleIntegrations)
-	integrations.Get("/slack/callback", handlers.HandleSlackCallback)
+	integrations.Get("/slack/callback", admin, handlers.HandleSlackCallback)
 
 	stripe := app.Group("/stripe")
 	stripe.Post("/checkout", handlers.HandleStripeCheckoutCreate)
-	stripe.Get("/checkout/success", handlers.HandleStripeCheckoutSuccess)
+	stripe.Get("/checkout/success", handlers.WithMustBeAuthenticated, handlers.WithOrganization, owner, handlers.HandleStripeCheckoutSuccess)
 	stripe.Get("/checkout/cancel", handlers.HandleStripeCheckoutCancel)
 	stripe.Post("/webhook", handlers.HandleStripeWebhook)
 
 	log.Fatal(app.Listen(":3000"))
 }
 
+// registerAPIRoutes registers the routes of the public JSON API. The spec is
+// public, all other routes are authenticated with an API key.
+func registerAPIRoutes(app *fiber.App) {
+	app.Get("/api/v1/openapi.yaml", handlers.HandleAPISpec)
+	api := app.Group("/api/v1", handlers.WithAPIErrors, handlers.WithAPIKey)
+	api.Get("/account", handlers.WithAPIScope(data.ScopeRead), handlers.HandleAPIAccount)
+	api.Get("/trackings", handlers.WithAPIScope(data.ScopeRead), handlers.HandleAPITrackingList)
+	api.Post("/trackings", handlers.WithAPIScope(data.ScopeWrite), handlers.HandleAPITrackingCreate)
+	api.Get("/trackings/:id", handlers.WithAPIScope(data.ScopeRead), handlers.HandleAPITrackingShow)
+	api.Delete("/trackings/:id", handlers.WithAPIScope(data.ScopeWrite), handlers.HandleAPITrackingDelete)
+	api.Post("/trackings/:id/recheck", handlers.WithAPIScope(data.ScopeWrite), handlers.HandleAPITrackingRecheck)
+	api.Get("/notifications", handlers.WithAPIScope(data.ScopeRead), handlers.HandleAPINotificationList)
+	api.Post("/notifications/:id/retry", handlers.WithAPIScope(data.ScopeWrite), handlers.HandleAPINotificationRetry)
+}
+
+const defaultMetricsListenAddr = ":3002"
+
+// serveMetrics serves the Prometheus metrics on an internal listener, so they
+// are not exposed on the public port of the app.
+func serveMetrics(addr string) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/metrics", metrics.Handler())
+	if err := app.Listen(addr); err != nil {
+		logger.Log("error", "metrics listener failed", "addr", addr, "err", err)
+	}
+}
+
+func metricsListenAddr() string {
+	if addr := os.Getenv("METRICS_ADDR"); len(addr) > 0 {
+		return addr
+	}
+	return defaultMetricsListenAddr
+}
+
 func initApp() (*fiber.App, error) {
 	if err := godotenv.Load(); err != nil {
 		return nil, err
@@ -110,23 +216,7 @@ func createEngine() *django.Engine {
 		return
 	})
 
-	engine.AddFunc("badgeForStatus", func(status string) (res string) {
-		switch status {
-		case data.StatusOffline:
-			return fmt.Sprintf(`<div class="badge badge-accent">%s</div>`, status)
-		case data.StatusHealthy:
-			return fmt.Sprintf(`<div class="badge badge-success">%s</div>`, status)
-		case data.StatusExpires:
-			return fmt.Sprintf(`<div class="badge badge-warning">%s</div>`, status)
-		case data.StatusExpired:
-			return fmt.Sprintf(`<div class="badge badge-accent">%s</div>`, status)
-		case data.StatusUnresponsive:
-			return fmt.Sprintf(`<div class="badge badge-accent">%s</div>`, status)
-		case data.StatusInvalid:
-			return fmt.Sprintf(`<div class="badge badge-error">%s</div>`, status)
-		}
-		return ""
-	})
+	engine.AddFunc("badgeForStatus", handlers.BadgeForStatus)
 
 	engine.AddFunc("formatTime", func(t time.Time) (res string) {
 		timeZero := time.Time{}
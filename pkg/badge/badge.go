@@ -0,0 +1,79 @@
+// Package badge renders shields style SVG badges with a label and a message.
+package badge
+
+import (
+	"fmt"
+	"html"
+)
+
+const (
+	ColorGreen  = "#4c1"
+	ColorYellow = "#dfb317"
+	ColorOrange = "#fe7d37"
+	ColorRed    = "#e05d44"
+	ColorGrey   = "#9f9f9f"
+
+	labelColor = "#555"
+	// padding is the space left and right of the text of each half.
+	padding = 6
+)
+
+// narrowChars and wideChars are rendered narrower and wider than the average
+// character of Verdana at 11px. The widths are estimates, the badge is not
+// rendered with the font, but close enough for the text to fit.
+var (
+	narrowChars = map[rune]float64{
+		'i': 3, 'l': 3, 'j': 3.5, 't': 4.5, 'f': 4, 'r': 5, ' ': 3.5,
+		'.': 3.5, ',': 3.5, ':': 4, ';': 4, '|': 4, '!': 4, '\'': 3, '-': 5,
+	}
+	wideChars = map[rune]float64{
+		'm': 10.5, 'w': 9, 'M': 9.5, 'W': 11, '@': 11, '%': 11.5,
+	}
+)
+
+const averageCharWidth = 7
+
+// Render returns the SVG of a badge with the label on the left and the
+// message on the right in the given color.
+func Render(label string, message string, color string) []byte {
+	var (
+		labelWidth   = textWidth(label) + padding*2
+		messageWidth = textWidth(message) + padding*2
+		width        = labelWidth + messageWidth
+		title        = html.EscapeString(label + ": " + message)
+		labelText    = html.EscapeString(label)
+		messageText  = html.EscapeString(message)
+		labelX       = labelWidth / 2
+		messageX     = labelWidth + messageWidth/2
+	)
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s">`+
+		`<title>%s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%d" height="20" fill="%s"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+
+		`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+
+		`</g></svg>`,
+		width, title,
+		title,
+		width,
+		labelWidth, labelColor, labelWidth, messageWidth, color, width,
+		labelX, labelText, labelX, labelText,
+		messageX, messageText, messageX, messageText,
+	))
+}
+
+func textWidth(text string) int {
+	var width float64
+	for _, r := range text {
+		if w, ok := narrowChars[r]; ok {
+			width += w
+		} else if w, ok := wideChars[r]; ok {
+			width += w
+		} else {
+			width += averageCharWidth
+		}
+	}
+	return int(width + 0.5)
+}
@@ -0,0 +1,31 @@
+package badge
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	svg := Render("certificate", "healthy | 42 days", ColorGreen)
+	if err := xml.Unmarshal(svg, new(struct{})); err != nil {
+		t.Fatalf("expected valid XML got %s: %s", err, svg)
+	}
+	if !bytes.Contains(svg, []byte("healthy | 42 days")) || !bytes.Contains(svg, []byte(ColorGreen)) {
+		t.Fatalf("expected the message in green got %s", svg)
+	}
+
+	svg = Render("<cert>", "a & b", ColorRed)
+	if err := xml.Unmarshal(svg, new(struct{})); err != nil {
+		t.Fatalf("expected the text to be escaped got %s: %s", err, svg)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if textWidth("iiii") >= textWidth("mmmm") {
+		t.Fatal("expected narrow characters to take less space than wide ones")
+	}
+	if textWidth("") != 0 {
+		t.Fatal("expected no width for an empty text")
+	}
+}
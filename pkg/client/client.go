@@ -0,0 +1,263 @@
+// Package client is a Go client for the CertPulse /api/v1 API. The API is
+// described by the OpenAPI specification served at /api/v1/openapi.yaml.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultBaseURL = "https://certpulse.com"
+
+// Error is returned when the API responds with an error.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("certpulse: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// IsNotFound returns true if err is a not found error of the API.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+type Account struct {
+	Plan                string `json:"plan"`
+	SubscriptionStatus  string `json:"subscription_status"`
+	Trackings           int    `json:"trackings"`
+	MaxTrackings        int    `json:"max_trackings"`
+	PollIntervalSeconds int    `json:"poll_interval_seconds"`
+	NotifyUpfrontDays   int    `json:"notify_upfront_days"`
+	NotifyDefaultEmail  string `json:"notify_default_email"`
+	Timezone            string `json:"timezone"`
+}
+
+type Tracking struct {
+	ID                  int64      `json:"id"`
+	Domain              string     `json:"domain"`
+	Status              string     `json:"status"`
+	Issuer              string     `json:"issuer"`
+	Expires             time.Time  `json:"expires"`
+	DNSNames            []string   `json:"dns_names"`
+	ServerIP            string     `json:"server_ip"`
+	SignatureAlgo       string     `json:"signature_algo"`
+	PublicKeyAlgo       string     `json:"public_key_algo"`
+	Signature           string     `json:"signature"`
+	LatencyMS           int        `json:"latency_ms"`
+	Error               string     `json:"error,omitempty"`
+	LastPollAt          time.Time  `json:"last_poll_at"`
+	NextPollAt          time.Time  `json:"next_poll_at"`
+	PollIntervalSeconds int        `json:"poll_interval_seconds,omitempty"`
+	SnoozedUntil        *time.Time `json:"snoozed_until,omitempty"`
+	// Static trackings are created from an uploaded certificate and are
+	// monitored by its expiry only.
+	Static bool `json:"static,omitempty"`
+	// Muted trackings are polled but never notify.
+	Muted bool `json:"muted,omitempty"`
+
+	Tags        []string `json:"tags"`
+	Project     string   `json:"project,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+}
+
+type TrackingList struct {
+	Data  []Tracking `json:"data"`
+	Limit int        `json:"limit"`
+	Page  int        `json:"page"`
+	Total int        `json:"total"`
+}
+
+type ListTrackingsParams struct {
+	// Status filters the trackings on their status, empty or "all" returns
+	// all trackings.
+	Status string
+	// Search only returns the trackings with the text in their domain,
+	// issuer or SANs.
+	Search string
+	// Sort is one of domain, expires, status, latency or last_poll, a
+	// leading "-" reverses the order.
+	Sort string
+	// Tag, Project and Environment only return the trackings in the group.
+	Tag         string
+	Project     string
+	Environment string
+	Limit       int
+	Page        int
+}
+
+type CreateTrackingParams struct {
+	Domain string `json:"domain"`
+}
+
+type Notification struct {
+	ID          int64      `json:"id"`
+	TrackingID  int64      `json:"tracking_id,omitempty"`
+	Domain      string     `json:"domain"`
+	Kind        string     `json:"kind"`
+	Channel     string     `json:"channel"`
+	Status      string     `json:"status"`
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+type NotificationList struct {
+	Data []Notification `json:"data"`
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to make the requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// New returns a client for the API at baseURL (without the /api/v1 path)
+// authenticated with the given API key.
+func New(baseURL, apiKey string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: time.Second * 30},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Account(ctx context.Context) (*Account, error) {
+	account := new(Account)
+	return account, c.do(ctx, http.MethodGet, "/account", nil, account)
+}
+
+func (c *Client) ListTrackings(ctx context.Context, params ListTrackingsParams) (*TrackingList, error) {
+	values := url.Values{}
+	if len(params.Status) > 0 {
+		values.Set("status", params.Status)
+	}
+	if len(params.Search) > 0 {
+		values.Set("search", params.Search)
+	}
+	if len(params.Sort) > 0 {
+		values.Set("sort", params.Sort)
+	}
+	if len(params.Tag) > 0 {
+		values.Set("tag", params.Tag)
+	}
+	if len(params.Project) > 0 {
+		values.Set("project", params.Project)
+	}
+	if len(params.Environment) > 0 {
+		values.Set("environment", params.Environment)
+	}
+	if params.Limit > 0 {
+		values.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.Page > 0 {
+		values.Set("page", strconv.Itoa(params.Page))
+	}
+	path := "/trackings"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	list := new(TrackingList)
+	return list, c.do(ctx, http.MethodGet, path, nil, list)
+}
+
+func (c *Client) GetTracking(ctx context.Context, id int64) (*Tracking, error) {
+	tracking := new(Tracking)
+	return tracking, c.do(ctx, http.MethodGet, fmt.Sprintf("/trackings/%d", id), nil, tracking)
+}
+
+func (c *Client) CreateTracking(ctx context.Context, params CreateTrackingParams) (*Tracking, error) {
+	tracking := new(Tracking)
+	return tracking, c.do(ctx, http.MethodPost, "/trackings", params, tracking)
+}
+
+func (c *Client) DeleteTracking(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/trackings/%d", id), nil, nil)
+}
+
+// RecheckTracking polls the tracking right away and returns the result.
+func (c *Client) RecheckTracking(ctx context.Context, id int64) (*Tracking, error) {
+	tracking := new(Tracking)
+	return tracking, c.do(ctx, http.MethodPost, fmt.Sprintf("/trackings/%d/recheck", id), nil, tracking)
+}
+
+func (c *Client) ListNotifications(ctx context.Context, limit int) (*NotificationList, error) {
+	path := "/notifications"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	list := new(NotificationList)
+	return list, c.do(ctx, http.MethodGet, path, nil, list)
+}
+
+// RetryNotification puts a dead notification back in the delivery queue.
+func (c *Client) RetryNotification(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/notifications/%d/retry", id), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any, v any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v1"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errResp struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == nil {
+			return &Error{StatusCode: resp.StatusCode, Code: "unknown", Message: resp.Status}
+		}
+		errResp.Error.StatusCode = resp.StatusCode
+		return errResp.Error
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
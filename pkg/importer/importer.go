@@ -0,0 +1,378 @@
+// Package importer parses and validates bulk imports of trackings from CSV
+// files, JSON files and plain lists of hosts.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/util"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatList = "list"
+)
+
+const (
+	MaxRows        = 1000
+	maxNotesLength = 500
+)
+
+var (
+	ErrEmpty       = errors.New("the import contains no rows")
+	ErrTooManyRows = fmt.Errorf("an import can contain at most %d rows", MaxRows)
+)
+
+// Row is a tracking to import. Errors holds the problems found while parsing
+// and validating the row, only rows without errors are imported.
+type Row struct {
+	Line   int      `json:"line"`
+	Host   string   `json:"host"`
+	Port   int      `json:"port,omitempty"`
+	SNI    string   `json:"sni,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Notes  string   `json:"notes,omitempty"`
+	Errors []string `json:"-"`
+}
+
+func (r *Row) addError(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Valid returns true if no problems were found with the row.
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Target returns the probe target the tracking of the row will poll.
+func (r Row) Target() data.ProbeTarget {
+	target := data.ProbeTarget{
+		Host: r.Host,
+		Port: r.Port,
+		SNI:  r.SNI,
+	}
+	if target.Port == 0 {
+		target.Port = data.DefaultProbePort
+	}
+	if len(target.SNI) == 0 {
+		target.SNI = target.Host
+	}
+	return target
+}
+
+// Name returns the name the tracking of the row will be created with.
+func (r Row) Name() string {
+	return r.Target().Name()
+}
+
+// DetectFormat returns the format of the input from the extension of the
+// filename, falling back to its content for pasted input.
+func DetectFormat(filename string, input []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	case ".txt":
+		return FormatList
+	}
+	trimmed := bytes.TrimSpace(input)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		return FormatJSON
+	}
+	firstLine, _, _ := strings.Cut(string(trimmed), "\n")
+	if _, ok := csvColumn(strings.Split(firstLine, ",")[0]); ok {
+		return FormatCSV
+	}
+	return FormatList
+}
+
+// Parse parses the input in the given format. An error is only returned when
+// the input as a whole can't be parsed, problems with single rows are
+// recorded on the rows.
+func Parse(format string, input []byte) ([]Row, error) {
+	var (
+		rows []Row
+		err  error
+	)
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(input)
+	case FormatJSON:
+		rows, err = parseJSON(input)
+	case FormatList:
+		rows = parseList(input)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(rows) > MaxRows {
+		return nil, ErrTooManyRows
+	}
+	return rows, nil
+}
+
+var csvColumns = map[string]string{
+	"host":   "host",
+	"domain": "host",
+	"port":   "port",
+	"sni":    "sni",
+	"tags":   "tags",
+	"notes":  "notes",
+}
+
+func csvColumn(header string) (string, bool) {
+	column, ok := csvColumns[strings.ToLower(strings.TrimSpace(header))]
+	return column, ok
+}
+
+// parseCSV parses CSV with a header row naming the columns. Without a header
+// the columns are expected in the order host, port, sni, tags, notes.
+func parseCSV(input []byte) ([]Row, error) {
+	r := csv.NewReader(bytes.NewReader(input))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var (
+		rows    []Row
+		columns = []string{"host", "port", "sni", "tags", "notes"}
+		line    = 0
+	)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line++
+		if line == 1 {
+			if _, ok := csvColumn(record[0]); ok {
+				columns = make([]string, len(record))
+				for i, header := range record {
+					columns[i], _ = csvColumn(header)
+				}
+				continue
+			}
+		}
+		if len(record) == 1 && len(strings.TrimSpace(record[0])) == 0 {
+			continue
+		}
+		row := Row{Line: line}
+		var host, port string
+		for i, value := range record {
+			if i >= len(columns) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch columns[i] {
+			case "host":
+				host = value
+			case "port":
+				port = value
+			case "sni":
+				row.SNI = value
+			case "tags":
+				row.Tags = splitTags(value)
+			case "notes":
+				row.Notes = value
+			}
+		}
+		row.setHost(host, port)
+		rows = append(rows, row)
+		if len(rows) > MaxRows {
+			return nil, ErrTooManyRows
+		}
+	}
+	return rows, nil
+}
+
+type jsonRow struct {
+	Host   string          `json:"host"`
+	Domain string          `json:"domain"`
+	Port   json.RawMessage `json:"port"`
+	SNI    string          `json:"sni"`
+	Tags   json.RawMessage `json:"tags"`
+	Notes  string          `json:"notes"`
+}
+
+// parseJSON parses an array of objects with the host (or domain), port, sni,
+// tags and notes fields. Ports can be numbers or strings and tags can be an
+// array or a single string.
+func parseJSON(input []byte) ([]Row, error) {
+	var jsonRows []jsonRow
+	if err := json.Unmarshal(input, &jsonRows); err != nil {
+		return nil, fmt.Errorf("invalid JSON, expected an array of objects: %w", err)
+	}
+	if len(jsonRows) > MaxRows {
+		return nil, ErrTooManyRows
+	}
+	rows := make([]Row, len(jsonRows))
+	for i, jr := range jsonRows {
+		row := Row{
+			Line:  i + 1,
+			SNI:   strings.TrimSpace(jr.SNI),
+			Notes: strings.TrimSpace(jr.Notes),
+		}
+		host := jr.Host
+		if len(host) == 0 {
+			host = jr.Domain
+		}
+		port := strings.Trim(string(jr.Port), `" `)
+		if port == "null" {
+			port = ""
+		}
+		row.setHost(strings.TrimSpace(host), port)
+		if len(jr.Tags) > 0 && string(jr.Tags) != "null" {
+			var tags []string
+			if err := json.Unmarshal(jr.Tags, &tags); err != nil {
+				var tag string
+				if err := json.Unmarshal(jr.Tags, &tag); err != nil {
+					row.addError("tags should be an array of strings")
+				}
+				tags = splitTags(tag)
+			}
+			row.Tags = tags
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// parseList parses hosts separated by newlines, commas or whitespace. Hosts
+// can include a port (example.com:8443) or be a URL.
+func parseList(input []byte) []Row {
+	var rows []Row
+	for i, line := range strings.Split(string(input), "\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, field := range fields {
+			row := Row{Line: i + 1}
+			row.setHost(field, "")
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// setHost sets the host and port of the row. The host can be a URL or
+// include the port when there is no separate port value.
+func (r *Row) setHost(host string, port string) {
+	host = strings.TrimSpace(host)
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		if len(port) == 0 {
+			port = p
+		}
+	}
+	r.Host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if len(port) == 0 {
+		return
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		r.addError("%s is not a valid port", port)
+		return
+	}
+	r.Port = n
+}
+
+func splitTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ',' || r == '|' || r == ' '
+	})
+}
+
+// Validate checks every row and records the problems on the rows. Rows that
+// are already tracked (by name) or that occur more than once in the import
+// are invalid as well.
+func Validate(rows []Row, existing map[string]bool) {
+	seen := map[string]int{}
+	for i := range rows {
+		row := &rows[i]
+		if len(row.Host) == 0 {
+			row.addError("host is required")
+		} else if !util.IsValidDomainName(row.Host) && net.ParseIP(row.Host) == nil {
+			row.addError("%s is not a valid domain or IP address", row.Host)
+		}
+		if len(row.SNI) > 0 {
+			row.SNI = strings.ToLower(row.SNI)
+			if !util.IsValidDomainName(row.SNI) {
+				row.addError("%s is not a valid SNI", row.SNI)
+			}
+		}
+		validateTags(row)
+		if len(row.Notes) > maxNotesLength {
+			row.addError("notes can be at most %d characters", maxNotesLength)
+		}
+		if len(row.Host) == 0 {
+			continue
+		}
+		name := row.Name()
+		if existing[name] {
+			row.addError("%s is already tracked", name)
+		}
+		if line, ok := seen[name]; ok {
+			row.addError("duplicate of row %d", line)
+		} else {
+			seen[name] = row.Line
+		}
+	}
+}
+
+func validateTags(row *Row) {
+	var (
+		tags = make([]string, 0, len(row.Tags))
+		seen = map[string]bool{}
+	)
+	for _, tag := range row.Tags {
+		tag, ok := data.NormalizeTag(tag)
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if !ok {
+			row.addError("%q is not a valid tag, use up to %d letters, digits and - _ . :", tag, data.MaxTagLength)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > data.MaxTrackingTags {
+		row.addError("a tracking can have at most %d tags", data.MaxTrackingTags)
+	}
+	row.Tags = tags
+}
+
+// ValidRows returns the rows without errors.
+func ValidRows(rows []Row) []Row {
+	valid := []Row{}
+	for _, row := range rows {
+		if row.Valid() {
+			valid = append(valid, row)
+		}
+	}
+	return valid
+}
@@ -0,0 +1,137 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		input    string
+		format   string
+	}{
+		{"trackings.csv", "foo.com,443", FormatCSV},
+		{"trackings.JSON", "", FormatJSON},
+		{"hosts.txt", "host,port", FormatList},
+		{"", ` [{"host": "foo.com"}]`, FormatJSON},
+		{"", "Host,Port,SNI\nfoo.com,443,foo.com", FormatCSV},
+		{"", "foo.com, bar.com", FormatList},
+	}
+	for _, test := range tests {
+		if format := DetectFormat(test.filename, []byte(test.input)); format != test.format {
+			t.Fatalf("expected format %s for %q got %s", test.format, test.filename+test.input, format)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := "host,port,sni,tags,notes\n" +
+		"foo.com,8443,api.foo.com,prod;eu,\"main API, do not remove\"\n" +
+		"\n" +
+		"https://bar.com/login,,,,\n" +
+		"baz.com,abc,,,\n"
+	rows, err := Parse(FormatCSV, []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows got %d", len(rows))
+	}
+	foo := rows[0]
+	if foo.Line != 2 || foo.Host != "foo.com" || foo.Port != 8443 || foo.SNI != "api.foo.com" || foo.Notes != "main API, do not remove" {
+		t.Fatalf("unexpected row %+v", foo)
+	}
+	if strings.Join(foo.Tags, ",") != "prod,eu" {
+		t.Fatalf("expected tags prod and eu got %v", foo.Tags)
+	}
+	if rows[1].Host != "bar.com" || rows[1].Port != 0 || !rows[1].Valid() {
+		t.Fatalf("expected the host of the URL got %+v", rows[1])
+	}
+	if rows[2].Valid() {
+		t.Fatalf("expected an invalid port error for %+v", rows[2])
+	}
+
+	// Without a header the columns are positional.
+	rows, err = Parse(FormatCSV, []byte("foo.com,8443\nbar.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Port != 8443 || rows[1].Host != "bar.com" {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	input := `[
+		{"host": "foo.com", "port": 8443, "tags": ["prod"], "notes": "api"},
+		{"domain": "bar.com:9443", "tags": "staging;eu"},
+		{"host": "baz.com", "port": "443", "tags": 42}
+	]`
+	rows, err := Parse(FormatJSON, []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Port != 8443 || rows[0].Notes != "api" || len(rows[0].Tags) != 1 {
+		t.Fatalf("unexpected row %+v", rows[0])
+	}
+	if rows[1].Host != "bar.com" || rows[1].Port != 9443 || len(rows[1].Tags) != 2 {
+		t.Fatalf("unexpected row %+v", rows[1])
+	}
+	if rows[2].Port != 443 || rows[2].Valid() {
+		t.Fatalf("expected an error for the tags of %+v", rows[2])
+	}
+	if _, err := Parse(FormatJSON, []byte(`{"host": "foo.com"}`)); err == nil {
+		t.Fatal("expected an error for JSON that is not an array")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	rows, err := Parse(FormatList, []byte("foo.com, bar.com:8443\n\nhttps://baz.com/\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows got %d", len(rows))
+	}
+	if rows[1].Name() != "bar.com:8443" || rows[2].Host != "baz.com" || rows[2].Line != 3 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if _, err := Parse(FormatList, []byte("\n \n")); err != ErrEmpty {
+		t.Fatalf("expected %s got %v", ErrEmpty, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rows := []Row{
+		{Line: 1, Host: "foo.com", Tags: []string{"Prod", "prod", "eu"}},
+		{Line: 2, Host: "foo.com", Port: 8443},
+		{Line: 3, Host: "foo.com"},
+		{Line: 4, Host: "tracked.com"},
+		{Line: 5, Host: "not a host"},
+		{Line: 6, Host: "10.0.0.1", SNI: "internal.foo.com"},
+		{Line: 7, Host: "bar.com", Tags: []string{"no spaces!"}},
+		{Line: 8},
+	}
+	Validate(rows, map[string]bool{"tracked.com": true})
+
+	expectedValid := []bool{true, true, false, false, false, true, false, false}
+	for i, row := range rows {
+		if row.Valid() != expectedValid[i] {
+			t.Fatalf("expected row %d valid=%t got errors %v", row.Line, expectedValid[i], row.Errors)
+		}
+	}
+	if strings.Join(rows[0].Tags, ",") != "prod,eu" {
+		t.Fatalf("expected normalized tags got %v", rows[0].Tags)
+	}
+	if rows[2].Errors[0] != "duplicate of row 1" {
+		t.Fatalf("unexpected error %s", rows[2].Errors[0])
+	}
+	if len(ValidRows(rows)) != 3 {
+		t.Fatalf("expected 3 valid rows got %d", len(ValidRows(rows)))
+	}
+	target := rows[5].Target()
+	if target.Address() != "10.0.0.1:443" || target.SNI != "internal.foo.com" {
+		t.Fatalf("unexpected target %+v", target)
+	}
+}
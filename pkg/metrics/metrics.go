@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ssltracker"
+
+var (
+	ProbeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "probe_duration_seconds",
+		Help:      "Duration of the TLS probes by outcome (the status of the tracking).",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 3, 5, 10},
+	}, []string{"outcome"})
+
+	TrackingsByStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "trackings",
+		Help:      "Number of domain trackings by status.",
+	}, []string{"status"})
+
+	DaysToExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracking_days_to_expiry",
+		Help:      "Days until the certificate of the tracking expires. Only exported when METRICS_EXPIRY_PER_TRACKING is enabled.",
+	}, []string{"tracking_id", "domain"})
+
+	NotificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Number of notification deliveries by notifier kind and result.",
+	}, []string{"kind", "result"})
+
+	PollLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "poll_lag_seconds",
+		Help:      "How late the most overdue tracking of the last poll was polled.",
+	})
+
+	PollDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "poll_duration_seconds",
+		Help:      "Duration of a complete poll of the pulser.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// ExpiryPerTrackingEnabled returns true if the days to expiry gauge should be
+// exported for every tracking. This is opt-in since it creates a time series
+// per tracking.
+func ExpiryPerTrackingEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("METRICS_EXPIRY_PER_TRACKING"))
+	return enabled
+}
+
+// NotificationResult returns the result label for a notification delivery.
+func NotificationResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// WithHTTPMetrics records the count and duration of the requests handled by
+// the Fiber app. Requests are labelled by route pattern (/domains/:id) and not
+// by path to keep the cardinality low.
+func WithHTTPMetrics(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	var (
+		method = c.Method()
+		route  = c.Route().Path
+		code   = c.Response().StatusCode()
+	)
+	// The error handler has not written the response yet.
+	if err != nil {
+		code = fiber.StatusInternalServerError
+		if e, ok := err.(*fiber.Error); ok {
+			code = e.Code
+		}
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+
+	"github.com/anthdm/ssltracker/data"
+	"github.com/anthdm/ssltracker/util"
+)
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"daysLeft": util.DaysLeft,
+}).Parse(`Your weekly certificate digest
+
+You are tracking {{ .Total }} domains.
+{{ range $status, $count := .StatusCounts }}- {{ $status }}: {{ $count }}
+{{ end }}
+{{- if .NewlyFailing }}
+Newly failing this week
+{{ range .NewlyFailing }}- {{ .DomainName }} ({{ .Status }}) {{ .Error }}
+{{ end }}{{ end }}
+{{- if .Renewed }}
+Renewed this week
+{{ range .Renewed }}- {{ .DomainName }} now expires in {{ daysLeft .Expires }}
+{{ end }}{{ end }}
+{{- if .Expiring30 }}
+Expiring in the next 30 days
+{{ range .Expiring30 }}- {{ .DomainName }} expires in {{ daysLeft .Expires }}
+{{ end }}{{ end }}
+{{- if .Expiring60 }}
+Expiring in the next 60 days
+{{ range .Expiring60 }}- {{ .DomainName }} expires in {{ daysLeft .Expires }}
+{{ end }}{{ end }}
+{{- if .Expiring90 }}
+Expiring in the next 90 days
+{{ range .Expiring90 }}- {{ .DomainName }} expires in {{ daysLeft .Expires }}
+{{ end }}{{ end }}`))
+
+func renderDigest(digest data.Digest) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := digestTemplate.Execute(buf, digest); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// NotifyDigest sends the weekly digest of the account by email.
+func (n *EmailNotifier) NotifyDigest(ctx context.Context, digest data.Digest) error {
+	text, err := renderDigest(digest)
+	if err != nil {
+		return err
+	}
+	return n.send(ctx, "Your weekly certificate digest", text)
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+var invitationTemplate = template.Must(template.New("invitation").Parse(`{{ .InvitedBy }} invited you to join {{ .Organization }} on CertPulse as {{ .Role }}.
+
+Accept the invitation before {{ .Expires }}:
+{{ .Link }}
+
+If you did not expect this invitation, you can ignore this email.`))
+
+type invitationEmail struct {
+	Organization string
+	InvitedBy    string
+	Role         data.Role
+	Link         string
+	Expires      string
+}
+
+func renderInvitation(email invitationEmail) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := invitationTemplate.Execute(buf, email); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// NotifyInvitation sends the link to accept the invitation to the
+// organization to the invited email address.
+func (n *EmailNotifier) NotifyInvitation(ctx context.Context, invitation data.OrganizationInvitation, organization string, invitedBy string, link string) error {
+	text, err := renderInvitation(invitationEmail{
+		Organization: organization,
+		InvitedBy:    invitedBy,
+		Role:         invitation.Role,
+		Link:         link,
+		Expires:      invitation.ExpiresAt.UTC().Format("Jan 02 15:04 MST"),
+	})
+	if err != nil {
+		return err
+	}
+	return n.send(ctx, "You are invited to join "+organization+" on CertPulse", text)
+}
@@ -6,18 +6,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/anthdm/ssltracker/data"
 	"github.com/anthdm/ssltracker/util"
 	"github.com/gofiber/fiber/v2"
+	"github.com/mailersend/mailersend-go"
 )
 
 type Notifier interface {
 	NotifyStatus(context.Context, data.TrackingAndAccount) error
 	NotifyExpires(context.Context, data.TrackingAndAccount) error
+	// NotifyTest sends a message that is clearly labelled as a test, so users
+	// can check that the channel is set up correctly.
+	NotifyTest(context.Context, data.TrackingAndAccount) error
 	Kind() string
 }
 
+// NewForChannel returns the notifier that delivers notifications over the
+// given channel to the target (email address, webhook URL).
+func NewForChannel(channel string, target string) (Notifier, error) {
+	switch channel {
+	case data.ChannelEmail:
+		return NewEmailNotifier([]string{target}), nil
+	case data.ChannelSlack:
+		return NewSlackNotifier(target), nil
+	case data.ChannelWebhook:
+		return NewWebhookNotifier(target), nil
+	default:
+		return nil, fmt.Errorf("unknown notification channel: %s", channel)
+	}
+}
+
 type EmailNotifier struct {
 	to []string
 }
@@ -31,13 +52,35 @@ func NewEmailNotifier(to []string) *EmailNotifier {
 func (n EmailNotifier) Kind() string { return "mailer send email" }
 
 func (n *EmailNotifier) NotifyStatus(ctx context.Context, tracking data.TrackingAndAccount) error {
-	fmt.Println("SEND EMAIL TO =>", tracking.Account.NotifyDefaultEmail)
-	return nil
+	msg := fmt.Sprintf("Domain %s has a non healthy status: %s", tracking.DomainName, tracking.Status)
+	return n.send(ctx, fmt.Sprintf("[CertPulse] %s is %s", tracking.DomainName, tracking.Status), msg)
 }
 
 func (n *EmailNotifier) NotifyExpires(ctx context.Context, tracking data.TrackingAndAccount) error {
-	fmt.Println("SEND EMAIL TO =>", tracking.Account.NotifyDefaultEmail)
-	return nil
+	msg := fmt.Sprintf("Domain %s will expire in %s", tracking.DomainName, util.DaysLeft(tracking.Expires))
+	return n.send(ctx, fmt.Sprintf("[CertPulse] %s expires soon", tracking.DomainName), msg)
+}
+
+func (n *EmailNotifier) NotifyTest(ctx context.Context, tracking data.TrackingAndAccount) error {
+	return n.send(ctx, fmt.Sprintf("[Test] CertPulse notification for %s", tracking.DomainName), testMessage(tracking))
+}
+
+func (n *EmailNotifier) send(ctx context.Context, subject string, text string) error {
+	ms := mailersend.NewMailersend(os.Getenv("MAILERSEND_API_KEY"))
+	recipients := make([]mailersend.Recipient, len(n.to))
+	for i, to := range n.to {
+		recipients[i] = mailersend.Recipient{Email: to}
+	}
+	msg := ms.Email.NewMessage()
+	msg.SetFrom(mailersend.From{
+		Name:  "CertPulse",
+		Email: os.Getenv("MAILERSEND_FROM_EMAIL"),
+	})
+	msg.SetRecipients(recipients)
+	msg.SetSubject(subject)
+	msg.SetText(text)
+	_, err := ms.Email.Send(ctx, msg)
+	return err
 }
 
 type SlackNotifier struct {
@@ -54,15 +97,19 @@ func (n *SlackNotifier) Kind() string { return "Slack" }
 
 func (n *SlackNotifier) NotifyExpires(ctx context.Context, tracking data.TrackingAndAccount) error {
 	msg := fmt.Sprintf("Domain %s will expire in %s days", tracking.DomainName, util.DaysLeft(tracking.Expires))
-	return postSlackMessage(n.webhookURL, msg)
+	return postSlackMessage(ctx, n.webhookURL, msg)
 }
 
 func (n *SlackNotifier) NotifyStatus(ctx context.Context, tracking data.TrackingAndAccount) error {
 	msg := fmt.Sprintf("Domain %s has a non healthy status: %s", tracking.DomainName, tracking.Status)
-	return postSlackMessage(n.webhookURL, msg)
+	return postSlackMessage(ctx, n.webhookURL, msg)
+}
+
+func (n *SlackNotifier) NotifyTest(ctx context.Context, tracking data.TrackingAndAccount) error {
+	return postSlackMessage(ctx, n.webhookURL, testMessage(tracking))
 }
 
-func postSlackMessage(url string, msg string) error {
+func postSlackMessage(ctx context.Context, url string, msg string) error {
 	body := fiber.Map{
 		"text": msg,
 	}
@@ -70,12 +117,98 @@ func postSlackMessage(url string, msg string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(url, fiber.MIMEApplicationJSON, bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("slack returned non 200 response: %d", resp.StatusCode)
 	}
 	return nil
 }
+
+// WebhookNotifier posts the notifications as JSON to the webhook endpoint of
+// the account.
+type WebhookNotifier struct {
+	url string
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url: url,
+	}
+}
+
+// WebhookPayload is the JSON body that is posted to webhook endpoints.
+type WebhookPayload struct {
+	Event    string    `json:"event"`
+	Test     bool      `json:"test"`
+	Domain   string    `json:"domain"`
+	Status   string    `json:"status"`
+	Expires  time.Time `json:"expires"`
+	DaysLeft string    `json:"days_left"`
+	Message  string    `json:"message"`
+}
+
+func (n *WebhookNotifier) Kind() string { return "webhook" }
+
+func (n *WebhookNotifier) NotifyExpires(ctx context.Context, tracking data.TrackingAndAccount) error {
+	msg := fmt.Sprintf("Domain %s will expire in %s", tracking.DomainName, util.DaysLeft(tracking.Expires))
+	return n.post(ctx, newWebhookPayload(data.NotificationKindExpires, tracking, msg))
+}
+
+func (n *WebhookNotifier) NotifyStatus(ctx context.Context, tracking data.TrackingAndAccount) error {
+	msg := fmt.Sprintf("Domain %s has a non healthy status: %s", tracking.DomainName, tracking.Status)
+	return n.post(ctx, newWebhookPayload(data.NotificationKindStatus, tracking, msg))
+}
+
+func (n *WebhookNotifier) NotifyTest(ctx context.Context, tracking data.TrackingAndAccount) error {
+	payload := newWebhookPayload("test", tracking, testMessage(tracking))
+	payload.Test = true
+	return n.post(ctx, payload)
+}
+
+func newWebhookPayload(event string, tracking data.TrackingAndAccount, msg string) WebhookPayload {
+	return WebhookPayload{
+		Event:    event,
+		Domain:   tracking.DomainName,
+		Status:   tracking.Status,
+		Expires:  tracking.Expires,
+		DaysLeft: util.DaysLeft(tracking.Expires),
+		Message:  msg,
+	}
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, payload WebhookPayload) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "CertPulse-Webhook")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned non 2xx response: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// testMessage is the text of a test notification of the tracking.
+func testMessage(tracking data.TrackingAndAccount) string {
+	return fmt.Sprintf("This is a test notification from CertPulse for %s. The certificate is %s and expires in %s. No action is needed.",
+		tracking.DomainName, tracking.Status, util.DaysLeft(tracking.Expires))
+}
@@ -1,9 +1,63 @@
 package notify
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
 )
 
 func TestNotify(t *testing.T) {
 
 }
+
+func TestWebhookNotifierTest(t *testing.T) {
+	var payload WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	tracking := data.TrackingAndAccount{
+		DomainTracking: data.DomainTracking{
+			DomainName: "foo.com",
+			DomainTrackingInfo: data.DomainTrackingInfo{
+				Status:  data.StatusHealthy,
+				Expires: time.Now().AddDate(0, 1, 0),
+			},
+		},
+	}
+	if err := NewWebhookNotifier(server.URL).NotifyTest(context.Background(), tracking); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "test" || !payload.Test || payload.Domain != "foo.com" {
+		t.Fatalf("expected a test payload for foo.com got %+v", payload)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if err := NewWebhookNotifier(server.URL).NotifyTest(context.Background(), tracking); err == nil {
+		t.Fatal("expected an error for a failing webhook")
+	}
+}
+
+func TestSlackNotifierCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewSlackNotifier(server.URL).NotifyTest(ctx, data.TrackingAndAccount{}); err == nil {
+		t.Fatal("expected the canceled context to abort the request")
+	}
+	if err := NewSlackNotifier(server.URL).NotifyTest(context.Background(), data.TrackingAndAccount{}); err != nil {
+		t.Fatal(err)
+	}
+}
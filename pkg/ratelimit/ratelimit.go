@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// maxKeys is the number of keys after which the windows that ended are
+// dropped, so the limiter doesn't grow with every key it has ever seen.
+const maxKeys = 10_000
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter allows a number of events per interval for every key, counted in
+// fixed windows that start at the first event of the key.
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	interval time.Duration
+	windows  map[string]*window
+}
+
+func New(limit int, interval time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		interval: interval,
+		windows:  make(map[string]*window),
+	}
+}
+
+// Allow records an event for the key and returns false if the key already
+// reached the limit of the current window.
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.start.Add(l.interval)) {
+		if len(l.windows) >= maxKeys {
+			l.sweep(now)
+		}
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if !now.Before(w.start.Add(l.interval)) {
+			delete(l.windows, key)
+		}
+	}
+}
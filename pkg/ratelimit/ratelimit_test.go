@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	var (
+		now     = time.Now()
+		limiter = New(2, time.Minute)
+	)
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("a", now) {
+			t.Fatalf("expected event %d to be allowed", i+1)
+		}
+	}
+	if limiter.Allow("a", now.Add(time.Second)) {
+		t.Fatal("expected the third event in the window to be limited")
+	}
+	if !limiter.Allow("b", now) {
+		t.Fatal("expected other keys to have their own limit")
+	}
+	if !limiter.Allow("a", now.Add(time.Minute)) {
+		t.Fatal("expected the limit to reset after the interval")
+	}
+}
@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+const (
+	// MinInterval is the shortest time between 2 polls of the same tracking.
+	MinInterval = time.Minute
+	// maxBackoffFailures caps the exponent of the error backoff.
+	maxBackoffFailures = 16
+)
+
+// Jitter is the fraction of the interval that is randomly added or subtracted
+// so trackings created at the same time don't keep getting polled together.
+var Jitter = 0.1
+
+// NextPoll returns the time the tracking should be polled again.
+func NextPoll(info data.DomainTrackingInfo, failures int, interval time.Duration, now time.Time) time.Time {
+	return now.Add(withJitter(Interval(info, failures, interval, now)))
+}
+
+// Interval adapts the given interval to the state of the tracking. Trackings
+// that failed are retried sooner, backing off to the normal interval after
+// consecutive failures. Certificates that are about to expire are polled more
+// often so renewals (or the lack of them) are picked up quickly.
+func Interval(info data.DomainTrackingInfo, failures int, interval time.Duration, now time.Time) time.Duration {
+	if failures > 0 {
+		if failures > maxBackoffFailures {
+			failures = maxBackoffFailures
+		}
+		if backoff := MinInterval << (failures - 1); backoff < interval {
+			interval = backoff
+		}
+	} else if !info.Expires.IsZero() {
+		timeLeft := info.Expires.Sub(now)
+		switch {
+		case timeLeft < time.Hour*24*7:
+			interval /= 4
+		case timeLeft < time.Hour*24*30:
+			interval /= 2
+		}
+	}
+	if interval < MinInterval {
+		interval = MinInterval
+	}
+	return interval
+}
+
+func withJitter(d time.Duration) time.Duration {
+	delta := float64(d) * Jitter * (2*rand.Float64() - 1)
+	return d + time.Duration(delta)
+}
@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+func TestInterval(t *testing.T) {
+	var (
+		now      = time.Now()
+		interval = time.Hour
+		healthy  = data.DomainTrackingInfo{Expires: now.AddDate(0, 3, 0)}
+		looming  = data.DomainTrackingInfo{Expires: now.AddDate(0, 0, 20)}
+		expiring = data.DomainTrackingInfo{Expires: now.AddDate(0, 0, 3)}
+	)
+	if d := Interval(healthy, 0, interval, now); d != interval {
+		t.Fatalf("expected %s got %s", interval, d)
+	}
+	if d := Interval(looming, 0, interval, now); d != interval/2 {
+		t.Fatalf("expected %s got %s", interval/2, d)
+	}
+	if d := Interval(expiring, 0, interval, now); d != interval/4 {
+		t.Fatalf("expected %s got %s", interval/4, d)
+	}
+	if d := Interval(healthy, 1, interval, now); d != MinInterval {
+		t.Fatalf("expected first retry after %s got %s", MinInterval, d)
+	}
+	if d := Interval(healthy, 3, interval, now); d != MinInterval*4 {
+		t.Fatalf("expected third retry after %s got %s", MinInterval*4, d)
+	}
+	if d := Interval(healthy, 100, interval, now); d != interval {
+		t.Fatalf("expected backoff to be capped at %s got %s", interval, d)
+	}
+	if d := Interval(expiring, 0, time.Minute*2, now); d != MinInterval {
+		t.Fatalf("expected interval to be at least %s got %s", MinInterval, d)
+	}
+}
+
+func TestNextPollJitter(t *testing.T) {
+	var (
+		now      = time.Now()
+		interval = time.Hour
+		info     = data.DomainTrackingInfo{Expires: now.AddDate(1, 0, 0)}
+		maxDelta = time.Duration(float64(interval) * Jitter)
+	)
+	for i := 0; i < 100; i++ {
+		next := NextPoll(info, 0, interval, now)
+		if next.Before(now.Add(interval-maxDelta)) || next.After(now.Add(interval+maxDelta)) {
+			t.Fatalf("expected next poll within %s of %s got %s", maxDelta, interval, next.Sub(now))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package ssl
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+// ChainCertificate summarizes a certificate of the chain presented by a server.
+type ChainCertificate struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	IsCA              bool      `json:"is_ca"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
+}
+
+// Inspection is the result of inspecting a probe target.
+type Inspection struct {
+	Target data.ProbeTarget
+	Info   data.DomainTrackingInfo
+	Chain  []ChainCertificate
+}
+
+// Inspect connects to the target and returns the information of its
+// certificate together with the full chain. Unlike PollTarget, every error
+// results in a status right away, which is what one-off checks want. When the
+// certificate can't be verified the chain is still fetched, without
+// verification, so it can be shown.
+func Inspect(ctx context.Context, target data.ProbeTarget) (*Inspection, error) {
+	if _, err := tlsConfig(target); err != nil {
+		return nil, err
+	}
+	var (
+		start      = time.Now()
+		inspection = &Inspection{Target: target}
+	)
+	conn, err := dialTLS(ctx, target)
+	if err == nil {
+		defer conn.Close()
+		inspection.Info = infoFromConn(conn, start)
+		inspection.Chain = chainFromConn(conn)
+		return inspection, nil
+	}
+
+	inspection.Info = data.DomainTrackingInfo{
+		LastPollAt: time.Now(),
+		Error:      err.Error(),
+		Latency:    int(time.Since(start).Milliseconds()),
+	}
+	switch {
+	case ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded):
+		inspection.Info.Status = data.StatusUnresponsive
+	case IsVerificationError(err):
+		inspection.Info.Status = data.StatusInvalid
+		if chain, err := fetchUnverifiedChain(ctx, target); err == nil {
+			inspection.Chain = chain
+		}
+	default:
+		inspection.Info.Status = data.StatusOffline
+	}
+	return inspection, nil
+}
+
+func fetchUnverifiedChain(ctx context.Context, target data.ProbeTarget) ([]ChainCertificate, error) {
+	config, err := tlsConfig(target)
+	if err != nil {
+		return nil, err
+	}
+	config.InsecureSkipVerify = true
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return chainFromConn(conn.(*tls.Conn)), nil
+}
+
+func chainFromConn(conn *tls.Conn) []ChainCertificate {
+	certs := conn.ConnectionState().PeerCertificates
+	chain := make([]ChainCertificate, len(certs))
+	for i, cert := range certs {
+		chain[i] = newChainCertificate(cert)
+	}
+	return chain
+}
+
+func newChainCertificate(cert *x509.Certificate) ChainCertificate {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return ChainCertificate{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		IsCA:              cert.IsCA,
+		SHA256Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+}
@@ -0,0 +1,59 @@
+package ssl
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+)
+
+func TestInspectUntrustedCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(port)
+	target := data.ProbeTarget{Host: host, Port: n, SNI: "example.com"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	inspection, err := Inspect(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspection.Info.Status != data.StatusInvalid {
+		t.Fatalf("expected status %s got %s (%s)", data.StatusInvalid, inspection.Info.Status, inspection.Info.Error)
+	}
+	if len(inspection.Chain) != 1 {
+		t.Fatalf("expected the unverified chain of 1 certificate got %d", len(inspection.Chain))
+	}
+	if !inspection.Chain[0].NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Fatalf("expected the certificate of the server got %+v", inspection.Chain[0])
+	}
+}
+
+func TestInspectOffline(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	inspection, err := Inspect(ctx, data.ProbeTarget{Host: "127.0.0.1", Port: addr.Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspection.Info.Status != data.StatusOffline {
+		t.Fatalf("expected status %s got %s", data.StatusOffline, inspection.Info.Status)
+	}
+}
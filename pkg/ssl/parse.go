@@ -0,0 +1,124 @@
+package ssl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrNoCertificate     = errors.New("no certificate found in the input")
+	ErrIncorrectPassword = errors.New("incorrect password for the PKCS#12 file")
+)
+
+// ParseCertificates parses PEM (including bundles), DER or PKCS#12 encoded
+// input and returns the certificates it contains. The password is only used to
+// decrypt PKCS#12 input. Private keys in the input are ignored.
+func ParseCertificates(input []byte, password string) ([]*x509.Certificate, error) {
+	if bytes.Contains(input, []byte("-----BEGIN")) {
+		return parsePEM(input)
+	}
+	if certs, err := x509.ParseCertificates(input); err == nil && len(certs) > 0 {
+		return certs, nil
+	}
+	return parsePKCS12(input, password)
+}
+
+func parsePEM(input []byte) ([]*x509.Certificate, error) {
+	var (
+		certs []*x509.Certificate
+		block *pem.Block
+	)
+	for {
+		block, input = pem.Decode(input)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return certs, nil
+}
+
+// parsePKCS12 decodes a PKCS#12 file holding a key with its chain, or a trust
+// store holding certificates only.
+func parsePKCS12(input []byte, password string) ([]*x509.Certificate, error) {
+	_, cert, caCerts, err := pkcs12.DecodeChain(input, password)
+	if err == nil {
+		return append([]*x509.Certificate{cert}, caCerts...), nil
+	}
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, ErrIncorrectPassword
+	}
+	certs, err := pkcs12.DecodeTrustStore(input, password)
+	if err != nil {
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, ErrIncorrectPassword
+		}
+		return nil, ErrNoCertificate
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return certs, nil
+}
+
+// LeafCertificate returns the first certificate that is not a CA, which is
+// the certificate the rest of a bundle was issued for. Bundles of CAs only
+// return their first certificate.
+func LeafCertificate(certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		if !cert.IsCA {
+			return cert
+		}
+	}
+	return certs[0]
+}
+
+// InfoFromCertificates returns the information of the leaf certificate of the
+// parsed input, the same way PollTarget does for a certificate presented by a
+// server.
+func InfoFromCertificates(certs []*x509.Certificate, now time.Time) (data.DomainTrackingInfo, error) {
+	if len(certs) == 0 {
+		return data.DomainTrackingInfo{}, ErrNoCertificate
+	}
+	return infoFromCertificate(LeafCertificate(certs), now), nil
+}
+
+// CheckExpiry returns the info of a static certificate evaluated at now.
+// Static certificates are never polled, only the passing of time changes
+// their status.
+func CheckExpiry(info data.DomainTrackingInfo, now time.Time) data.DomainTrackingInfo {
+	info.Status = statusAt(info.Expires, now)
+	info.LastPollAt = now
+	info.Latency = 0
+	info.Error = ""
+	return info
+}
+
+// FingerprintPEM returns the SHA-256 fingerprint of the PEM encoded
+// certificate, or an empty string when it can't be decoded.
+func FingerprintPEM(encodedPEM string) string {
+	block, _ := pem.Decode([]byte(encodedPEM))
+	if block == nil {
+		return ""
+	}
+	fingerprint := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(fingerprint[:])
+}
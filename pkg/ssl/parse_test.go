@@ -0,0 +1,156 @@
+package ssl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/anthdm/ssltracker/data"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type testChain struct {
+	key    *ecdsa.PrivateKey
+	leaf   *x509.Certificate
+	issuer *x509.Certificate
+}
+
+func newTestChain(t *testing.T, notAfter time.Time) testChain {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA", Organization: []string{"CertPulse Test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "internal.example.com"},
+		DNSNames:     []string{"internal.example.com", "api.internal.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(leafDER)
+	return testChain{key: key, leaf: leaf, issuer: ca}
+}
+
+func encodePEM(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, cert := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return b
+}
+
+func TestParseCertificates(t *testing.T) {
+	chain := newTestChain(t, time.Now().AddDate(0, 3, 0))
+	keyDER, err := x509.MarshalECPrivateKey(chain.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The issuer comes first and a private key is mixed in, which happens
+	// with bundles exported from Kubernetes secrets.
+	bundle := encodePEM(chain.issuer)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	bundle = append(bundle, encodePEM(chain.leaf)...)
+
+	p12, err := pkcs12.Encode(rand.Reader, chain.key, chain.leaf, []*x509.Certificate{chain.issuer}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustStore, err := pkcs12.EncodeTrustStore(rand.Reader, []*x509.Certificate{chain.leaf}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+		count int
+	}{
+		{"pem bundle", bundle, 2},
+		{"der", chain.leaf.Raw, 1},
+		{"pkcs12", p12, 2},
+		{"pkcs12 trust store", trustStore, 1},
+	}
+	for _, test := range tests {
+		certs, err := ParseCertificates(test.input, "secret")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if len(certs) != test.count {
+			t.Fatalf("%s: expected %d certificates got %d", test.name, test.count, len(certs))
+		}
+		if leaf := LeafCertificate(certs); !leaf.Equal(chain.leaf) {
+			t.Fatalf("%s: expected the leaf certificate got %s", test.name, leaf.Subject)
+		}
+	}
+
+	if _, err := ParseCertificates(p12, "wrong"); err != ErrIncorrectPassword {
+		t.Fatalf("expected %s got %v", ErrIncorrectPassword, err)
+	}
+	if _, err := ParseCertificates([]byte("not a certificate"), ""); err != ErrNoCertificate {
+		t.Fatalf("expected %s got %v", ErrNoCertificate, err)
+	}
+	keyOnly := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if _, err := ParseCertificates(keyOnly, ""); err != ErrNoCertificate {
+		t.Fatalf("expected %s got %v", ErrNoCertificate, err)
+	}
+}
+
+func TestInfoFromCertificates(t *testing.T) {
+	var (
+		now   = time.Now()
+		chain = newTestChain(t, now.AddDate(0, 0, 10))
+	)
+	info, err := InfoFromCertificates([]*x509.Certificate{chain.issuer, chain.leaf}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != data.StatusExpires {
+		t.Fatalf("expected status %s got %s", data.StatusExpires, info.Status)
+	}
+	if info.Issuer != "CertPulse Test" || info.DNSNames != "internal.example.com, api.internal.example.com" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if len(info.ExtKeyUsages) != 1 || info.ExtKeyUsages[0] != "server auth" {
+		t.Fatalf("unexpected extended key usages %v", info.ExtKeyUsages)
+	}
+
+	if fingerprint := FingerprintPEM(info.EncodedPEM); fingerprint != newChainCertificate(chain.leaf).SHA256Fingerprint {
+		t.Fatalf("expected the SHA-256 fingerprint of the leaf got %q", fingerprint)
+	}
+
+	info = CheckExpiry(info, now.AddDate(0, 0, 11))
+	if info.Status != data.StatusExpired {
+		t.Fatalf("expected status %s got %s", data.StatusExpired, info.Status)
+	}
+}
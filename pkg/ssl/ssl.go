@@ -14,16 +14,33 @@ import (
 
 	"github.com/anthdm/ssltracker/data"
 	"github.com/anthdm/ssltracker/logger"
+	"github.com/anthdm/ssltracker/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// PollDomain connects to the domain on port 443 and returns the information
+// of the certificate it presents.
 func PollDomain(ctx context.Context, domain string) (*data.DomainTrackingInfo, error) {
+	return PollTarget(ctx, data.DefaultProbeTarget(domain))
+}
+
+// PollTarget connects to the probe target and returns the information of the
+// certificate it presents. The DNS lookup, TCP connect and TLS handshake are
+// traced as separate stages.
+func PollTarget(ctx context.Context, target data.ProbeTarget) (*data.DomainTrackingInfo, error) {
+	ctx, span := tracing.Start(ctx, "ssl.poll",
+		attribute.String("domain", target.Host),
+		attribute.String("address", target.Address()),
+		attribute.String("sni", target.SNI),
+	)
+	defer span.End()
+
 	var (
 		start    = time.Now()
-		resultch = make(chan data.DomainTrackingInfo)
-		config   = &tls.Config{}
+		resultch = make(chan data.DomainTrackingInfo, 1)
 	)
 	go func() {
-		conn, err := tls.Dial("tcp", fmt.Sprintf("%s:443", domain), config)
+		conn, err := dialTLS(ctx, target)
 		if err != nil {
 			info := data.DomainTrackingInfo{
 				LastPollAt: time.Now(),
@@ -41,50 +58,139 @@ func PollDomain(ctx context.Context, domain string) (*data.DomainTrackingInfo, e
 			return
 		}
 		defer conn.Close()
-		var (
-			state     = conn.ConnectionState()
-			cert      = state.PeerCertificates[0]
-			keyUsages = make([]string, len(cert.ExtKeyUsage))
-			i         = 0
-		)
-		for _, usage := range cert.ExtKeyUsage {
-			keyUsages[i] = extKeyUsageToString(usage)
-			i++
-		}
-		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
-		if err != nil {
-			logger.Log("error", err)
-		}
-		resultch <- data.DomainTrackingInfo{
-			ServerIP:      host,
-			PublicKeyAlgo: cert.PublicKeyAlgorithm.String(),
-			SignatureAlgo: cert.SignatureAlgorithm.String(),
-			KeyUsage:      keyUsageToString(cert.KeyUsage),
-			ExtKeyUsages:  keyUsages,
-			PublicKey:     publicKeyFromCert(cert),
-			EncodedPEM:    encodedPEMFromCert(cert),
-			Signature:     sha1Hex(cert.Signature),
-			Expires:       cert.NotAfter,
-			DNSNames:      strings.Join(cert.DNSNames, ", "),
-			Issuer:        cert.Issuer.Organization[0],
-			LastPollAt:    time.Now(),
-			Latency:       int(time.Since(start).Milliseconds()),
-			Status:        getStatus(cert.NotAfter),
-		}
+		resultch <- infoFromConn(conn, start)
 	}()
 
 	select {
 	case <-ctx.Done():
+		span.SetAttributes(attribute.String("status", data.StatusUnresponsive))
 		return &data.DomainTrackingInfo{
 			Error:      ctx.Err().Error(),
 			LastPollAt: time.Now(),
 			Status:     data.StatusUnresponsive,
 		}, nil
 	case result := <-resultch:
+		span.SetAttributes(attribute.String("status", result.Status))
 		return &result, nil
 	}
 }
 
+// infoFromConn returns the information of the leaf certificate presented on
+// the connection.
+func infoFromConn(conn *tls.Conn, start time.Time) data.DomainTrackingInfo {
+	state := conn.ConnectionState()
+	info := infoFromCertificate(state.PeerCertificates[0], time.Now())
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		logger.Log("error", err)
+	}
+	info.ServerIP = host
+	info.Latency = int(time.Since(start).Milliseconds())
+	return info
+}
+
+// infoFromCertificate returns the information of the certificate checked at now.
+func infoFromCertificate(cert *x509.Certificate, now time.Time) data.DomainTrackingInfo {
+	keyUsages := make([]string, len(cert.ExtKeyUsage))
+	for i, usage := range cert.ExtKeyUsage {
+		keyUsages[i] = extKeyUsageToString(usage)
+	}
+	return data.DomainTrackingInfo{
+		PublicKeyAlgo: cert.PublicKeyAlgorithm.String(),
+		SignatureAlgo: cert.SignatureAlgorithm.String(),
+		KeyUsage:      keyUsageToString(cert.KeyUsage),
+		ExtKeyUsages:  keyUsages,
+		PublicKey:     publicKeyFromCert(cert),
+		EncodedPEM:    encodedPEMFromCert(cert),
+		Signature:     sha1Hex(cert.Signature),
+		Expires:       cert.NotAfter,
+		DNSNames:      strings.Join(cert.DNSNames, ", "),
+		Issuer:        issuerName(cert),
+		LastPollAt:    now,
+		Status:        statusAt(cert.NotAfter, now),
+	}
+}
+
+// issuerName returns the organization of the issuer of the certificate, or its
+// common name for issuers without an organization.
+func issuerName(cert *x509.Certificate) string {
+	if len(cert.Issuer.Organization) > 0 {
+		return cert.Issuer.Organization[0]
+	}
+	if len(cert.Issuer.CommonName) > 0 {
+		return cert.Issuer.CommonName
+	}
+	return "n/a"
+}
+
+// dialTLS resolves the host of the target, connects to the first address that
+// accepts the connection and performs the TLS handshake.
+func dialTLS(ctx context.Context, target data.ProbeTarget) (*tls.Conn, error) {
+	config, err := tlsConfig(target)
+	if err != nil {
+		return nil, err
+	}
+	_, port, err := net.SplitHostPort(target.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	dnsCtx, span := tracing.Start(ctx, "ssl.dns")
+	addrs, err := net.DefaultResolver.LookupIPAddr(dnsCtx, target.Host)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	tcpCtx, span := tracing.Start(ctx, "ssl.tcp_connect")
+	var (
+		dialer net.Dialer
+		conn   net.Conn
+	)
+	for _, addr := range addrs {
+		conn, err = dialer.DialContext(tcpCtx, "tcp", net.JoinHostPort(addr.IP.String(), port))
+		if err == nil {
+			span.SetAttributes(attribute.String("net.sock.peer.addr", addr.IP.String()))
+			break
+		}
+	}
+	if err == nil && conn == nil {
+		err = fmt.Errorf("no addresses found for %s", target.Host)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCtx, span := tracing.Start(ctx, "ssl.tls_handshake")
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.HandshakeContext(tlsCtx)
+	tracing.End(span, err)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// tlsConfig returns the TLS config for the SNI and protocol options of the target.
+func tlsConfig(target data.ProbeTarget) (*tls.Config, error) {
+	config := &tls.Config{ServerName: target.SNI}
+	if len(config.ServerName) == 0 {
+		config.ServerName = target.Host
+	}
+	switch target.Options {
+	case "":
+	case "tls1.2":
+		config.MinVersion = tls.VersionTLS12
+	case "tls1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported probe options %q", target.Options)
+	}
+	return config, nil
+}
+
 func extKeyUsageToString(usage x509.ExtKeyUsage) string {
 	switch usage {
 	case x509.ExtKeyUsageAny:
@@ -173,14 +279,17 @@ func IsConnectionRefused(err error) bool {
 var loomingTreshold = time.Hour * 24 * 7 * 2 // 2 weeks
 
 func getStatus(expires time.Time) string {
-	if expires.Before(time.Now()) {
-		return "expired"
+	return statusAt(expires, time.Now())
+}
+
+func statusAt(expires time.Time, now time.Time) string {
+	if expires.Before(now) {
+		return data.StatusExpired
 	}
-	timeLeft := time.Until(expires)
-	if timeLeft < loomingTreshold {
-		return "expires"
+	if expires.Sub(now) < loomingTreshold {
+		return data.StatusExpires
 	}
-	return "healthy"
+	return data.StatusHealthy
 }
 
 func sha1Hex(b []byte) string {
@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"time"
+
 	"github.com/anthdm/ssltracker/data"
 )
 
@@ -9,19 +11,25 @@ type accountSettings struct {
 	Webhooks         bool
 	SlackIntegration bool
 	TeamsIntegration bool
+	// PollInterval is the default (and shortest) interval between 2 polls
+	// of a tracking.
+	PollInterval time.Duration
 }
 
 var Account = map[data.Plan]accountSettings{
 	data.PlanStarter: {
 		MaxTrackings: 2,
+		PollInterval: time.Hour,
 	},
 	data.PlanBusiness: {
 		MaxTrackings:     20,
+		PollInterval:     time.Minute * 15,
 		Webhooks:         true,
 		SlackIntegration: true,
 	},
 	data.PlanEnterprise: {
 		MaxTrackings:     200,
+		PollInterval:     time.Minute * 5,
 		Webhooks:         true,
 		SlackIntegration: true,
 		TeamsIntegration: true,
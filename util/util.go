@@ -2,14 +2,20 @@ package util
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
 	"unicode"
 )
 
-func IsValidWebhook(url string) bool {
-	return false
+// IsValidWebhook returns true if the URL is an absolute HTTP(S) URL.
+func IsValidWebhook(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "https" || u.Scheme == "http") && len(u.Host) > 0
 }
 
 func IsErrNoRecords(err error) bool {